@@ -1,22 +1,53 @@
 package hnsw
 
-import "cmp"
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
 
 // Analyzer is a struct that holds a graph and provides
 // methods for analyzing it. It offers no compatibility guarantee
 // as the methods of measuring the graph's health with change
 // with the implementation.
+//
+// To analyze a graph that is modified concurrently, set Lock to the lock
+// guarding the graph's writers, typically the RLocker of a
+// sync.RWMutex. Each method then works on a consistent state of the
+// graph by holding the lock for its whole duration: Height is constant
+// time, Connectivity and Topography walk every node, and Metrics
+// additionally runs its sample searches, blocking writers meanwhile.
 type Analyzer[K cmp.Ordered] struct {
 	Graph *Graph[K]
+
+	// Lock is held while reading the graph, if set.
+	Lock sync.Locker
+}
+
+func (a *Analyzer[T]) lock() func() {
+	return lockOrNop(a.Lock)
 }
 
 func (a *Analyzer[T]) Height() int {
+	defer a.lock()()
+	return a.height()
+}
+
+func (a *Analyzer[T]) height() int {
 	return len(a.Graph.layers)
 }
 
 // Connectivity returns the average number of edges in the
 // graph for each non-empty layer.
 func (a *Analyzer[T]) Connectivity() []float64 {
+	defer a.lock()()
+	return a.connectivity()
+}
+
+func (a *Analyzer[T]) connectivity() []float64 {
 	var layerConnectivity []float64
 	for _, layer := range a.Graph.layers {
 		if len(layer.nodes) == 0 {
@@ -36,9 +67,435 @@ func (a *Analyzer[T]) Connectivity() []float64 {
 
 // Topography returns the number of nodes in each layer of the graph.
 func (a *Analyzer[T]) Topography() []int {
+	defer a.lock()()
+	return a.topography()
+}
+
+func (a *Analyzer[T]) topography() []int {
 	var topography []int
 	for _, layer := range a.Graph.layers {
 		topography = append(topography, len(layer.nodes))
 	}
 	return topography
 }
+
+// GraphQualityMetrics summarizes the health of a graph, see
+// Analyzer.Metrics. Metrics of two snapshots can be compared with
+// Analyzer.Compare.
+type GraphQualityMetrics struct {
+	Nodes        int
+	Height       int
+	Connectivity []float64
+	Topography   []int
+
+	// LayerBalance is the average ratio of the size of each layer to the
+	// size of the layer below. It is close to Ml in a well-balanced graph.
+	LayerBalance float64
+
+	// Recall is the fraction of sampled nodes that a search for their
+	// own vector returns as the nearest neighbor.
+	Recall float64
+}
+
+// Metrics measures the quality of the graph. Recall is measured by
+// searching for up to samples nodes, spread evenly over the graph.
+func (a *Analyzer[T]) Metrics(samples int) GraphQualityMetrics {
+	defer a.lock()()
+
+	g := a.Graph
+	m := GraphQualityMetrics{
+		Nodes:        g.Len(),
+		Height:       a.height(),
+		Connectivity: a.connectivity(),
+		Topography:   a.topography(),
+	}
+
+	for i := 1; i < len(m.Topography); i++ {
+		m.LayerBalance += float64(m.Topography[i]) / float64(m.Topography[i-1])
+	}
+	if len(m.Topography) > 1 {
+		m.LayerBalance /= float64(len(m.Topography) - 1)
+	}
+
+	if samples <= 0 || m.Nodes == 0 {
+		return m
+	}
+	var (
+		stride       = max(len(g.keys)/samples, 1)
+		hits, tested int
+	)
+	for id := 0; id < len(g.keys) && tested < samples; id += stride {
+		node, ok := g.layers[0].nodes[uint32(id)]
+		if !ok {
+			// Freed ID.
+			continue
+		}
+		tested++
+		results := g.Search(node.Value, 1)
+		if len(results) > 0 && results[0].Key == g.keys[id] {
+			hits++
+		}
+	}
+	if tested > 0 {
+		m.Recall = float64(hits) / float64(tested)
+	}
+	return m
+}
+
+// OutlierScore is the outlier score of a node, see Analyzer.OutlierScores.
+type OutlierScore[K cmp.Ordered] struct {
+	Key K
+	// Score is the distance from the node to its k-th nearest neighbor.
+	Score float32
+}
+
+// OutlierScores scores every node by the distance to its k-th nearest
+// neighbor, as found by searching the graph, and returns the scores
+// sorted from the most to the least isolated node, e.g. to review the
+// output of an embedding pipeline for garbage. Nodes with fewer than k
+// neighbors in the whole graph score +Inf.
+func (a *Analyzer[T]) OutlierScores(k int) []OutlierScore[T] {
+	defer a.lock()()
+
+	g := a.Graph
+	if k <= 0 || g.Len() == 0 {
+		return nil
+	}
+	ef := max(g.EfSearch, k+1)
+	scores := make([]OutlierScore[T], 0, g.Len())
+	for id, node := range g.layers[0].nodes {
+		score := float32(math.Inf(1))
+		var seen int
+		params := searchParams{
+			k:        k + 1,
+			efSearch: ef,
+			target:   node.Value,
+			distance: g.Distance,
+			maxDist:  noMaxDist,
+		}
+		for _, c := range node.search(&params) {
+			if c.node.id == id {
+				continue
+			}
+			if seen++; seen == k {
+				score = c.dist
+				break
+			}
+		}
+		scores = append(scores, OutlierScore[T]{Key: g.keys[id], Score: score})
+	}
+	slices.SortFunc(scores, func(a, b OutlierScore[T]) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return scores
+}
+
+// workSamples is the number of searches measured by
+// Analyzer.ExpectedWorkEstimate.
+const workSamples = 64
+
+// WorkEstimate is the expected work of a search, see
+// Analyzer.ExpectedWorkEstimate.
+type WorkEstimate struct {
+	// Samples is the number of searches measured.
+	Samples int
+
+	// Visited is the mean number of distance computations per search,
+	// and P99Visited their 99th percentile.
+	Visited    float64
+	P99Visited int
+
+	// Expanded is the mean number of candidates expanded per search, and
+	// Frontier the mean of the largest number of candidates queued at
+	// once, which bounds the memory of a search.
+	Expanded, Frontier float64
+
+	// LayerVisited is the mean number of distance computations per
+	// search in each layer, by level.
+	LayerVisited []float64
+}
+
+// ExpectedWorkEstimate estimates the work of searches for the k nearest
+// neighbors with EfSearch set to ef, e.g. to plan the capacity needed by
+// a change of parameters before deploying it. It searches for the
+// vectors of nodes spread evenly over the graph, as representative
+// queries, and reports their SearchStats.
+func (a *Analyzer[T]) ExpectedWorkEstimate(k, ef int) WorkEstimate {
+	defer a.lock()()
+
+	g := a.Graph
+	var est WorkEstimate
+	if g.Len() == 0 || k <= 0 {
+		return est
+	}
+	est.LayerVisited = make([]float64, len(g.layers))
+	var (
+		stride  = max(len(g.keys)/workSamples, 1)
+		visited []int
+		stats   SearchStats
+	)
+	for id := 0; id < len(g.keys) && est.Samples < workSamples; id += stride {
+		node, ok := g.layers[0].nodes[uint32(id)]
+		if !ok {
+			// Freed ID.
+			continue
+		}
+		est.Samples++
+		g.SearchWithOptions(node.Value, k, SearchOptions{Stats: &stats, efSearch: ef})
+		visited = append(visited, stats.Visited)
+		est.Visited += float64(stats.Visited)
+		var frontier int
+		for _, layer := range stats.Layers {
+			est.Expanded += float64(layer.Expanded)
+			frontier = max(frontier, layer.Frontier)
+			est.LayerVisited[layer.Level] += float64(layer.Visited)
+		}
+		est.Frontier += float64(frontier)
+	}
+	n := float64(est.Samples)
+	est.Visited /= n
+	est.Expanded /= n
+	est.Frontier /= n
+	for i := range est.LayerVisited {
+		est.LayerVisited[i] /= n
+	}
+	slices.Sort(visited)
+	est.P99Visited = visited[(len(visited)-1)*99/100]
+	return est
+}
+
+// driftNeighbors is the number of nearest neighbors compared by
+// Analyzer.Drift.
+const driftNeighbors = 10
+
+// DriftReport measures the shift between two vector populations, see
+// Analyzer.Drift.
+type DriftReport struct {
+	// MeanShift is the Euclidean distance between the means of the two
+	// populations, relative to the norm of the first mean.
+	MeanShift float64
+
+	// VarianceChange is the Euclidean distance between the per-dimension
+	// variances of the two populations, i.e. the diagonals of their
+	// covariance matrices, relative to the norm of the first.
+	VarianceChange float64
+
+	// NeighborOverlap is the average fraction of the nearest neighbors
+	// of a key in one graph that are also among its nearest neighbors in
+	// the other, over sampled keys present in both. It is 1 if the two
+	// embed the same keys with the same neighborhoods, and NaN if they
+	// have no keys in common.
+	NeighborOverlap float64
+
+	// Compared is the number of keys NeighborOverlap was measured on.
+	Compared int
+}
+
+// Drift measures the distribution shift from the Analyzer's graph to
+// other, e.g. the same keys embedded by a new version of a model, to
+// check that an index is safe to swap in. MeanShift and VarianceChange
+// compare all vectors of the graphs, and are NaN if the graphs have
+// different dimensions. NeighborOverlap compares the neighborhoods of up
+// to samples keys, spread evenly over the graph.
+//
+// other is not covered by Lock, and must not be modified meanwhile.
+func (a *Analyzer[T]) Drift(other *Graph[T], samples int) DriftReport {
+	defer a.lock()()
+
+	g := a.Graph
+	r := DriftReport{
+		MeanShift:       math.NaN(),
+		VarianceChange:  math.NaN(),
+		NeighborOverlap: math.NaN(),
+	}
+	if g.Len() == 0 || other.Len() == 0 {
+		return r
+	}
+
+	if g.Dims() == other.Dims() {
+		meanA, varA := moments(g)
+		meanB, varB := moments(other)
+		r.MeanShift = relativeDistance(meanA, meanB)
+		r.VarianceChange = relativeDistance(varA, varB)
+	}
+
+	if samples <= 0 {
+		return r
+	}
+	var (
+		stride  = max(len(g.keys)/samples, 1)
+		overlap float64
+	)
+	for id := 0; id < len(g.keys) && r.Compared < samples; id += stride {
+		node, ok := g.layers[0].nodes[uint32(id)]
+		if !ok {
+			// Freed ID.
+			continue
+		}
+		key := g.keys[id]
+		vec, ok := other.Lookup(key)
+		if !ok {
+			continue
+		}
+		r.Compared++
+
+		// Search for one more neighbor, as the node finds itself.
+		neighbors := g.Search(node.Value, driftNeighbors+1)
+		var want []T
+		for _, n := range neighbors {
+			if n.Key != key && len(want) < driftNeighbors {
+				want = append(want, n.Key)
+			}
+		}
+		if len(want) == 0 {
+			overlap++
+			continue
+		}
+		var found int
+		for _, n := range other.Search(vec, driftNeighbors+1) {
+			if n.Key != key && slices.Contains(want, n.Key) {
+				found++
+			}
+		}
+		overlap += float64(found) / float64(len(want))
+	}
+	if r.Compared > 0 {
+		r.NeighborOverlap = overlap / float64(r.Compared)
+	}
+	return r
+}
+
+// moments returns the per-dimension mean and variance of the vectors of
+// g, which must not be empty.
+func moments[K cmp.Ordered](g *Graph[K]) (mean, variance []float64) {
+	dims := g.Dims()
+	mean = make([]float64, dims)
+	variance = make([]float64, dims)
+	for _, node := range g.layers[0].nodes {
+		for i, x := range node.Value {
+			mean[i] += float64(x)
+		}
+	}
+	n := float64(g.Len())
+	for i := range mean {
+		mean[i] /= n
+	}
+	for _, node := range g.layers[0].nodes {
+		for i, x := range node.Value {
+			d := float64(x) - mean[i]
+			variance[i] += d * d
+		}
+	}
+	for i := range variance {
+		variance[i] /= n
+	}
+	return mean, variance
+}
+
+// relativeDistance returns the Euclidean distance between a and b
+// relative to the norm of a, or the absolute distance if a is 0.
+func relativeDistance(a, b []float64) float64 {
+	var dist, norm float64
+	for i := range a {
+		d := a[i] - b[i]
+		dist += d * d
+		norm += a[i] * a[i]
+	}
+	if norm == 0 {
+		return math.Sqrt(dist)
+	}
+	return math.Sqrt(dist / norm)
+}
+
+// QualityThresholds are the tolerated degradations between two
+// GraphQualityMetrics. A zero threshold tolerates no degradation at all.
+type QualityThresholds struct {
+	// Connectivity is the tolerated relative decrease of the base layer's
+	// connectivity, e.g. 0.1 for 10%.
+	Connectivity float64
+
+	// LayerBalance is the tolerated absolute change of LayerBalance in
+	// either direction.
+	LayerBalance float64
+
+	// Recall is the tolerated absolute decrease of Recall.
+	Recall float64
+}
+
+// QualityRegression is a metric that degraded beyond its threshold.
+type QualityRegression struct {
+	Metric        string
+	Before, After float64
+	Threshold     float64
+}
+
+func (r QualityRegression) String() string {
+	return fmt.Sprintf("%s degraded from %.4g to %.4g (threshold %.4g)", r.Metric, r.Before, r.After, r.Threshold)
+}
+
+// QualityVerdict is the result of Analyzer.Compare.
+type QualityVerdict struct {
+	Regressions []QualityRegression
+}
+
+// OK reports whether no metric degraded beyond its threshold.
+func (v QualityVerdict) OK() bool {
+	return len(v.Regressions) == 0
+}
+
+// Err returns an error listing the regressions, or nil if v is OK.
+func (v QualityVerdict) Err() error {
+	if v.OK() {
+		return nil
+	}
+	msgs := make([]string, len(v.Regressions))
+	for i, r := range v.Regressions {
+		msgs[i] = r.String()
+	}
+	return fmt.Errorf("graph quality regressed: %s", strings.Join(msgs, "; "))
+}
+
+// Compare checks whether the graph degraded from before to after beyond
+// the thresholds, e.g. to fail a data pipeline when a rebuild produces a
+// worse graph. It doesn't use the Analyzer's graph.
+func (a *Analyzer[T]) Compare(before, after GraphQualityMetrics, thresholds QualityThresholds) QualityVerdict {
+	var v QualityVerdict
+
+	var connBefore, connAfter float64
+	if len(before.Connectivity) > 0 {
+		connBefore = before.Connectivity[0]
+	}
+	if len(after.Connectivity) > 0 {
+		connAfter = after.Connectivity[0]
+	}
+	if connAfter < connBefore*(1-thresholds.Connectivity) {
+		v.Regressions = append(v.Regressions, QualityRegression{
+			Metric:    "connectivity",
+			Before:    connBefore,
+			After:     connAfter,
+			Threshold: thresholds.Connectivity,
+		})
+	}
+
+	if math.Abs(after.LayerBalance-before.LayerBalance) > thresholds.LayerBalance {
+		v.Regressions = append(v.Regressions, QualityRegression{
+			Metric:    "layer balance",
+			Before:    before.LayerBalance,
+			After:     after.LayerBalance,
+			Threshold: thresholds.LayerBalance,
+		})
+	}
+
+	if after.Recall < before.Recall-thresholds.Recall {
+		v.Regressions = append(v.Regressions, QualityRegression{
+			Metric:    "recall",
+			Before:    before.Recall,
+			After:     after.Recall,
+			Threshold: thresholds.Recall,
+		})
+	}
+	return v
+}
@@ -0,0 +1,165 @@
+package hnsw
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzer_Compare(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 256; i++ {
+		g.Add(MakeNode(i, randFloats(4)))
+	}
+	a := &Analyzer[int]{Graph: g}
+	before := a.Metrics(64)
+	require.Equal(t, 256, before.Nodes)
+	require.Positive(t, before.Recall)
+
+	thresholds := QualityThresholds{Connectivity: 0.1, LayerBalance: 0.1, Recall: 0.1}
+	require.True(t, a.Compare(before, before, thresholds).OK())
+	require.NoError(t, a.Compare(before, before, thresholds).Err())
+
+	// Deleting most of the graph with deferred repairs leaves it
+	// poorly connected.
+	g.DeferRepair = true
+	for i := 0; i < 200; i++ {
+		g.Delete(i)
+	}
+	after := a.Metrics(64)
+	v := a.Compare(before, after, thresholds)
+	require.False(t, v.OK())
+	require.Equal(t, "connectivity", v.Regressions[0].Metric)
+	require.ErrorContains(t, v.Err(), "connectivity degraded")
+
+	// Improved connectivity is not a regression.
+	require.True(t, a.Compare(after, before, QualityThresholds{LayerBalance: 1, Recall: 1}).OK())
+}
+
+func TestAnalyzer_Lock(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu sync.RWMutex
+		g  = newTestGraph[int]()
+		a  = &Analyzer[int]{Graph: g, Lock: mu.RLocker()}
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 512; i++ {
+			mu.Lock()
+			g.Add(MakeNode(i, randFloats(4)))
+			if i%3 == 0 {
+				g.Delete(i / 2)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			require.Equal(t, g.Len(), a.Metrics(16).Nodes)
+			return
+		default:
+		}
+		m := a.Metrics(16)
+		if m.Nodes > 0 {
+			require.Equal(t, m.Nodes, m.Topography[0])
+		}
+		a.Connectivity()
+	}
+}
+
+func TestAnalyzer_OutlierScores(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 100; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	g.Add(MakeNode(1000, Vector{500}), MakeNode(1001, Vector{-300}))
+
+	a := &Analyzer[int]{Graph: g}
+	scores := a.OutlierScores(2)
+	require.Len(t, scores, g.Len())
+	require.Equal(t, OutlierScore[int]{Key: 1000, Score: 402}, scores[0])
+	require.Equal(t, OutlierScore[int]{Key: 1001, Score: 301}, scores[1])
+	// The second nearest neighbor of evenly spaced nodes is on the
+	// other side of them, except at the ends.
+	require.Equal(t, float32(1), scores[len(scores)-1].Score)
+	require.Equal(t, float32(2), scores[2].Score)
+
+	// Too few nodes for a k-th neighbor.
+	require.Equal(t, float32(math.Inf(1)), a.OutlierScores(200)[0].Score)
+	require.Nil(t, a.OutlierScores(0))
+}
+
+func TestAnalyzer_ExpectedWorkEstimate(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 1000; i++ {
+		g.Add(MakeNode(i, randFloats(8)))
+	}
+	a := &Analyzer[int]{Graph: g}
+	require.Zero(t, a.ExpectedWorkEstimate(0, 10))
+
+	small := a.ExpectedWorkEstimate(10, 10)
+	large := a.ExpectedWorkEstimate(10, 100)
+	require.Equal(t, workSamples, small.Samples)
+	require.Greater(t, large.Visited, 2*small.Visited)
+	require.Greater(t, large.Expanded, small.Expanded)
+	require.GreaterOrEqual(t, large.P99Visited, int(large.Visited))
+	require.Len(t, large.LayerVisited, len(g.layers))
+	require.Greater(t, large.LayerVisited[0], large.LayerVisited[len(g.layers)-1])
+	// The graph's own parameters are left alone.
+	require.Equal(t, 20, g.EfSearch)
+}
+
+func TestAnalyzer_Drift(t *testing.T) {
+	t.Parallel()
+
+	build := func(vec func(i int) Vector) *Graph[int] {
+		g := newTestGraph[int]()
+		g.M = 16
+		g.EfSearch = 64
+		for i := 0; i < 500; i++ {
+			g.Add(MakeNode(i, vec(i)))
+		}
+		return g
+	}
+	vectors := make([]Vector, 500)
+	for i := range vectors {
+		vectors[i] = randFloats(8)
+	}
+	a := &Analyzer[int]{Graph: build(func(i int) Vector { return vectors[i] })}
+
+	// Translating the vectors shifts the mean, but keeps neighborhoods.
+	shifted := a.Drift(build(func(i int) Vector {
+		return Subtract(vectors[i], Vector{1, 1, 1, 1, 1, 1, 1, 1})
+	}), 50)
+	require.Equal(t, 50, shifted.Compared)
+	require.Greater(t, shifted.MeanShift, 1.0)
+	require.InDelta(t, 0, shifted.VarianceChange, 1e-3)
+	require.Greater(t, shifted.NeighborOverlap, 0.9)
+
+	// Unrelated vectors for the same keys have unrelated neighborhoods.
+	unrelated := a.Drift(build(func(int) Vector { return randFloats(8) }), 50)
+	require.Less(t, unrelated.MeanShift, 0.2)
+	require.Less(t, unrelated.NeighborOverlap, 0.2)
+
+	// Dimensions differ.
+	resized := a.Drift(build(func(int) Vector { return randFloats(4) }), 50)
+	require.True(t, math.IsNaN(resized.MeanShift))
+	require.True(t, math.IsNaN(resized.VarianceChange))
+	require.Equal(t, 50, resized.Compared)
+
+	require.True(t, math.IsNaN(a.Drift(NewGraph[int](), 50).NeighborOverlap))
+}
@@ -0,0 +1,134 @@
+package hnsw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// buildSuffix is appended to SavedGraph.Path to name the file holding
+// the cursor of an unfinished Build.
+const buildSuffix = ".build"
+
+// BuildOptions configures SavedGraph.Build.
+type BuildOptions struct {
+	// CheckpointEvery is the number of nodes added between checkpoints.
+	// Defaults to 10000.
+	CheckpointEvery int
+
+	// SnapshotEvery is the number of checkpoints after which a
+	// checkpoint writes a full snapshot with Save rather than appending
+	// to the delta file with SaveIncremental, which bounds the delta
+	// file and the time to load it. Defaults to 16.
+	SnapshotEvery int
+
+	// Canary, if set, is observed after every node added, e.g. a
+	// RecallCanary of the graph, so that parameters that don't suit the
+	// data show up early in a long build.
+	Canary Canary
+}
+
+// Build adds the nodes returned by next to the graph, checkpointing the
+// graph and the progress of the build periodically, so that builds taking
+// hours survive crashes and restarts. next is called with consecutive
+// cursors, beginning with that of the last checkpoint, and returns false
+// once there are no more nodes. It must return the same node for a cursor
+// across runs, e.g. the line of an input file with that index.
+//
+// If Build is interrupted, loading the graph with LoadSavedGraph and
+// calling Build again resumes from the last checkpoint. Nodes added since
+// are added again, which replaces them. When ctx is canceled, Build
+// checkpoints before returning the context's error. Once all nodes are
+// added, it saves the graph and forgets the cursor.
+func (g *SavedGraph[K]) Build(ctx context.Context, next func(cursor int) (Node[K], bool), opts BuildOptions) error {
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = 10000
+	}
+	if opts.SnapshotEvery <= 0 {
+		opts.SnapshotEvery = 16
+	}
+
+	cursor, err := g.buildCursor()
+	if err != nil {
+		return fmt.Errorf("reading cursor: %w", err)
+	}
+
+	var added, checkpoints int
+	checkpoint := func() error {
+		checkpoints++
+		var err error
+		if checkpoints%opts.SnapshotEvery == 0 {
+			err = g.Save()
+		} else {
+			err = g.SaveIncremental()
+		}
+		if err == nil {
+			// The cursor is written after the graph, so that it never
+			// runs ahead of it.
+			err = saveFile(g.Path+buildSuffix, func(w io.Writer) error {
+				_, err := binaryWrite(w, cursor)
+				return err
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("checkpoint at %d: %w", cursor, err)
+		}
+		added = 0
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(err, checkpoint())
+		}
+		node, ok := next(cursor)
+		if !ok {
+			break
+		}
+		g.Add(node)
+		cursor++
+		added++
+		if opts.Canary != nil {
+			opts.Canary.Observe()
+		}
+		if added == opts.CheckpointEvery {
+			if err := checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = g.Save()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(g.Path + buildSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing cursor: %w", err)
+	}
+	return nil
+}
+
+// buildCursor returns the cursor of the last checkpoint of Build, or 0
+// if there is none.
+func (g *SavedGraph[K]) buildCursor() (int, error) {
+	data, err := os.ReadFile(g.Path + buildSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var cursor int
+	_, err = binaryRead(bytes.NewReader(data), &cursor)
+	if err != nil {
+		return 0, err
+	}
+	if cursor < 0 {
+		return 0, fmt.Errorf("invalid cursor %d", cursor)
+	}
+	return cursor, nil
+}
@@ -0,0 +1,138 @@
+package hnsw
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavedGraph_Build(t *testing.T) {
+	t.Parallel()
+
+	path := t.TempDir() + "/graph"
+	vectors := make([]Vector, 1000)
+	rng := rand.New(rand.NewSource(0))
+	for i := range vectors {
+		vectors[i] = Vector{rng.Float32(), rng.Float32()}
+	}
+
+	// The first run is interrupted after 450 nodes.
+	ctx, cancel := context.WithCancel(context.Background())
+	g, err := LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	var first []int
+	err = g.Build(ctx, func(cursor int) (Node[int], bool) {
+		first = append(first, cursor)
+		if cursor == 449 {
+			cancel()
+		}
+		return MakeNode(cursor, vectors[cursor]), cursor < len(vectors)
+	}, BuildOptions{CheckpointEvery: 100, SnapshotEvery: 2})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, first, 450)
+
+	// The second run resumes where the first one stopped.
+	g, err = LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	require.Equal(t, 450, g.Len())
+	var second []int
+	err = g.Build(context.Background(), func(cursor int) (Node[int], bool) {
+		second = append(second, cursor)
+		if cursor == len(vectors) {
+			return Node[int]{}, false
+		}
+		return MakeNode(cursor, vectors[cursor]), true
+	}, BuildOptions{CheckpointEvery: 100})
+	require.NoError(t, err)
+	require.Equal(t, 450, second[0])
+	require.Equal(t, len(vectors), second[len(second)-1])
+
+	_, err = os.Stat(path + buildSuffix)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	g, err = LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	require.Equal(t, len(vectors), g.Len())
+	require.NoError(t, g.checkInvariants())
+	for i, vec := range vectors {
+		got, ok := g.Lookup(i)
+		require.True(t, ok)
+		require.Equal(t, vec, got)
+	}
+}
+
+func TestSavedGraph_BuildStaleDelta(t *testing.T) {
+	t.Parallel()
+
+	path := t.TempDir() + "/graph"
+	// Cursor 3 replaces the node of cursor 0, and so on.
+	node := func(cursor int) Node[int] {
+		return MakeNode(cursor%3, Vector{float32(cursor), 1})
+	}
+
+	// The first run stops after the snapshot checkpoint at cursor 4. The
+	// delta of the incremental checkpoint before it is put back, as if
+	// the run crashed in Save before removing it.
+	ctx, cancel := context.WithCancel(context.Background())
+	g, err := LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	var stale []byte
+	err = g.Build(ctx, func(cursor int) (Node[int], bool) {
+		if cursor == 3 {
+			stale, err = os.ReadFile(path + deltaSuffix)
+			require.NoError(t, err)
+			cancel()
+		}
+		return node(cursor), true
+	}, BuildOptions{CheckpointEvery: 2, SnapshotEvery: 2})
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, os.WriteFile(path+deltaSuffix, stale, 0o600))
+
+	// The resumed build keeps the replaced node.
+	g, err = LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	vec, ok := g.Lookup(0)
+	require.True(t, ok)
+	require.Equal(t, Vector{3, 1}, vec)
+	err = g.Build(context.Background(), func(cursor int) (Node[int], bool) {
+		require.GreaterOrEqual(t, cursor, 4)
+		return node(cursor), cursor < 6
+	}, BuildOptions{CheckpointEvery: 2, SnapshotEvery: 2})
+	require.NoError(t, err)
+
+	g, err = LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	require.Equal(t, 3, g.Len())
+	for cursor := 3; cursor < 6; cursor++ {
+		want := node(cursor)
+		vec, ok := g.Lookup(want.Key)
+		require.True(t, ok)
+		require.Equal(t, want.Value, vec)
+	}
+}
+
+func TestSavedGraph_BuildCanary(t *testing.T) {
+	t.Parallel()
+
+	g, err := LoadSavedGraph[int](t.TempDir() + "/graph")
+	require.NoError(t, err)
+	var reports []CanaryReport
+	canary := &RecallCanary[int]{
+		Graph:   g.Graph,
+		Queries: []Vector{{0.5, 0.5}},
+		Every:   100,
+		Report:  func(r CanaryReport) { reports = append(reports, r) },
+	}
+	rng := rand.New(rand.NewSource(0))
+	err = g.Build(context.Background(), func(cursor int) (Node[int], bool) {
+		return MakeNode(cursor, Vector{rng.Float32(), rng.Float32()}), cursor < 350
+	}, BuildOptions{CheckpointEvery: 100, Canary: canary})
+	require.NoError(t, err)
+
+	require.Len(t, reports, 3)
+	for i, r := range reports {
+		require.Equal(t, (i+1)*100, r.Nodes)
+	}
+}
@@ -0,0 +1,367 @@
+package hnsw
+
+import (
+	"cmp"
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// QueryCache memoizes the results of recent searches on a graph, so that
+// repeated or near-identical queries, e.g. from retries or pagination,
+// are served without traversing the graph.
+//
+// Cached results are dropped as soon as the graph is modified, as
+// detected by Graph.Seq, or with Regional, only when the modification
+// may change them. QueryCache is safe for concurrent use, but searches
+// still must be synchronized with writers of the graph as for
+// Graph.Search.
+type QueryCache[K cmp.Ordered] struct {
+	Graph *Graph[K]
+
+	// Size is the maximum number of cached queries. The least recently
+	// used query is evicted first. Lookups compare the query with every
+	// cached one, so the cache is meant to be small. Defaults to 256.
+	Size int
+
+	// Threshold is the maximum distance, by the graph's distance
+	// function, between a query and a cached one for the cached results
+	// to be reused. Their distances are recomputed for the new query.
+	// Zero only reuses the results of identical queries, which are
+	// matched by hash. So are results ranked by options other than
+	// distance, such as SearchOptions.HalfLife.
+	Threshold float32
+
+	// TTL is how long results are cached. Zero caches them until they
+	// are evicted or the graph is modified.
+	//
+	// SearchOptions.Now is not part of the cached query, so that searches
+	// ranked by HalfLife can hit the cache when they pass the current
+	// time. Their results are then decayed from the Now of the search
+	// that cached them, so a TTL short compared to HalfLife bounds how
+	// stale the ranking gets.
+	TTL time.Duration
+
+	// Regional keeps cached results when the graph is modified in a
+	// region that can't change them: nodes deleted that aren't among the
+	// results, and nodes added farther from the query than all results.
+	// It is meant for read-heavy graphs with a trickle of writes to
+	// unrelated regions. Results ranked by options other than distance
+	// are still dropped by any modification, and results are dropped
+	// after more than changeLogSize modifications, or an Import.
+	Regional bool
+
+	mu      sync.Mutex
+	entries []queryCacheEntry[K] // most recently used first
+	hits    uint64
+	misses  uint64
+
+	// now is time.Now, replaced in tests.
+	now func() time.Time
+}
+
+type queryCacheEntry[K cmp.Ordered] struct {
+	query []float32
+	hash  uint64
+	k     int
+	opts  SearchOptions
+	// filterKey is the Filter.CacheKey of filtered searches, and filter
+	// the filter.
+	filterKey string
+	filter    *Filter[K]
+	// seq and changes are the graph's Seq and number of changes when the
+	// results were cached or last found unaffected by changes.
+	seq     uint64
+	changes uint64
+	expires time.Time
+	results []SearchResult[K]
+}
+
+// Search is like Graph.Search, but served from the cache if possible.
+func (c *QueryCache[K]) Search(near Vector, k int) []Node[K] {
+	results := c.SearchWithOptions(near, k, SearchOptions{})
+	out := make([]Node[K], len(results))
+	for i, result := range results {
+		out[i] = result.Node
+	}
+	return out
+}
+
+// SearchWithOptions is like Graph.SearchWithOptions, but served from the
+// cache if possible. Searches with Exploration or a Deadline are never
+// cached, as their results are random or may be partial.
+func (c *QueryCache[K]) SearchWithOptions(near Vector, k int, opts SearchOptions) []SearchResult[K] {
+	return c.search(near, k, nil, opts)
+}
+
+// SearchFiltered is like Graph.SearchFiltered, but served from the cache
+// if possible. Only filters with a CacheKey are cached.
+func (c *QueryCache[K]) SearchFiltered(near Vector, k int, filter Filter[K], opts SearchOptions) []SearchResult[K] {
+	return c.search(near, k, &filter, opts)
+}
+
+func (c *QueryCache[K]) search(near Vector, k int, filter *Filter[K], opts SearchOptions) []SearchResult[K] {
+	graphSearch := func() []SearchResult[K] {
+		if filter != nil {
+			return c.Graph.SearchFiltered(near, k, *filter, opts)
+		}
+		return c.Graph.SearchWithOptions(near, k, opts)
+	}
+	if opts.Exploration > 0 || !opts.Deadline.IsZero() ||
+		filter != nil && filter.CacheKey == "" {
+		return graphSearch()
+	}
+
+	// The context only affects tracing, and may not be comparable, stats
+	// only report the work done, and Now is left out as documented on TTL.
+	key := opts
+	key.Context = nil
+	key.Stats = nil
+	key.Now = time.Time{}
+	var filterKey string
+	if filter != nil {
+		filterKey = filter.CacheKey
+	}
+	hash := hashVector(near)
+
+	c.mu.Lock()
+	results, ok := c.lookup(near, hash, k, filterKey, key)
+	if ok {
+		c.hits++
+		c.mu.Unlock()
+		if opts.Stats != nil {
+			// The graph wasn't searched.
+			*opts.Stats = SearchStats{}
+		}
+		return results
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	results = graphSearch()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := queryCacheEntry[K]{
+		query:     slices.Clone(near),
+		hash:      hash,
+		k:         k,
+		opts:      key,
+		filterKey: filterKey,
+		filter:    filter,
+		seq:       c.Graph.Seq(),
+		changes:   c.Graph.changes.n,
+		results:   slices.Clone(results),
+	}
+	if c.TTL > 0 {
+		entry.expires = c.clock().Add(c.TTL)
+	}
+	size := c.Size
+	if size <= 0 {
+		size = 256
+	}
+	c.entries = slices.Insert(c.entries, 0, entry)
+	if len(c.entries) > size {
+		c.entries = c.entries[:size]
+	}
+	return results
+}
+
+// lookup returns the cached results for a query, dropping stale entries
+// on the way. c.mu must be held.
+func (c *QueryCache[K]) lookup(near Vector, hash uint64, k int, filterKey string, opts SearchOptions) ([]SearchResult[K], bool) {
+	var (
+		seq     = c.Graph.Seq()
+		changes = c.Graph.changes.n
+		now     = c.clock()
+	)
+	kept := c.entries[:0]
+	for _, e := range c.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			continue
+		}
+		if e.seq != seq || e.changes != changes {
+			if !c.Regional || !c.unaffected(&e) {
+				continue
+			}
+			e.seq, e.changes = seq, changes
+		}
+		kept = append(kept, e)
+	}
+	clear(c.entries[len(kept):])
+	c.entries = kept
+
+	for i, e := range c.entries {
+		// Results are sorted, so those of a larger k can be truncated.
+		if e.opts != opts || e.filterKey != filterKey || e.k < k {
+			continue
+		}
+		if len(e.query) != len(near) {
+			continue
+		}
+		same := e.hash == hash && slices.Equal(e.query, near)
+		// Results ranked by options other than distance can't be
+		// rescored for a different query.
+		if !same && (c.Threshold == 0 || opts.reranks() ||
+			c.Graph.Distance(e.query, near) > c.Threshold) {
+			continue
+		}
+
+		// Move the entry to the front.
+		copy(c.entries[1:i+1], c.entries[:i])
+		c.entries[0] = e
+
+		results := slices.Clone(e.results)
+		if !same {
+			c.rescore(results, near)
+			if opts.MaxDistance > 0 {
+				results = slices.DeleteFunc(results, func(r SearchResult[K]) bool {
+					return r.Distance > opts.MaxDistance
+				})
+			}
+		}
+		return results[:min(k, len(results))], true
+	}
+	return nil, false
+}
+
+// unaffected reports whether the results of e are unchanged by the
+// changes of the graph since they were cached.
+func (c *QueryCache[K]) unaffected(e *queryCacheEntry[K]) bool {
+	g := c.Graph
+	if e.opts.reranks() {
+		// Scores depend on more than the distance.
+		return false
+	}
+	changed, ok := g.changes.since(e.changes)
+	if !ok {
+		return false
+	}
+	for _, key := range changed {
+		if slices.ContainsFunc(e.results, func(r SearchResult[K]) bool {
+			return r.Key == key
+		}) {
+			return false
+		}
+		vec, ok := g.Lookup(key)
+		if !ok {
+			// Deleted, and not among the results.
+			continue
+		}
+		if e.filter != nil && !e.filter.allows(key) {
+			continue
+		}
+		dist := g.Distance(vec, e.query)
+		if e.opts.MaxDistance > 0 && dist > e.opts.MaxDistance {
+			continue
+		}
+		if len(e.results) < e.k || dist <= e.results[len(e.results)-1].Distance {
+			return false
+		}
+	}
+	return true
+}
+
+// hashVector hashes the bits of v, so that equal vectors have the same
+// hash.
+func hashVector(v Vector) uint64 {
+	var (
+		h   maphash.Hash
+		buf [4]byte
+	)
+	h.SetSeed(vectorHashSeed)
+	for _, x := range v {
+		if x == 0 {
+			// Normalize -0.
+			x = 0
+		}
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(x))
+		_, _ = h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+var vectorHashSeed = maphash.MakeSeed()
+
+// changeLogSize is the number of latest changed keys a graph remembers
+// for QueryCache.Regional.
+const changeLogSize = 1024
+
+// changeLog is a ring of the keys of the latest mutations of a graph.
+type changeLog[K cmp.Ordered] struct {
+	keys []K
+	// n is the number of changes recorded, including those reset.
+	n uint64
+}
+
+// record records a change of key.
+func (l *changeLog[K]) record(key K) {
+	if l.keys == nil {
+		l.keys = make([]K, changeLogSize)
+	}
+	l.keys[l.n%changeLogSize] = key
+	l.n++
+}
+
+// reset records a change of every key.
+func (l *changeLog[K]) reset() {
+	l.n += changeLogSize + 1
+}
+
+// since returns the keys changed since the log had n changes, or false if
+// they are no longer known.
+func (l *changeLog[K]) since(n uint64) ([]K, bool) {
+	if l.n-n > changeLogSize {
+		return nil, false
+	}
+	keys := make([]K, 0, l.n-n)
+	for i := n; i < l.n; i++ {
+		keys = append(keys, l.keys[i%changeLogSize])
+	}
+	return keys, true
+}
+
+// rescore recomputes the distances and scores of results for near, and
+// sorts them by distance, then key.
+func (c *QueryCache[K]) rescore(results []SearchResult[K], near Vector) {
+	g := c.Graph
+	score := g.Score
+	if score == nil {
+		score = ScoreFuncFor(g.Distance)
+	}
+	for i := range results {
+		results[i].Distance = g.Distance(results[i].Value, near)
+		results[i].Score = score(results[i].Distance)
+	}
+	slices.SortFunc(results, func(a, b SearchResult[K]) int {
+		if c := cmp.Compare(a.Distance, b.Distance); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+}
+
+func (c *QueryCache[K]) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// Invalidate drops all cached results.
+func (c *QueryCache[K]) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// Stats returns the number of searches served from the cache and from
+// the graph.
+func (c *QueryCache[K]) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
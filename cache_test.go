@@ -0,0 +1,156 @@
+package hnsw
+
+import (
+	"cmp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCache(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+
+	now := time.Unix(0, 0)
+	c := &QueryCache[int]{
+		Graph:     g,
+		Threshold: 0.25,
+		TTL:       time.Minute,
+		now:       func() time.Time { return now },
+	}
+	requireStats := func(hits, misses uint64) {
+		t.Helper()
+		h, m := c.Stats()
+		require.Equal(t, hits, h, "hits")
+		require.Equal(t, misses, m, "misses")
+	}
+
+	want := g.SearchWithOptions(Vector{10}, 3, SearchOptions{})
+	require.Equal(t, want, c.SearchWithOptions(Vector{10}, 3, SearchOptions{}))
+	requireStats(0, 1)
+	require.Equal(t, want, c.SearchWithOptions(Vector{10}, 3, SearchOptions{}))
+	require.Equal(t, want[:2], c.SearchWithOptions(Vector{10}, 2, SearchOptions{}))
+	requireStats(2, 1)
+
+	// Near-identical queries reuse the results with new distances.
+	results := c.SearchWithOptions(Vector{10.2}, 1, SearchOptions{})
+	require.Equal(t, 10, results[0].Key)
+	require.InDelta(t, 0.2, results[0].Distance, 1e-6)
+	requireStats(3, 1)
+
+	// Different options, a larger k, or distant queries miss.
+	c.SearchWithOptions(Vector{10}, 3, SearchOptions{MaxDistance: 1})
+	c.SearchWithOptions(Vector{10}, 4, SearchOptions{})
+	c.Search(Vector{11}, 3)
+	requireStats(3, 4)
+
+	// Reranked results are only reused for identical queries, as
+	// rescoring them by distance would drop the ranking.
+	opts := SearchOptions{BoostWeight: 1}
+	c.SearchWithOptions(Vector{20}, 3, opts)
+	c.SearchWithOptions(Vector{20.1}, 3, opts)
+	requireStats(3, 6)
+	c.SearchWithOptions(Vector{20}, 3, opts)
+	requireStats(4, 6)
+
+	// Searches ranked by recency from the current time hit too.
+	opts = SearchOptions{HalfLife: time.Hour, Now: now}
+	want = c.SearchWithOptions(Vector{30}, 3, opts)
+	opts.Now = now.Add(time.Second)
+	require.Equal(t, want, c.SearchWithOptions(Vector{30}, 3, opts))
+	requireStats(5, 7)
+
+	// Entries expire.
+	now = now.Add(2 * time.Minute)
+	c.Search(Vector{10}, 3)
+	requireStats(5, 8)
+
+	// Mutations invalidate the cache.
+	g.Delete(10)
+	results = c.SearchWithOptions(Vector{10}, 3, SearchOptions{})
+	require.NotEqual(t, 10, results[0].Key)
+	requireStats(5, 9)
+
+	c.Invalidate()
+	c.Search(Vector{10}, 3)
+	requireStats(5, 10)
+
+	// The size is bounded.
+	c.Size = 2
+	for i := 0; i < 4; i++ {
+		c.Search(Vector{float32(i * 10)}, 1)
+	}
+	require.Len(t, c.entries, 2)
+}
+
+func TestQueryCache_Regional(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	c := &QueryCache[int]{Graph: g, Regional: true}
+	search := func(q float32) []SearchResult[int] {
+		return c.SearchWithOptions(Vector{q}, 3, SearchOptions{})
+	}
+	requireHits := func(want uint64) {
+		t.Helper()
+		hits, _ := c.Stats()
+		require.Equal(t, want, hits)
+	}
+
+	search(10)
+	search(100)
+	// Changes far from both queries keep their results.
+	g.Delete(50)
+	g.Add(MakeNode(200, Vector{200}))
+	search(10)
+	search(100)
+	requireHits(2)
+
+	// Deleting a result drops only its query.
+	g.Delete(101)
+	require.Equal(t, []int{100, 99, 98}, keys(search(100)))
+	search(10)
+	requireHits(3)
+
+	// So does adding a node closer than the results.
+	g.Add(MakeNode(1000, Vector{10.5}))
+	require.Equal(t, 1000, search(10)[1].Key)
+	search(100)
+	requireHits(4)
+
+	// Filtered searches are cached by key, and changes disallowed by
+	// their filter keep their results.
+	even := Filter[int]{Allow: func(key int) bool { return key%2 == 0 }, CacheKey: "even"}
+	want := g.SearchFiltered(Vector{20.2}, 3, even, SearchOptions{})
+	require.Equal(t, want, c.SearchFiltered(Vector{20.2}, 3, even, SearchOptions{}))
+	g.Add(MakeNode(1001, Vector{20.5}))
+	require.Equal(t, want, c.SearchFiltered(Vector{20.2}, 3, even, SearchOptions{}))
+	requireHits(5)
+	require.NotEqual(t, want, c.SearchWithOptions(Vector{20.2}, 3, SearchOptions{}))
+	even.CacheKey = ""
+	c.SearchFiltered(Vector{20.2}, 3, even, SearchOptions{})
+	requireHits(5)
+
+	// Too many changes drop everything.
+	for i := 0; i <= changeLogSize; i++ {
+		g.Add(MakeNode(2000+i, Vector{float32(5000 + i)}))
+	}
+	search(10)
+	requireHits(5)
+}
+
+func keys[K cmp.Ordered](results []SearchResult[K]) []K {
+	out := make([]K, len(results))
+	for i, r := range results {
+		out[i] = r.Key
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package hnsw
+
+import (
+	"cmp"
+	"slices"
+)
+
+// RecallCanary measures the recall of a graph while it is being built, so
+// that ingestion pipelines notice parameters that don't suit the data,
+// e.g. too low an M, early rather than after a full build. Call Observe
+// after adding each batch of nodes, or pass the canary to
+// SavedGraph.Build or ingest.Ingestor, which do.
+//
+// Recall is measured by searching for a reserved sample of query vectors
+// and comparing the results with the exact nearest neighbors, found by
+// brute force. Each check thus costs len(Queries) passes over the graph.
+type RecallCanary[K cmp.Ordered] struct {
+	Graph *Graph[K]
+
+	// Queries are the vectors searched for. They are typically held out
+	// from the data being added, and up to a few dozen are enough.
+	Queries []Vector
+
+	// K is the number of neighbors searched for. Defaults to 10.
+	K int
+
+	// Every is the number of nodes added between checks. Defaults to
+	// 10000.
+	Every int
+
+	// Report, if set, is called with the result of every check.
+	Report func(CanaryReport)
+
+	// checkedLen is the size of the graph at the last check.
+	checkedLen int
+}
+
+// Canary is observed by ingestion that adds nodes over a long time, see
+// BuildOptions.Canary. RecallCanary implements it.
+type Canary interface {
+	// Observe is called after each batch of nodes is added. It returns
+	// the report of a check and true if it checked.
+	Observe() (CanaryReport, bool)
+}
+
+// CanaryReport is the result of a check of a RecallCanary.
+type CanaryReport struct {
+	// Nodes is the number of nodes in the graph when it was checked.
+	Nodes int
+	// Recall is the fraction of the exact K nearest neighbors of the
+	// queries that searches found.
+	Recall float64
+}
+
+// Observe checks the graph if it grew by at least Every nodes since the
+// last check. It returns the report and true if it checked.
+func (c *RecallCanary[K]) Observe() (CanaryReport, bool) {
+	every := c.Every
+	if every <= 0 {
+		every = 10000
+	}
+	if c.Graph.Len()-c.checkedLen < every {
+		return CanaryReport{}, false
+	}
+	return c.Check(), true
+}
+
+// Check measures the recall of the graph now.
+func (c *RecallCanary[K]) Check() CanaryReport {
+	k := c.K
+	if k <= 0 {
+		k = 10
+	}
+	g := c.Graph
+	report := CanaryReport{Nodes: g.Len()}
+	c.checkedLen = report.Nodes
+	if report.Nodes == 0 || len(c.Queries) == 0 {
+		return report
+	}
+
+	var found, total int
+	for _, q := range c.Queries {
+		exact := c.exactNeighbors(q, k)
+		total += len(exact)
+		for _, node := range g.Search(q, k) {
+			if slices.Contains(exact, node.Key) {
+				found++
+			}
+		}
+	}
+	report.Recall = float64(found) / float64(total)
+	if c.Report != nil {
+		c.Report(report)
+	}
+	return report
+}
+
+// exactNeighbors returns the keys of the k nodes closest to q.
+func (c *RecallCanary[K]) exactNeighbors(q Vector, k int) []K {
+	g := c.Graph
+	nearest := make([]searchCandidate, 0, g.Len())
+	for _, node := range g.layers[0].nodes {
+		nearest = append(nearest, searchCandidate{node: node, dist: g.Distance(node.Value, q)})
+	}
+	// Break ties by key, like searches do.
+	slices.SortFunc(nearest, func(a, b searchCandidate) int {
+		if c := cmp.Compare(a.dist, b.dist); c != 0 {
+			return c
+		}
+		return cmp.Compare(g.keys[a.node.id], g.keys[b.node.id])
+	})
+	keys := make([]K, min(k, len(nearest)))
+	for i := range keys {
+		keys[i] = g.keys[nearest[i].node.id]
+	}
+	return keys
+}
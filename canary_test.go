@@ -0,0 +1,71 @@
+package hnsw
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecallCanary(t *testing.T) {
+	t.Parallel()
+
+	build := func(g *Graph[int]) []CanaryReport {
+		rng := rand.New(rand.NewSource(0))
+		vec := func() Vector {
+			v := make(Vector, 16)
+			for i := range v {
+				v[i] = rng.Float32()
+			}
+			return v
+		}
+		queries := make([]Vector, 16)
+		for i := range queries {
+			queries[i] = vec()
+		}
+
+		var reports []CanaryReport
+		c := &RecallCanary[int]{
+			Graph:   g,
+			Queries: queries,
+			Every:   1000,
+			Report:  func(r CanaryReport) { reports = append(reports, r) },
+		}
+		for i := 0; i < 3000; i += 100 {
+			for j := i; j < i+100; j++ {
+				g.Add(MakeNode(j, vec()))
+			}
+			c.Observe()
+		}
+		return reports
+	}
+
+	good := newTestGraph[int]()
+	good.M, good.EfSearch = 16, 64
+	reports := build(good)
+	require.Len(t, reports, 3)
+	for i, r := range reports {
+		require.Equal(t, (i+1)*1000, r.Nodes)
+		require.Greater(t, r.Recall, 0.8)
+	}
+
+	// Parameters too small for the data show up early.
+	poor := newTestGraph[int]()
+	poor.M, poor.EfSearch = 2, 1
+	reports = build(poor)
+	require.Less(t, reports[0].Recall, 0.5)
+}
+
+func TestRecallCanary_Ties(t *testing.T) {
+	t.Parallel()
+
+	// Nodes come in pairs with equal vectors. Searches break ties by key,
+	// so the exact neighbors must too for the recall to be exact.
+	g := newTestGraph[int]()
+	for i := 0; i < 64; i++ {
+		g.Add(MakeNode(i, Vector{float32(i / 2)}))
+	}
+	c := &RecallCanary[int]{Graph: g, Queries: []Vector{{10}, {20}}, K: 3}
+	require.Equal(t, []int{20, 21, 18}, c.exactNeighbors(Vector{10}, 3))
+	require.Equal(t, 1.0, c.Check().Recall)
+}
@@ -0,0 +1,74 @@
+package hnsw
+
+import "fmt"
+
+// checkInvariants verifies the structural invariants of the graph and
+// returns an error describing the first violation found.
+func (g *Graph[K]) checkInvariants() error {
+	for i, layer := range g.layers {
+		if layer == nil {
+			return fmt.Errorf("layer %d is nil", i)
+		}
+		if i == len(g.layers)-1 && layer.size() == 0 {
+			return fmt.Errorf("top layer %d is empty", i)
+		}
+
+		for id, node := range layer.nodes {
+			if node == nil {
+				return fmt.Errorf("layer %d: node %d is nil", i, id)
+			}
+			if node.id != id {
+				return fmt.Errorf("layer %d: node %d is stored under ID %d", i, node.id, id)
+			}
+			if _, ok := g.Key(id); !ok {
+				return fmt.Errorf("layer %d: node %d has no key", i, id)
+			}
+			// Every node in a layer must also be in the layer below,
+			// otherwise searches descending through it get lost.
+			if i > 0 {
+				if _, ok := g.layers[i-1].nodes[id]; !ok {
+					return fmt.Errorf("layer %d: node %d is missing from layer %d", i, id, i-1)
+				}
+			}
+
+			for j, neighbor := range node.neighbors {
+				if neighbor == nil {
+					return fmt.Errorf("layer %d: node %d has a nil neighbor at index %d", i, id, j)
+				}
+				if neighbor == node {
+					return fmt.Errorf("layer %d: node %d is its own neighbor", i, id)
+				}
+				if j > 0 && node.neighbors[j-1].id >= neighbor.id {
+					return fmt.Errorf("layer %d: neighbors of node %d are not sorted and unique", i, id)
+				}
+				if n, ok := layer.nodes[neighbor.id]; !ok || n != neighbor {
+					return fmt.Errorf("layer %d: node %d has neighbor %d that is not in the layer", i, id, neighbor.id)
+				}
+				if !neighbor.hasNeighbor(id) {
+					return fmt.Errorf("layer %d: edge %d -> %d has no backlink", i, id, neighbor.id)
+				}
+			}
+		}
+	}
+
+	if len(g.ids) != g.Len() {
+		return fmt.Errorf("%d keys for %d nodes", len(g.ids), g.Len())
+	}
+	for key, id := range g.ids {
+		if _, ok := g.layers[0].nodes[id]; !ok {
+			return fmt.Errorf("key %v has ID %d, which is not in the graph", key, id)
+		}
+	}
+	return nil
+}
+
+// debugCheck panics if DebugChecks is set and the graph violates
+// its invariants after op.
+func (g *Graph[K]) debugCheck(op string, key K) {
+	if !g.DebugChecks {
+		return
+	}
+	if err := g.checkInvariants(); err != nil {
+		panic(fmt.Sprintf("hnsw: invariant violated after %s(%v): %v", op, key, err))
+	}
+}
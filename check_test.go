@@ -0,0 +1,61 @@
+package hnsw
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_DebugChecks(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	g.DebugChecks = true
+
+	// Interleave inserts, replacements and deletes so that every
+	// repair path runs under the checks.
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 1000; i++ {
+		key := r.Intn(200)
+		if r.Intn(3) == 0 {
+			g.Delete(key)
+			continue
+		}
+		g.Add(MakeNode(key, Vector{r.Float32(), r.Float32(), r.Float32(), r.Float32()}))
+	}
+	require.NoError(t, g.checkInvariants())
+
+	// Corrupt the graph with a one-way edge. Nodes are picked in ID
+	// order, so that the test is deterministic.
+	var a, b *layerNode
+	ids := make([]uint32, 0, len(g.layers[0].nodes))
+	for id := range g.layers[0].nodes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		node := g.layers[0].nodes[id]
+		for _, other := range ids {
+			other := g.layers[0].nodes[other]
+			if node != other && !node.hasNeighbor(other.id) {
+				a, b = node, other
+				break
+			}
+		}
+		if a != nil {
+			break
+		}
+	}
+	require.NotNil(t, a)
+	a.link(b, len(a.neighbors)+1)
+	require.ErrorContains(t, g.checkInvariants(), "has no backlink")
+
+	defer func() {
+		msg, _ := recover().(string)
+		require.Contains(t, msg, "hnsw: invariant violated after Add(1000)")
+	}()
+	g.Add(MakeNode(1000, Vector{2, 2, 2, 2}))
+	t.Fatal("Add didn't panic")
+}
@@ -0,0 +1,425 @@
+package hnsw
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Collections is a set of named graphs, each with its own dimensionality
+// and distance function, e.g. for embeddings from several models. Unlike
+// Graph, its methods return errors instead of panicking on dimension
+// mismatches, and all collections are persisted to a single file.
+type Collections[K cmp.Ordered] struct {
+	// KeyCoder is set on the graphs created by Import, see
+	// Graph.KeyCoder.
+	KeyCoder KeyCoder[K]
+
+	collections map[string]*collection[K]
+}
+
+type collection[K cmp.Ordered] struct {
+	dims  int
+	graph *Graph[K]
+}
+
+// NewCollections returns an empty set of collections.
+func NewCollections[K cmp.Ordered]() *Collections[K] {
+	return &Collections[K]{collections: make(map[string]*collection[K])}
+}
+
+// Create adds an empty collection of vectors with dims dimensions.
+// g configures the collection's graph, e.g. its distance function. If g
+// is nil, NewGraph is used.
+func (c *Collections[K]) Create(name string, dims int, g *Graph[K]) (*Graph[K], error) {
+	if _, ok := c.collections[name]; ok {
+		return nil, fmt.Errorf("collection %q already exists", name)
+	}
+	if dims <= 0 {
+		return nil, fmt.Errorf("collection %q: invalid dimensions %d", name, dims)
+	}
+	if g == nil {
+		g = NewGraph[K]()
+	}
+	if g.Len() > 0 && g.Dims() != dims {
+		return nil, fmt.Errorf("collection %q: graph has %w", name, &DimensionError{Want: dims, Got: g.Dims()})
+	}
+	if c.collections == nil {
+		c.collections = make(map[string]*collection[K])
+	}
+	c.collections[name] = &collection[K]{dims: dims, graph: g}
+	return g, nil
+}
+
+// Drop removes a collection, and reports whether it existed.
+func (c *Collections[K]) Drop(name string) bool {
+	_, ok := c.collections[name]
+	delete(c.collections, name)
+	return ok
+}
+
+// Get returns the graph of a collection.
+func (c *Collections[K]) Get(name string) (*Graph[K], bool) {
+	coll, ok := c.collections[name]
+	if !ok {
+		return nil, false
+	}
+	return coll.graph, true
+}
+
+// Dims returns the dimensions of a collection, or 0 if it doesn't exist.
+func (c *Collections[K]) Dims(name string) int {
+	coll, ok := c.collections[name]
+	if !ok {
+		return 0
+	}
+	return coll.dims
+}
+
+// Names returns the names of all collections in sorted order.
+func (c *Collections[K]) Names() []string {
+	names := make([]string, 0, len(c.collections))
+	for name := range c.collections {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// lookup returns a collection, checking that vec fits into it.
+func (c *Collections[K]) lookup(name string, vec Vector) (*collection[K], error) {
+	coll, ok := c.collections[name]
+	if !ok {
+		return nil, fmt.Errorf("collection %q does not exist", name)
+	}
+	if len(vec) != coll.dims {
+		return nil, fmt.Errorf("collection %q: vector has %w", name, &DimensionError{Want: coll.dims, Got: len(vec)})
+	}
+	return coll, nil
+}
+
+// Add inserts nodes into a collection. Either all or none of the nodes
+// are added.
+func (c *Collections[K]) Add(name string, nodes ...Node[K]) error {
+	var coll *collection[K]
+	for _, node := range nodes {
+		var err error
+		coll, err = c.lookup(name, node.Value)
+		if err != nil {
+			return fmt.Errorf("add %v: %w", node.Key, err)
+		}
+	}
+	if coll != nil {
+		coll.graph.Add(nodes...)
+	}
+	return nil
+}
+
+// Search finds the k nearest neighbors of near in a collection. k must
+// be positive.
+func (c *Collections[K]) Search(name string, near Vector, k int) ([]Node[K], error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("collection %q: %w", name, ErrInvalidK)
+	}
+	coll, err := c.lookup(name, near)
+	if err != nil {
+		return nil, err
+	}
+	return coll.graph.Search(near, k), nil
+}
+
+// SearchWithOptions is like Search, but with additional options and
+// the distance and score of each result.
+func (c *Collections[K]) SearchWithOptions(name string, near Vector, k int, opts SearchOptions) ([]SearchResult[K], error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("collection %q: %w", name, ErrInvalidK)
+	}
+	coll, err := c.lookup(name, near)
+	if err != nil {
+		return nil, err
+	}
+	return coll.graph.SearchWithOptions(near, k, opts), nil
+}
+
+const collectionsEncodingVersion = 1
+
+// Export writes all collections to w. Each graph is written with
+// Graph.Export, so its distance function must be registered with
+// RegisterDistanceFunc.
+func (c *Collections[K]) Export(w io.Writer) error {
+	names := c.Names()
+	_, err := multiBinaryWrite(w, collectionsEncodingVersion, len(names))
+	if err != nil {
+		return fmt.Errorf("encode header: %w", err)
+	}
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		coll := c.collections[name]
+		buf.Reset()
+		err = coll.graph.Export(&buf)
+		if err != nil {
+			return fmt.Errorf("export collection %q: %w", name, err)
+		}
+		// Graphs are length-prefixed so that Import doesn't depend on
+		// how much of the stream Graph.Import buffers.
+		_, err = multiBinaryWrite(w, name, coll.dims, buf.Len())
+		if err != nil {
+			return fmt.Errorf("encode collection %q: %w", name, err)
+		}
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("encode collection %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Import replaces all collections with the ones read from r, as written
+// by Export.
+func (c *Collections[K]) Import(r io.Reader) error {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+
+	var version, n int
+	_, err := multiBinaryRead(r, &version, &n)
+	if err != nil {
+		return fmt.Errorf("decode header: %w", err)
+	}
+	if version != collectionsEncodingVersion {
+		return fmt.Errorf("%w: %d", ErrIncompatibleVersion, version)
+	}
+	if n < 0 {
+		return fmt.Errorf("invalid number of collections: %d", n)
+	}
+
+	collections := make(map[string]*collection[K], n)
+	for i := 0; i < n; i++ {
+		var (
+			name       string
+			dims, size int
+		)
+		_, err = multiBinaryRead(r, &name, &dims, &size)
+		if err != nil {
+			return fmt.Errorf("decode collection %d: %w", i, err)
+		}
+		if size < 0 {
+			return fmt.Errorf("collection %q: invalid size %d", name, size)
+		}
+
+		var (
+			g  = &Graph[K]{KeyCoder: c.KeyCoder}
+			lr = io.LimitReader(r, int64(size))
+		)
+		err = g.Import(bufio.NewReader(lr))
+		if err != nil {
+			return fmt.Errorf("import collection %q: %w", name, err)
+		}
+		// Skip anything Graph.Import left unread to stay aligned with
+		// the next collection.
+		_, err = io.Copy(io.Discard, lr)
+		if err != nil {
+			return fmt.Errorf("import collection %q: %w", name, err)
+		}
+		if g.Len() > 0 && g.Dims() != dims {
+			return fmt.Errorf("collection %q: graph has %w", name, &DimensionError{Want: dims, Got: g.Dims()})
+		}
+		collections[name] = &collection[K]{dims: dims, graph: g}
+	}
+	c.collections = collections
+	return nil
+}
+
+// SavedCollections is like SavedGraph for Collections.
+type SavedCollections[K cmp.Ordered] struct {
+	*Collections[K]
+	Path string
+}
+
+// LoadSavedCollections reads collections from a file. If the file does
+// not exist, it returns no collections.
+func LoadSavedCollections[K cmp.Ordered](path string) (*SavedCollections[K], error) {
+	c := NewCollections[K]()
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		err = c.Import(bufio.NewReader(f))
+		if err != nil {
+			return nil, fmt.Errorf("import: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &SavedCollections[K]{Collections: c, Path: path}, nil
+}
+
+// Save writes all collections to the file.
+func (c *SavedCollections[K]) Save() error {
+	return saveFile(c.Path, c.Export)
+}
+
+const collectionsManifestVersion = 1
+
+// manifestName is the name of the manifest in a directory written by
+// Collections.SaveDir.
+const manifestName = "manifest"
+
+// collectionsManifest lists the collections saved to a directory.
+type collectionsManifest struct {
+	// generation is incremented by every save, and names the files of
+	// the save, so that a save never overwrites the files listed by the
+	// manifest it replaces.
+	generation int
+	entries    []manifestEntry
+}
+
+type manifestEntry struct {
+	name string
+	dims int
+	file string
+}
+
+// SaveDir writes each collection to its own file in dir, in parallel,
+// followed by a manifest listing them. This is faster than Export for
+// several large collections. The manifest is replaced atomically, so a
+// crash during SaveDir leaves the previous save intact. Files of previous
+// saves are removed afterwards.
+func (c *Collections[K]) SaveDir(dir string) error {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return err
+	}
+	prev, err := readManifest(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	m := collectionsManifest{generation: prev.generation + 1}
+	for i, name := range c.Names() {
+		m.entries = append(m.entries, manifestEntry{
+			name: name,
+			dims: c.collections[name].dims,
+			file: fmt.Sprintf("%d-%d.graph", m.generation, i),
+		})
+	}
+	err = parallel(len(m.entries), func(i int) error {
+		e := m.entries[i]
+		err := saveFile(filepath.Join(dir, e.file), c.collections[e.name].graph.Export)
+		if err != nil {
+			return fmt.Errorf("save collection %q: %w", e.name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = saveFile(filepath.Join(dir, manifestName), m.write)
+	if err != nil {
+		return fmt.Errorf("save manifest: %w", err)
+	}
+
+	for _, e := range prev.entries {
+		err = os.Remove(filepath.Join(dir, e.file))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove previous save: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadDir replaces all collections with the ones written to dir by
+// SaveDir, reading them in parallel.
+func (c *Collections[K]) LoadDir(dir string) error {
+	m, err := readManifest(dir)
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	graphs := make([]*Graph[K], len(m.entries))
+	err = parallel(len(m.entries), func(i int) error {
+		e := m.entries[i]
+		f, err := os.Open(filepath.Join(dir, e.file))
+		if err != nil {
+			return fmt.Errorf("load collection %q: %w", e.name, err)
+		}
+		defer f.Close()
+
+		g := &Graph[K]{KeyCoder: c.KeyCoder}
+		err = g.Import(bufio.NewReader(f))
+		if err != nil {
+			return fmt.Errorf("import collection %q: %w", e.name, err)
+		}
+		if g.Len() > 0 && g.Dims() != e.dims {
+			return fmt.Errorf("collection %q: graph has %w", e.name, &DimensionError{Want: e.dims, Got: g.Dims()})
+		}
+		graphs[i] = g
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	collections := make(map[string]*collection[K], len(m.entries))
+	for i, e := range m.entries {
+		collections[e.name] = &collection[K]{dims: e.dims, graph: graphs[i]}
+	}
+	c.collections = collections
+	return nil
+}
+
+func (m *collectionsManifest) write(w io.Writer) error {
+	_, err := multiBinaryWrite(w, collectionsManifestVersion, m.generation, len(m.entries))
+	if err != nil {
+		return err
+	}
+	for _, e := range m.entries {
+		_, err = multiBinaryWrite(w, e.name, e.dims, e.file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readManifest reads the manifest in dir. It returns an error matching
+// os.ErrNotExist if there is none.
+func readManifest(dir string) (collectionsManifest, error) {
+	var m collectionsManifest
+	f, err := os.Open(filepath.Join(dir, manifestName))
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var version, n int
+	_, err = multiBinaryRead(r, &version, &m.generation, &n)
+	if err != nil {
+		return m, err
+	}
+	if version != collectionsManifestVersion {
+		return m, fmt.Errorf("%w: %d", ErrIncompatibleVersion, version)
+	}
+	if n < 0 {
+		return m, fmt.Errorf("invalid number of collections: %d", n)
+	}
+	m.entries = make([]manifestEntry, n)
+	for i := range m.entries {
+		e := &m.entries[i]
+		_, err = multiBinaryRead(r, &e.name, &e.dims, &e.file)
+		if err != nil {
+			return m, err
+		}
+		if e.file != filepath.Base(e.file) {
+			return m, fmt.Errorf("collection %q: invalid file name %q", e.name, e.file)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,112 @@
+package hnsw
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollections(t *testing.T) {
+	t.Parallel()
+
+	c := NewCollections[string]()
+	_, err := c.Create("text", 3, nil)
+	require.NoError(t, err)
+	_, err = c.Create("image", 2, &Graph[string]{
+		M:        8,
+		Ml:       0.25,
+		EfSearch: 20,
+		Distance: EuclideanDistance,
+	})
+	require.NoError(t, err)
+	_, err = c.Create("text", 3, nil)
+	require.Error(t, err)
+	require.Equal(t, []string{"image", "text"}, c.Names())
+
+	require.NoError(t, c.Add("text",
+		MakeNode("a", Vector{1, 0, 0}),
+		MakeNode("b", Vector{0, 1, 0}),
+	))
+	require.NoError(t, c.Add("image",
+		MakeNode("a", Vector{1, 1}),
+		MakeNode("c", Vector{5, 5}),
+	))
+
+	// Mismatched dimensions are errors, and nothing is added.
+	err = c.Add("text", MakeNode("c", Vector{0, 0, 1}), MakeNode("d", Vector{1, 1}))
+	require.ErrorContains(t, err, "2 dimensions, not 3")
+	g, _ := c.Get("text")
+	require.Equal(t, 2, g.Len())
+	_, err = c.Search("image", Vector{1, 1, 1}, 1)
+	require.Error(t, err)
+	_, err = c.Search("audio", Vector{1}, 1)
+	require.ErrorContains(t, err, "does not exist")
+
+	results, err := c.Search("image", Vector{4, 4}, 1)
+	require.NoError(t, err)
+	require.Equal(t, "c", results[0].Key)
+
+	// Collections round-trip through a single file.
+	path := t.TempDir() + "/collections"
+	saved, err := LoadSavedCollections[string](path)
+	require.NoError(t, err)
+	require.Empty(t, saved.Names())
+	saved.Collections = c
+	require.NoError(t, saved.Save())
+
+	loaded, err := LoadSavedCollections[string](path)
+	require.NoError(t, err)
+	require.Equal(t, c.Names(), loaded.Names())
+	for _, name := range c.Names() {
+		require.Equal(t, c.Dims(name), loaded.Dims(name))
+		g1, _ := c.Get(name)
+		g2, _ := loaded.Get(name)
+		requireGraphApproxEquals(t, g1, g2)
+	}
+
+	results, err = loaded.Search("text", Vector{0, 1, 0}, 1)
+	require.NoError(t, err)
+	require.Equal(t, "b", results[0].Key)
+
+	require.True(t, loaded.Drop("text"))
+	require.False(t, loaded.Drop("text"))
+	require.Equal(t, []string{"image"}, loaded.Names())
+}
+
+func TestCollections_SaveDir(t *testing.T) {
+	t.Parallel()
+
+	c := NewCollections[int]()
+	for _, name := range []string{"a/b", "c", "empty"} {
+		_, err := c.Create(name, 4, nil)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		require.NoError(t, c.Add("a/b", MakeNode(i, randFloats(4))))
+		require.NoError(t, c.Add("c", MakeNode(i, randFloats(4))))
+	}
+
+	dir := t.TempDir()
+	loaded := NewCollections[int]()
+	require.ErrorIs(t, loaded.LoadDir(dir), os.ErrNotExist)
+
+	require.NoError(t, c.SaveDir(dir))
+	require.NoError(t, loaded.LoadDir(dir))
+	require.Equal(t, c.Names(), loaded.Names())
+	for _, name := range c.Names() {
+		require.Equal(t, c.Dims(name), loaded.Dims(name))
+		g1, _ := c.Get(name)
+		g2, _ := loaded.Get(name)
+		requireGraphApproxEquals(t, g1, g2)
+	}
+
+	// Saving again replaces the files of the previous save.
+	require.True(t, c.Drop("c"))
+	require.NoError(t, c.SaveDir(dir))
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	require.NoError(t, loaded.LoadDir(dir))
+	require.Equal(t, []string{"a/b", "empty"}, loaded.Names())
+}
@@ -1,29 +1,24 @@
 package hnsw
 
 import (
-	"math"
+	"bytes"
+	"fmt"
 	"reflect"
-
-	"github.com/viterin/vek/vek32"
 )
 
 // DistanceFunc is a function that computes the distance between two vectors.
 type DistanceFunc func(a, b []float32) float32
 
 // CosineDistance computes the cosine distance between two vectors.
+// See DistanceKernel for the implementation in use.
 func CosineDistance(a, b []float32) float32 {
-	return 1 - vek32.CosineSimilarity(a, b)
+	return 1 - activeKernel.cosineSimilarity(a, b)
 }
 
 // EuclideanDistance computes the Euclidean distance between two vectors.
+// See DistanceKernel for the implementation in use.
 func EuclideanDistance(a, b []float32) float32 {
-	// TODO: can we speedup with vek?
-	var sum float32 = 0
-	for i := range a {
-		diff := a[i] - b[i]
-		sum += diff * diff
-	}
-	return float32(math.Sqrt(float64(sum)))
+	return activeKernel.euclidean(a, b)
 }
 
 var distanceFuncs = map[string]DistanceFunc{
@@ -48,3 +43,181 @@ func distanceFuncToName(fn DistanceFunc) (string, bool) {
 func RegisterDistanceFunc(name string, fn DistanceFunc) {
 	distanceFuncs[name] = fn
 }
+
+// DistanceFactory returns the distance function configured by context,
+// an opaque encoding of its parameters, e.g. the weights of the segments
+// of a multi-modal embedding, see SegmentedDistanceContext.
+type DistanceFactory func(context []byte) (DistanceFunc, error)
+
+var distanceFactories = map[string]DistanceFactory{
+	"segmented": segmentedDistance,
+}
+
+// RegisterDistanceFactory registers a factory of distance functions with
+// a name, see Graph.SetDistance.
+func RegisterDistanceFactory(name string, factory DistanceFactory) {
+	distanceFactories[name] = factory
+}
+
+// SetDistance sets Distance to the function returned by the factory
+// registered under name for context. Export writes the name and context,
+// so that Import restores the function, unlike that of parameterized
+// functions registered with RegisterDistanceFunc, which can't be told
+// apart. Without a factory under name, it looks up a function registered
+// with RegisterDistanceFunc, which requires an empty context.
+func (g *Graph[K]) SetDistance(name string, context []byte) error {
+	return g.setDistance(name, context)
+}
+
+func (g *Graph[K]) setDistance(name string, context []byte) error {
+	var fn DistanceFunc
+	if factory, ok := distanceFactories[name]; ok {
+		var err error
+		fn, err = factory(context)
+		if err != nil {
+			return fmt.Errorf("distance %q: %w", name, err)
+		}
+	} else {
+		fn, ok = distanceFuncs[name]
+		if !ok {
+			return fmt.Errorf("%w %q", ErrUnknownDistance, name)
+		}
+		if len(context) > 0 {
+			return fmt.Errorf("distance %q takes no context", name)
+		}
+	}
+	g.Distance = fn
+	g.distance.name = name
+	g.distance.context = context
+	g.distance.fn = fn
+	return nil
+}
+
+// distanceName returns the name and context that identify Distance.
+func (g *Graph[K]) distanceName() (string, []byte, bool) {
+	if g.distance.fn != nil && sameFunc(g.distance.fn, g.Distance) {
+		return g.distance.name, g.distance.context, true
+	}
+	name, ok := distanceFuncToName(g.Distance)
+	return name, nil, ok
+}
+
+func sameFunc(a, b DistanceFunc) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// Segment is a part of a concatenated vector, see
+// SegmentedDistanceContext.
+type Segment struct {
+	// Dims is the number of dimensions of the segment.
+	Dims int
+
+	// Weight is the weight of the segment's distance in the sum.
+	Weight float32
+
+	// Distance is the name of the distance function of the segment, as
+	// registered with RegisterDistanceFunc.
+	Distance string
+}
+
+// SegmentedDistanceContext returns the context of the "segmented"
+// distance function for vectors that concatenate several embeddings,
+// e.g. of text and images. The distance is the weighted sum of the
+// distances between the corresponding segments of the vectors:
+//
+//	g.SetDistance("segmented", hnsw.SegmentedDistanceContext(
+//		hnsw.Segment{Dims: 384, Weight: 0.7, Distance: "cosine"},
+//		hnsw.Segment{Dims: 512, Weight: 0.3, Distance: "cosine"},
+//	))
+func SegmentedDistanceContext(segments ...Segment) []byte {
+	var buf bytes.Buffer
+	_, _ = binaryWrite(&buf, len(segments))
+	for _, s := range segments {
+		_, _ = multiBinaryWrite(&buf, s.Dims, s.Weight, s.Distance)
+	}
+	return buf.Bytes()
+}
+
+// segmentedDistance is the DistanceFactory of the "segmented" distance.
+func segmentedDistance(context []byte) (DistanceFunc, error) {
+	type segment struct {
+		start, end int
+		weight     float32
+		distance   DistanceFunc
+	}
+	r := bytes.NewReader(context)
+	var n int
+	_, err := binaryRead(r, &n)
+	if err != nil {
+		return nil, fmt.Errorf("decoding segments: %w", err)
+	}
+	if n <= 0 || n > r.Len() {
+		return nil, fmt.Errorf("invalid number of segments: %d", n)
+	}
+	var (
+		segments = make([]segment, n)
+		dims     int
+	)
+	for i := range segments {
+		var s Segment
+		_, err = multiBinaryRead(r, &s.Dims, &s.Weight, &s.Distance)
+		if err != nil {
+			return nil, fmt.Errorf("decoding segment %d: %w", i, err)
+		}
+		if s.Dims <= 0 {
+			return nil, fmt.Errorf("segment %d has %d dimensions", i, s.Dims)
+		}
+		fn, ok := distanceFuncs[s.Distance]
+		if !ok {
+			return nil, fmt.Errorf("segment %d: %w %q", i, ErrUnknownDistance, s.Distance)
+		}
+		segments[i] = segment{start: dims, end: dims + s.Dims, weight: s.Weight, distance: fn}
+		dims += s.Dims
+	}
+	return func(a, b []float32) float32 {
+		if len(a) != dims {
+			panic(&DimensionError{Want: dims, Got: len(a)})
+		}
+		var sum float32
+		for _, s := range segments {
+			sum += s.weight * s.distance(a[s.start:s.end], b[s.start:s.end])
+		}
+		return sum
+	}, nil
+}
+
+// ScoreFunc converts a distance into a similarity score in [0, 1], where
+// higher is more similar.
+type ScoreFunc func(distance float32) float32
+
+// CosineScore maps a cosine distance in [0, 2] onto [0, 1]. Identical
+// directions score 1, orthogonal vectors 0.5, and opposite directions 0.
+func CosineScore(distance float32) float32 {
+	return clamp01(1 - distance/2)
+}
+
+// EuclideanScore returns a ScoreFunc for Euclidean distances, calibrated
+// so that a distance of scale scores 0.5. A good scale is the typical
+// distance between related vectors in the dataset.
+func EuclideanScore(scale float32) ScoreFunc {
+	return func(distance float32) float32 {
+		return clamp01(1 / (1 + distance/scale))
+	}
+}
+
+// ScoreFuncFor returns the default ScoreFunc for a distance function:
+// CosineScore for CosineDistance, and EuclideanScore(1) otherwise.
+func ScoreFuncFor(fn DistanceFunc) ScoreFunc {
+	if name, ok := distanceFuncToName(fn); ok && name == "cosine" {
+		return CosineScore
+	}
+	return EuclideanScore(1)
+}
+
+func clamp01(f float32) float32 {
+	// NaN compares false and is mapped to 0.
+	if !(f > 0) {
+		return 0
+	}
+	return min(f, 1)
+}
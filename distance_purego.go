@@ -0,0 +1,8 @@
+//go:build purego || wasm || tinygo
+
+package hnsw
+
+// platformKernels returns the kernels supported by the CPU, best first.
+func platformKernels() []kernel {
+	return nil
+}
@@ -1,6 +1,9 @@
 package hnsw
 
 import (
+	"bytes"
+	"math"
+	"slices"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -30,6 +33,140 @@ func TestCosineSimilarity(t *testing.T) {
 	require.InDelta(t, 0, CosineDistance(a, b), 0.000001)
 }
 
+// naiveKernel is a straightforward implementation of the kernels to
+// compare the optimized ones against.
+var naiveKernel = kernel{
+	name: "naive",
+	cosineSimilarity: func(a, b []float32) float32 {
+		var dot, normA, normB float64
+		for i := range a {
+			dot += float64(a[i]) * float64(b[i])
+			normA += float64(a[i]) * float64(a[i])
+			normB += float64(b[i]) * float64(b[i])
+		}
+		return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+	},
+	euclidean: func(a, b []float32) float32 {
+		var sum float64
+		for i := range a {
+			diff := float64(a[i]) - float64(b[i])
+			sum += diff * diff
+		}
+		return float32(math.Sqrt(sum))
+	},
+}
+
+func TestKernels(t *testing.T) {
+	require.Contains(t, []string{"vek", "generic"}, DistanceKernel())
+
+	for _, k := range append(platformKernels(), genericKernel) {
+		for dims := 1; dims < 100; dims += 7 {
+			a, b := randFloats(dims), randFloats(dims)
+			require.InDelta(t, naiveKernel.cosineSimilarity(a, b), k.cosineSimilarity(a, b), 1e-5, "%s, %d dims", k.name, dims)
+			require.InDelta(t, naiveKernel.euclidean(a, b), k.euclidean(a, b), 1e-4, "%s, %d dims", k.name, dims)
+
+			var dot float32
+			sum, diff, scaled := slices.Clone(a), slices.Clone(a), slices.Clone(a)
+			k.add(sum, b)
+			k.sub(diff, b)
+			k.scale(scaled, 3)
+			for i := range a {
+				dot += a[i] * b[i]
+				require.InDelta(t, a[i]+b[i], sum[i], 1e-6, "%s, %d dims", k.name, dims)
+				require.InDelta(t, a[i]-b[i], diff[i], 1e-6, "%s, %d dims", k.name, dims)
+				require.InDelta(t, a[i]*3, scaled[i], 1e-6, "%s, %d dims", k.name, dims)
+			}
+			require.InDelta(t, dot, k.dot(a, b), 1e-4, "%s, %d dims", k.name, dims)
+		}
+	}
+}
+
+func BenchmarkKernels(b *testing.B) {
+	x, y := randFloats(1536), randFloats(1536)
+	for _, k := range append(platformKernels(), genericKernel, naiveKernel) {
+		b.Run(k.name+"/cosine", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				k.cosineSimilarity(x, y)
+			}
+		})
+		b.Run(k.name+"/euclidean", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				k.euclidean(x, y)
+			}
+		})
+	}
+}
+
+func TestScoreFuncs(t *testing.T) {
+	require.Equal(t, float32(1), CosineScore(0))
+	require.Equal(t, float32(0.5), CosineScore(1))
+	require.Equal(t, float32(0), CosineScore(2))
+	require.Equal(t, float32(0), CosineScore(float32(math.NaN())))
+
+	score := EuclideanScore(2)
+	require.Equal(t, float32(1), score(0))
+	require.Equal(t, float32(0.5), score(2))
+	require.Less(t, score(100), float32(0.05))
+
+	require.Equal(t, float32(0.5), ScoreFuncFor(CosineDistance)(1))
+	require.Equal(t, float32(0.5), ScoreFuncFor(EuclideanDistance)(1))
+}
+
+func TestGraph_SetDistance(t *testing.T) {
+	t.Parallel()
+
+	context := SegmentedDistanceContext(
+		Segment{Dims: 2, Weight: 1, Distance: "euclidean"},
+		Segment{Dims: 1, Weight: 0.5, Distance: "euclidean"},
+	)
+	g := newTestGraph[int]()
+	require.NoError(t, g.SetDistance("segmented", context))
+	require.Equal(t, float32(5+0.5*2), g.Distance(Vector{0, 0, 0}, Vector{3, 4, 2}))
+	require.Panics(t, func() { g.Distance(Vector{0, 0}, Vector{3, 4}) })
+
+	nodeKeys := func(nodes []Node[int]) []int {
+		var keys []int
+		for _, n := range nodes {
+			keys = append(keys, n.Key)
+		}
+		return keys
+	}
+	g.Add(
+		MakeNode(1, Vector{0, 0, 0}),
+		MakeNode(2, Vector{1, 0, 10}),
+		MakeNode(3, Vector{2, 0, 0}),
+	)
+	require.Equal(t, []int{1, 3, 2}, nodeKeys(g.Search(Vector{0, 0, 0}, 3)))
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Export(&buf))
+	info, err := Inspect(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, "segmented", info.Distance)
+	require.Equal(t, context, info.DistanceContext)
+
+	imported := newTestGraph[int]()
+	require.NoError(t, imported.Import(&buf))
+	require.Equal(t, g.Distance(Vector{0, 0, 0}, Vector{3, 4, 2}), imported.Distance(Vector{0, 0, 0}, Vector{3, 4, 2}))
+	require.Equal(t, []int{1, 3, 2}, nodeKeys(imported.Search(Vector{0, 0, 0}, 3)))
+
+	// Replacing Distance discards the context.
+	imported.Distance = CosineDistance
+	buf.Reset()
+	require.NoError(t, imported.Export(&buf))
+	info, err = Inspect(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "cosine", info.Distance)
+	require.Nil(t, info.DistanceContext)
+
+	require.ErrorIs(t, g.SetDistance("manhattan", nil), ErrUnknownDistance)
+	require.Error(t, g.SetDistance("euclidean", context))
+	require.Error(t, g.SetDistance("segmented", nil))
+	require.ErrorIs(t, g.SetDistance("segmented", SegmentedDistanceContext(
+		Segment{Dims: 2, Weight: 1, Distance: "manhattan"},
+	)), ErrUnknownDistance)
+}
+
 func BenchmarkCosineSimilarity(b *testing.B) {
 	v1 := randFloats(1536)
 	v2 := randFloats(1536)
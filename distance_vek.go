@@ -0,0 +1,28 @@
+//go:build !purego && !wasm && !tinygo
+
+package hnsw
+
+import (
+	"github.com/viterin/vek"
+	"github.com/viterin/vek/vek32"
+)
+
+// platformKernels returns the kernels supported by the CPU, best first.
+func platformKernels() []kernel {
+	// Without acceleration, vek falls back to plain loops that are slower
+	// than the generic kernel.
+	if !vek.Info().Acceleration {
+		return nil
+	}
+	return []kernel{{
+		name:             "vek",
+		cosineSimilarity: vek32.CosineSimilarity,
+		// vek32.Distance approximates the square root, so that exact
+		// distances such as 0.5 come out slightly off.
+		euclidean: euclideanGeneric,
+		dot:       vek32.Dot,
+		add:       vek32.Add_Inplace,
+		sub:       vek32.Sub_Inplace,
+		scale:     vek32.MulNumber_Inplace,
+	}}
+}
@@ -0,0 +1,210 @@
+// Package docstore manages documents that are split into many chunk
+// vectors, as is common in retrieval-augmented generation (RAG) pipelines.
+//
+// Each chunk is stored as its own node in an underlying [hnsw.Graph], and
+// searches are grouped back into documents.
+package docstore
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/coder/hnsw"
+)
+
+// Chunk is a piece of a document along with its embedding.
+type Chunk struct {
+	// Vector is the embedding of the chunk.
+	Vector hnsw.Vector
+
+	// Start and End are the offsets of the chunk within the document.
+	// Their unit (bytes, runes, tokens) is up to the caller.
+	Start, End int
+}
+
+// ChunkMatch is a chunk that matched a search.
+type ChunkMatch struct {
+	Chunk
+
+	// Index is the position of the chunk within its document, in the order
+	// the chunks were added.
+	Index int
+
+	// Distance is the distance between the chunk and the query.
+	Distance float32
+}
+
+// DocumentMatch is a document that matched a search.
+type DocumentMatch[D cmp.Ordered] struct {
+	Doc D
+
+	// Distance is the distance of the best matching chunk.
+	Distance float32
+
+	// Chunks are the matching chunks of the document, best first.
+	Chunks []ChunkMatch
+}
+
+type chunkRef[D cmp.Ordered] struct {
+	doc   D
+	index int
+	chunk Chunk
+}
+
+// Store is a collection of chunked documents.
+// The zero value is not usable, use New instead.
+type Store[D cmp.Ordered] struct {
+	// Graph holds one node per chunk. Its parameters may be tuned
+	// before adding documents, but it should not be mutated directly.
+	Graph *hnsw.Graph[uint64]
+
+	docs   map[D][]uint64
+	chunks map[uint64]chunkRef[D]
+	nextID uint64
+}
+
+// New returns an empty store backed by a graph with default parameters.
+func New[D cmp.Ordered]() *Store[D] {
+	return &Store[D]{
+		Graph:  hnsw.NewGraph[uint64](),
+		docs:   make(map[D][]uint64),
+		chunks: make(map[uint64]chunkRef[D]),
+	}
+}
+
+// Add inserts a document made up of the given chunks.
+// If the document already exists, its chunks are replaced.
+//
+// If a chunk's vector doesn't have the dimensions of the graph, or of the
+// first chunk for an empty store, it returns an error wrapping a
+// *hnsw.DimensionError and leaves the store unchanged.
+func (s *Store[D]) Add(doc D, chunks ...Chunk) error {
+	dims := s.Graph.Dims()
+	if len(s.docs[doc]) == s.Graph.Len() {
+		// The chunks replace every node of the graph.
+		dims = 0
+	}
+	for i, chunk := range chunks {
+		if dims == 0 {
+			dims = len(chunk.Vector)
+		}
+		if len(chunk.Vector) != dims {
+			return fmt.Errorf("chunk %d: vector has %w", i, &hnsw.DimensionError{Want: dims, Got: len(chunk.Vector)})
+		}
+	}
+
+	s.Delete(doc)
+
+	ids := make([]uint64, 0, len(chunks))
+	nodes := make([]hnsw.Node[uint64], 0, len(chunks))
+	for i, chunk := range chunks {
+		id := s.nextID
+		s.nextID++
+
+		s.chunks[id] = chunkRef[D]{doc: doc, index: i, chunk: chunk}
+		ids = append(ids, id)
+		nodes = append(nodes, hnsw.MakeNode(id, chunk.Vector))
+	}
+	s.Graph.Add(nodes...)
+	s.docs[doc] = ids
+	return nil
+}
+
+// Delete removes a document and all of its chunks.
+// It returns false if the document does not exist.
+func (s *Store[D]) Delete(doc D) bool {
+	ids, ok := s.docs[doc]
+	if !ok {
+		return false
+	}
+	for _, id := range ids {
+		s.Graph.Delete(id)
+		delete(s.chunks, id)
+	}
+	delete(s.docs, doc)
+	return true
+}
+
+// Len returns the number of documents in the store.
+func (s *Store[D]) Len() int {
+	return len(s.docs)
+}
+
+// Chunks returns the chunks of a document in the order they were added.
+func (s *Store[D]) Chunks(doc D) ([]Chunk, bool) {
+	ids, ok := s.docs[doc]
+	if !ok {
+		return nil, false
+	}
+	chunks := make([]Chunk, len(ids))
+	for i, id := range ids {
+		chunks[i] = s.chunks[id].chunk
+	}
+	return chunks, true
+}
+
+// Search returns up to k documents whose chunks are nearest to the query,
+// best first. Each match includes every chunk of the document that was
+// found by the search.
+func (s *Store[D]) Search(query hnsw.Vector, k int) []DocumentMatch[D] {
+	if k <= 0 || len(s.docs) == 0 {
+		return nil
+	}
+
+	// Documents usually have several chunks near the query, so we
+	// oversample chunks and widen the search until we've seen k
+	// distinct documents or exhausted the graph.
+	n := k * 4
+	for {
+		matches := s.group(s.Graph.SearchWithOptions(query, n, hnsw.SearchOptions{}))
+		if len(matches) >= k || n >= s.Graph.Len() {
+			if len(matches) > k {
+				matches = matches[:k]
+			}
+			return matches
+		}
+		n *= 2
+	}
+}
+
+func (s *Store[D]) group(results []hnsw.SearchResult[uint64]) []DocumentMatch[D] {
+	byDoc := make(map[D]*DocumentMatch[D])
+	for _, result := range results {
+		ref, ok := s.chunks[result.Key]
+		if !ok {
+			continue
+		}
+		dist := result.Distance
+
+		match, ok := byDoc[ref.doc]
+		if !ok {
+			match = &DocumentMatch[D]{Doc: ref.doc, Distance: dist}
+			byDoc[ref.doc] = match
+		}
+		match.Distance = min(match.Distance, dist)
+		match.Chunks = append(match.Chunks, ChunkMatch{
+			Chunk:    ref.chunk,
+			Index:    ref.index,
+			Distance: dist,
+		})
+	}
+
+	out := make([]DocumentMatch[D], 0, len(byDoc))
+	for _, match := range byDoc {
+		slices.SortFunc(match.Chunks, func(a, b ChunkMatch) int {
+			if c := cmp.Compare(a.Distance, b.Distance); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Index, b.Index)
+		})
+		out = append(out, *match)
+	}
+	slices.SortFunc(out, func(a, b DocumentMatch[D]) int {
+		if c := cmp.Compare(a.Distance, b.Distance); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Doc, b.Doc)
+	})
+	return out
+}
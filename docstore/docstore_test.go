@@ -0,0 +1,89 @@
+package docstore
+
+import (
+	"testing"
+
+	"github.com/coder/hnsw"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore() *Store[string] {
+	s := New[string]()
+	s.Graph.Distance = hnsw.EuclideanDistance
+	s.Graph.M = 6
+	s.Graph.Ml = 0.5
+	return s
+}
+
+func TestStore_AddSearchDelete(t *testing.T) {
+	t.Parallel()
+
+	s := newTestStore()
+	require.NoError(t, s.Add("a",
+		Chunk{Vector: hnsw.Vector{0}, Start: 0, End: 10},
+		Chunk{Vector: hnsw.Vector{1}, Start: 10, End: 20},
+	))
+	require.NoError(t, s.Add("b",
+		Chunk{Vector: hnsw.Vector{10}, Start: 0, End: 5},
+		Chunk{Vector: hnsw.Vector{11}, Start: 5, End: 15},
+		Chunk{Vector: hnsw.Vector{12}, Start: 15, End: 30},
+	))
+	require.NoError(t, s.Add("c", Chunk{Vector: hnsw.Vector{20}, Start: 0, End: 3}))
+	require.Equal(t, 3, s.Len())
+	require.Equal(t, 6, s.Graph.Len())
+
+	matches := s.Search(hnsw.Vector{11.2}, 2)
+	require.Len(t, matches, 2)
+	require.Equal(t, "b", matches[0].Doc)
+	require.InDelta(t, 0.2, matches[0].Distance, 1e-5)
+	require.Equal(t, 1, matches[0].Chunks[0].Index)
+	require.Equal(t, 5, matches[0].Chunks[0].Start)
+	require.Equal(t, 15, matches[0].Chunks[0].End)
+	require.Equal(t, "c", matches[1].Doc)
+
+	require.True(t, s.Delete("b"))
+	require.False(t, s.Delete("b"))
+	require.Equal(t, 3, s.Graph.Len())
+
+	matches = s.Search(hnsw.Vector{11.2}, 5)
+	require.Len(t, matches, 2)
+	require.Equal(t, "c", matches[0].Doc)
+	require.Equal(t, "a", matches[1].Doc)
+	require.Len(t, matches[1].Chunks, 2)
+}
+
+func TestStore_Replace(t *testing.T) {
+	t.Parallel()
+
+	s := newTestStore()
+	require.NoError(t, s.Add("a", Chunk{Vector: hnsw.Vector{0}}, Chunk{Vector: hnsw.Vector{1}}))
+	require.NoError(t, s.Add("a", Chunk{Vector: hnsw.Vector{5}}))
+	require.Equal(t, 1, s.Graph.Len())
+
+	chunks, ok := s.Chunks("a")
+	require.True(t, ok)
+	require.Equal(t, []Chunk{{Vector: hnsw.Vector{5}}}, chunks)
+
+	// The only document may change dimensions.
+	require.NoError(t, s.Add("a", Chunk{Vector: hnsw.Vector{5, 0}}))
+	require.Equal(t, 2, s.Graph.Dims())
+}
+
+func TestStore_DimensionError(t *testing.T) {
+	t.Parallel()
+
+	s := newTestStore()
+	require.NoError(t, s.Add("a", Chunk{Vector: hnsw.Vector{0, 0}}))
+	require.NoError(t, s.Add("b", Chunk{Vector: hnsw.Vector{1, 0}}))
+
+	err := s.Add("a", Chunk{Vector: hnsw.Vector{0, 1}}, Chunk{Vector: hnsw.Vector{1}})
+	var dimErr *hnsw.DimensionError
+	require.ErrorAs(t, err, &dimErr)
+	require.Equal(t, hnsw.DimensionError{Want: 2, Got: 1}, *dimErr)
+
+	// The document was left as it was.
+	chunks, ok := s.Chunks("a")
+	require.True(t, ok)
+	require.Equal(t, []Chunk{{Vector: hnsw.Vector{0, 0}}}, chunks)
+	require.Equal(t, 2, s.Graph.Len())
+}
@@ -0,0 +1,184 @@
+package hnsw
+
+import (
+	"cmp"
+	"sync"
+	"time"
+)
+
+// DualIndex shadow-tests a graph against another, e.g. one built with a
+// new embedding model or new parameters against the one in production.
+// Searches are answered by Primary, and repeated on Shadow in the
+// background to measure how much the two agree, without adding the
+// shadow's latency to the search.
+type DualIndex[K cmp.Ordered] struct {
+	Primary, Shadow *Graph[K]
+
+	// PrimaryLock and ShadowLock, if set, are held while searching the
+	// respective graph, as for Analyzer.Lock.
+	PrimaryLock, ShadowLock sync.Locker
+
+	// MaxPending is the number of shadow searches that may run at once.
+	// Searches beyond it are not shadowed, so that a slow shadow can't
+	// pile up work. Defaults to 64.
+	MaxPending int
+
+	// Report, if set, is called with the comparison of every shadowed
+	// search, from the goroutine of the shadow search.
+	Report func(DualReport)
+
+	mu      sync.Mutex
+	pending int
+	stats   DualStats
+	wg      sync.WaitGroup
+}
+
+// DualReport compares the results of a search on the primary and shadow
+// graphs of a DualIndex.
+type DualReport struct {
+	// Overlap is the fraction of primary results that the shadow also
+	// returned, or 1 if neither returned any.
+	Overlap float64
+
+	// TopMatch reports whether both returned the same nearest node.
+	TopMatch bool
+
+	// PrimaryLatency and ShadowLatency are the durations of the searches.
+	PrimaryLatency, ShadowLatency time.Duration
+}
+
+// DualStats aggregates the reports of a DualIndex.
+type DualStats struct {
+	// Shadowed is the number of searches compared, and Skipped the
+	// number not shadowed because of MaxPending.
+	Shadowed, Skipped int
+
+	// MeanOverlap is the mean Overlap, and TopMatchRate the fraction of
+	// compared searches with a TopMatch.
+	MeanOverlap, TopMatchRate float64
+
+	// MeanPrimaryLatency and MeanShadowLatency are the mean latencies.
+	MeanPrimaryLatency, MeanShadowLatency time.Duration
+}
+
+// Search is like Graph.Search on Primary.
+func (d *DualIndex[K]) Search(near Vector, k int) []Node[K] {
+	results := d.SearchWithOptions(near, near, k, SearchOptions{})
+	out := make([]Node[K], len(results))
+	for i, result := range results {
+		out[i] = result.Node
+	}
+	return out
+}
+
+// SearchWithOptions searches Primary for near, and Shadow for shadowNear
+// in the background. The queries differ if the graphs embed with
+// different models, and are the same vector otherwise.
+func (d *DualIndex[K]) SearchWithOptions(near, shadowNear Vector, k int, opts SearchOptions) []SearchResult[K] {
+	start := time.Now()
+	unlock := lockOrNop(d.PrimaryLock)
+	results := d.Primary.SearchWithOptions(near, k, opts)
+	unlock()
+	primaryLatency := time.Since(start)
+
+	maxPending := d.MaxPending
+	if maxPending <= 0 {
+		maxPending = 64
+	}
+	d.mu.Lock()
+	if d.pending >= maxPending {
+		d.stats.Skipped++
+		d.mu.Unlock()
+		return results
+	}
+	d.pending++
+	d.mu.Unlock()
+
+	primaryKeys := make([]K, len(results))
+	for i, r := range results {
+		primaryKeys[i] = r.Key
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		start := time.Now()
+		unlock := lockOrNop(d.ShadowLock)
+		shadow := d.Shadow.SearchWithOptions(shadowNear, k, opts)
+		unlock()
+		report := compareResults(primaryKeys, shadow)
+		report.PrimaryLatency = primaryLatency
+		report.ShadowLatency = time.Since(start)
+		d.record(report)
+		if d.Report != nil {
+			d.Report(report)
+		}
+	}()
+	return results
+}
+
+func compareResults[K cmp.Ordered](primary []K, shadow []SearchResult[K]) DualReport {
+	if len(primary) == 0 && len(shadow) == 0 {
+		return DualReport{Overlap: 1, TopMatch: true}
+	}
+	var r DualReport
+	if len(primary) > 0 && len(shadow) > 0 {
+		r.TopMatch = primary[0] == shadow[0].Key
+	}
+	if len(primary) == 0 {
+		return r
+	}
+	keys := make(map[K]struct{}, len(shadow))
+	for _, s := range shadow {
+		keys[s.Key] = struct{}{}
+	}
+	var found int
+	for _, key := range primary {
+		if _, ok := keys[key]; ok {
+			found++
+		}
+	}
+	r.Overlap = float64(found) / float64(len(primary))
+	return r
+}
+
+func (d *DualIndex[K]) record(r DualReport) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending--
+
+	// Update the means incrementally.
+	s := &d.stats
+	s.Shadowed++
+	n := float64(s.Shadowed)
+	s.MeanOverlap += (r.Overlap - s.MeanOverlap) / n
+	var match float64
+	if r.TopMatch {
+		match = 1
+	}
+	s.TopMatchRate += (match - s.TopMatchRate) / n
+	s.MeanPrimaryLatency += (r.PrimaryLatency - s.MeanPrimaryLatency) / time.Duration(s.Shadowed)
+	s.MeanShadowLatency += (r.ShadowLatency - s.MeanShadowLatency) / time.Duration(s.Shadowed)
+}
+
+// Stats returns the aggregated reports of the shadow searches completed
+// so far.
+func (d *DualIndex[K]) Stats() DualStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// Wait waits for the pending shadow searches to complete.
+func (d *DualIndex[K]) Wait() {
+	d.wg.Wait()
+}
+
+// lockOrNop locks l if it is not nil, and returns the function that
+// unlocks it.
+func lockOrNop(l sync.Locker) func() {
+	if l == nil {
+		return func() {}
+	}
+	l.Lock()
+	return l.Unlock
+}
@@ -0,0 +1,62 @@
+package hnsw
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDualIndex(t *testing.T) {
+	t.Parallel()
+
+	primary, shadow := newTestGraph[int](), newTestGraph[int]()
+	for i := 0; i < 100; i++ {
+		primary.Add(MakeNode(i, Vector{float32(i)}))
+		// The shadow has every other node.
+		if i%2 == 0 {
+			shadow.Add(MakeNode(i, Vector{float32(i)}))
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		reports []DualReport
+	)
+	d := &DualIndex[int]{
+		Primary:    primary,
+		Shadow:     shadow,
+		ShadowLock: &sync.Mutex{},
+		Report: func(r DualReport) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, r)
+		},
+	}
+
+	// Node 10 is in both, but its neighbors 9 and 11 only in the primary.
+	results := d.Search(Vector{10}, 3)
+	require.Len(t, results, 3)
+	require.Equal(t, 10, results[0].Key)
+	// Node 11 is only in the primary.
+	require.Equal(t, 11, d.Search(Vector{11}, 1)[0].Key)
+	d.Wait()
+
+	require.Len(t, reports, 2)
+	stats := d.Stats()
+	require.Equal(t, 2, stats.Shadowed)
+	require.Zero(t, stats.Skipped)
+	require.InDelta(t, (1.0/3+0)/2, stats.MeanOverlap, 1e-9)
+	require.Equal(t, 0.5, stats.TopMatchRate)
+
+	// Searches beyond MaxPending aren't shadowed.
+	d.MaxPending = 1
+	d.ShadowLock.Lock()
+	d.Search(Vector{20}, 1)
+	d.Search(Vector{30}, 1)
+	d.ShadowLock.Unlock()
+	d.Wait()
+	stats = d.Stats()
+	require.Equal(t, 3, stats.Shadowed)
+	require.Equal(t, 1, stats.Skipped)
+}
@@ -0,0 +1,25 @@
+package hnsw
+
+// Embedding is a vector as used by the Embeddable interface.
+// It converts to and from Vector without copying.
+type Embedding = []float32
+
+// Embeddable is implemented by values that carry their own ID and
+// embedding. It is the item interface of the original, non-generic
+// HNSW API, kept to ease migration to Graph.
+type Embeddable interface {
+	// ID returns a unique identifier for the object.
+	ID() string
+	// Embedding returns the embedding of the object.
+	Embedding() Embedding
+}
+
+// FromEmbeddable converts items to nodes keyed by their ID, ready to be
+// added to a Graph[string]. The embeddings are not copied.
+func FromEmbeddable[E Embeddable](items ...E) []Node[string] {
+	nodes := make([]Node[string], len(items))
+	for i, item := range items {
+		nodes[i] = MakeNode(item.ID(), Vector(item.Embedding()))
+	}
+	return nodes
+}
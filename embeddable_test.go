@@ -0,0 +1,37 @@
+package hnsw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testEmbeddable struct {
+	id  string
+	vec Embedding
+}
+
+func (e testEmbeddable) ID() string           { return e.id }
+func (e testEmbeddable) Embedding() Embedding { return e.vec }
+
+func TestFromEmbeddable(t *testing.T) {
+	t.Parallel()
+
+	items := []testEmbeddable{
+		{"a", Embedding{1, 0}},
+		{"b", Embedding{0, 1}},
+	}
+
+	g := NewGraph[string]()
+	g.Add(FromEmbeddable(items...)...)
+	require.Equal(t, 2, g.Len())
+
+	results := g.Search(Vector{0.9, 0.1}, 1)
+	require.Len(t, results, 1)
+	require.Equal(t, "a", results[0].Key)
+
+	// The embedding is shared, not copied.
+	vec, ok := g.Lookup("b")
+	require.True(t, ok)
+	require.Same(t, &items[1].vec[0], &vec[0])
+}
@@ -2,17 +2,27 @@ package hnsw
 
 import (
 	"bufio"
+	"bytes"
 	"cmp"
+	"context"
+	"encoding"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"hash/crc64"
 	"io"
+	"log/slog"
+	"math"
 	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"sync"
 
 	"github.com/google/renameio"
 )
 
-// errorEncoder is a helper type to encode multiple values
-
 var byteOrder = binary.LittleEndian
 
 func binaryRead(r io.Reader, data interface{}) (int, error) {
@@ -54,6 +64,16 @@ func binaryRead(r io.Reader, data interface{}) (int, error) {
 		*v = make([]float32, ln)
 		return binary.Size(*v), binary.Read(r, byteOrder, *v)
 
+	case *[]float64:
+		var ln int
+		_, err := binaryRead(r, &ln)
+		if err != nil {
+			return 0, err
+		}
+
+		*v = make([]float64, ln)
+		return binary.Size(*v), binary.Read(r, byteOrder, *v)
+
 	case io.ReaderFrom:
 		n, err := v.ReadFrom(r)
 		return int(n), err
@@ -91,6 +111,13 @@ func binaryWrite(w io.Writer, data any) (int, error) {
 		}
 		return n + binary.Size(v), binary.Write(w, byteOrder, v)
 
+	case []float64:
+		n, err := binaryWrite(w, len(v))
+		if err != nil {
+			return n, err
+		}
+		return n + binary.Size(v), binary.Write(w, byteOrder, v)
+
 	default:
 		sz := binary.Size(data)
 		err := binary.Write(w, byteOrder, data)
@@ -125,15 +152,197 @@ func multiBinaryRead(r io.Reader, data ...any) (int, error) {
 	return read, nil
 }
 
-const encodingVersion = 1
+// KeyCoder encodes and decodes graph keys for Export, Import and the
+// other serialization methods of Graph.
+type KeyCoder[K cmp.Ordered] interface {
+	EncodeKey(w io.Writer, key K) error
+	// DecodeKey reads a key written by EncodeKey. r also implements
+	// io.ByteReader.
+	DecodeKey(r io.Reader) (K, error)
+}
 
-// Export writes the graph to a writer.
-//
-// T must implement io.WriterTo.
+// DefaultKeyCoder is the KeyCoder used when Graph.KeyCoder is nil.
+// It supports every type in cmp.Ordered, including named types such as
+// "type UserID string", which it encodes like their underlying type.
+type DefaultKeyCoder[K cmp.Ordered] struct{}
+
+// basicKeyTypes maps the kinds in cmp.Ordered to the type they are
+// encoded as. It is only used for named types, as the others are
+// matched by type switches.
+var basicKeyTypes = map[reflect.Kind]reflect.Type{
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint64(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Uintptr: reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// EncodeKey implements KeyCoder.
+func (DefaultKeyCoder[K]) EncodeKey(w io.Writer, key K) error {
+	var err error
+	switch k := any(key).(type) {
+	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64,
+		float32, float64, string:
+		_, err = binaryWrite(w, k)
+	case uint:
+		_, err = binaryWrite(w, uint64(k))
+	case uintptr:
+		_, err = binaryWrite(w, uint64(k))
+	default:
+		// Named types are encoded like their underlying type.
+		v := reflect.ValueOf(key)
+		_, err = binaryWrite(w, v.Convert(basicKeyTypes[v.Kind()]).Interface())
+	}
+	return err
+}
+
+// DecodeKey implements KeyCoder.
+func (DefaultKeyCoder[K]) DecodeKey(r io.Reader) (K, error) {
+	var (
+		key K
+		err error
+	)
+	switch k := any(&key).(type) {
+	case *int, *int8, *int16, *int32, *int64, *uint8, *uint16, *uint32, *uint64,
+		*float32, *float64, *string:
+		_, err = binaryRead(r, k)
+	case *uint:
+		var u uint64
+		_, err = binaryRead(r, &u)
+		*k = uint(u)
+	case *uintptr:
+		var u uint64
+		_, err = binaryRead(r, &u)
+		*k = uintptr(u)
+	default:
+		t := reflect.TypeOf(key)
+		v := reflect.New(basicKeyTypes[t.Kind()])
+		_, err = binaryRead(r, v.Interface())
+		if err != nil {
+			return key, err
+		}
+		key = v.Elem().Convert(t).Interface().(K)
+	}
+	return key, err
+}
+
+// keyCoder returns the KeyCoder of the graph.
+func (h *Graph[K]) keyCoder() KeyCoder[K] {
+	if h.KeyCoder != nil {
+		return h.KeyCoder
+	}
+	return DefaultKeyCoder[K]{}
+}
+
+// encodedKey adapts a KeyCoder to io.WriterTo for binaryWrite.
+type encodedKey[K cmp.Ordered] struct {
+	coder KeyCoder[K]
+	key   K
+}
+
+func (k encodedKey[K]) WriteTo(w io.Writer) (int64, error) {
+	return 0, k.coder.EncodeKey(w, k.key)
+}
+
+// decodedKey adapts a KeyCoder to io.ReaderFrom for binaryRead.
+type decodedKey[K cmp.Ordered] struct {
+	coder KeyCoder[K]
+	key   *K
+}
+
+func (k decodedKey[K]) ReadFrom(r io.Reader) (int64, error) {
+	key, err := k.coder.DecodeKey(r)
+	*k.key = key
+	return 0, err
+}
+
+// encodeKey returns key in a form accepted by binaryWrite.
+func (h *Graph[K]) encodeKey(key K) io.WriterTo {
+	return encodedKey[K]{coder: h.keyCoder(), key: key}
+}
+
+// decodeKey returns key in a form accepted by binaryRead.
+func (h *Graph[K]) decodeKey(key *K) io.ReaderFrom {
+	return decodedKey[K]{coder: h.keyCoder(), key: key}
+}
+
+// encodingVersion 2 refers to nodes by their internal ID through a key
+// table. Version 1 referred to them by key, and is still imported.
+const encodingVersion = 2
+
+// exportChunkSize is the maximum number of nodes in an exported chunk.
+const exportChunkSize = 1024
+
+// maxChunkPrealloc is the largest chunk buffer Import allocates before
+// reading the chunk.
+const maxChunkPrealloc = 1 << 24
+
+// maxKeyPrealloc is the largest key table Import allocates before
+// reading the keys.
+const maxKeyPrealloc = 1 << 20
+
+// ExportMode selects how much of the graph structure Export writes.
+type ExportMode int
+
+const (
+	// ExportFull writes every layer. It is the fastest to import.
+	ExportFull ExportMode = iota
+
+	// ExportBaseLayer writes only the base layer. Import rebuilds the
+	// upper layers, which are a small fraction of the graph, from it,
+	// keeping the level of each node.
+	ExportBaseLayer
+
+	// ExportVectors writes only keys, levels and vectors, without any
+	// edges. Import rebuilds every layer, keeping the level of each node,
+	// which produces the smallest files and the slowest imports.
+	ExportVectors
+)
+
+// ExportOptions configures an export.
+// The zero value is equivalent to calling Export.
+type ExportOptions struct {
+	Mode ExportMode
+
+	// Canonical writes keys, nodes and neighbors sorted by key, rather
+	// than in the random order of map iteration, so that exporting the
+	// same graph twice yields the same bytes, e.g. for content-addressed
+	// storage or diffing snapshots. Since nodes are written by ID, graphs
+	// with the same nodes and edges only export identically if they also
+	// assigned the same IDs. Sorting makes exports slower.
+	Canonical bool
+}
+
+// Export writes the graph to a writer. Keys are written with the graph's
+// KeyCoder.
 func (h *Graph[K]) Export(w io.Writer) error {
-	distFuncName, ok := distanceFuncToName(h.Distance)
+	return h.ExportWithOptions(w, ExportOptions{})
+}
+
+// ExportWithOptions is like Export, but with additional options.
+func (h *Graph[K]) ExportWithOptions(w io.Writer, opts ExportOptions) error {
+	end := h.startSpan(context.Background(), "Export")
+	err := h.exportWithOptions(w, opts)
+	end(err, slog.Int("nodes", h.Len()), slog.Int("mode", int(opts.Mode)))
+	return err
+}
+
+func (h *Graph[K]) exportWithOptions(w io.Writer, opts ExportOptions) error {
+	distFuncName, distContext, ok := h.distanceName()
 	if !ok {
-		return fmt.Errorf("distance function %v must be registered with RegisterDistanceFunc", h.Distance)
+		return fmt.Errorf("%w: %v must be registered with RegisterDistanceFunc", ErrUnknownDistance, h.Distance)
+	}
+	if opts.Mode < ExportFull || opts.Mode > ExportVectors {
+		return fmt.Errorf("unknown export mode %d", opts.Mode)
 	}
 	_, err := multiBinaryWrite(
 		w,
@@ -142,64 +351,392 @@ func (h *Graph[K]) Export(w io.Writer) error {
 		h.Ml,
 		h.EfSearch,
 		distFuncName,
+		string(distContext),
+		int(opts.Mode),
 	)
 	if err != nil {
 		return fmt.Errorf("encode parameters: %w", err)
 	}
-	_, err = binaryWrite(w, len(h.layers))
+
+	// Statistics of the graph, read by Inspect. Layer sizes are those of
+	// the graph rather than of the export, so that they are the same in
+	// every mode.
+	_, err = multiBinaryWrite(w, h.Len(), h.Dims(), len(h.layers))
 	if err != nil {
-		return fmt.Errorf("encode number of layers: %w", err)
+		return fmt.Errorf("encode statistics: %w", err)
 	}
 	for _, layer := range h.layers {
-		_, err = binaryWrite(w, len(layer.nodes))
+		_, err = binaryWrite(w, layer.size())
 		if err != nil {
-			return fmt.Errorf("encode number of nodes: %w", err)
+			return fmt.Errorf("encode statistics: %w", err)
+		}
+	}
+
+	// The key table maps internal IDs to keys. It is written once so
+	// that layers only need to refer to nodes by ID. Levels let Import
+	// rebuild the same upper layers in modes that don't write them, and
+	// add sequence numbers let ApplyTombstones keep nodes added later.
+	// Free IDs after the last one in use are left out, as Import drops
+	// them anyway.
+	nIDs := len(h.keys)
+	for nIDs > 0 {
+		if id, ok := h.ids[h.keys[nIDs-1]]; ok && id == uint32(nIDs-1) {
+			break
 		}
+		nIDs--
+	}
+	_, err = multiBinaryWrite(w, nIDs, len(h.ids))
+	if err != nil {
+		return fmt.Errorf("encode key table size: %w", err)
+	}
+	keys := make([]K, 0, len(h.ids))
+	for key := range h.ids {
+		keys = append(keys, key)
+	}
+	if opts.Canonical {
+		slices.Sort(keys)
+	}
+	for _, key := range keys {
+		id := h.ids[key]
+		var added uint64
+		if int(id) < len(h.added) {
+			added = h.added[id]
+		}
+		_, err = multiBinaryWrite(w, int(id), h.encodeKey(key), h.level(id), added)
+		if err != nil {
+			return fmt.Errorf("encode key %v: %w", key, err)
+		}
+	}
+
+	// Tombstones let consumers merging snapshots tell deleted keys
+	// apart from keys that were never added.
+	_, err = multiBinaryWrite(w, h.seq, len(h.tombstones))
+	if err != nil {
+		return fmt.Errorf("encode tombstones: %w", err)
+	}
+	keys = keys[:0]
+	for key := range h.tombstones {
+		keys = append(keys, key)
+	}
+	if opts.Canonical {
+		slices.Sort(keys)
+	}
+	for _, key := range keys {
+		_, err = multiBinaryWrite(w, h.encodeKey(key), h.tombstones[key])
+		if err != nil {
+			return fmt.Errorf("encode tombstone %v: %w", key, err)
+		}
+	}
+	_, err = binaryWrite(w, h.lastKey)
+	if err != nil {
+		return fmt.Errorf("encode last key: %w", err)
+	}
+
+	layers := h.layers
+	if opts.Mode != ExportFull && len(layers) > 1 {
+		layers = layers[:1]
+	}
+	_, err = binaryWrite(w, len(layers))
+	if err != nil {
+		return fmt.Errorf("encode number of layers: %w", err)
+	}
+	// Layers are split into length-prefixed chunks of nodes so that
+	// Import can decode them in parallel.
+	var (
+		chunk  bytes.Buffer
+		nChunk int
+	)
+	flush := func() error {
+		_, err := multiBinaryWrite(w, nChunk, chunk.Len())
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(chunk.Bytes())
+		chunk.Reset()
+		nChunk = 0
+		return err
+	}
+	for i, layer := range layers {
+		nChunks := (len(layer.nodes) + exportChunkSize - 1) / exportChunkSize
+		_, err = binaryWrite(w, nChunks)
+		if err != nil {
+			return fmt.Errorf("encode number of chunks: %w", err)
+		}
+		nodes := make([]*layerNode, 0, len(layer.nodes))
 		for _, node := range layer.nodes {
-			_, err = multiBinaryWrite(w, node.Key, node.Value, len(node.neighbors))
+			nodes = append(nodes, node)
+		}
+		if opts.Canonical {
+			slices.SortFunc(nodes, h.compareKeys)
+		}
+		for _, node := range nodes {
+			neighbors := node.neighbors
+			if opts.Mode == ExportVectors {
+				neighbors = nil
+			} else if opts.Canonical {
+				neighbors = slices.Clone(neighbors)
+				slices.SortFunc(neighbors, h.compareKeys)
+			}
+			// Upper layers share the vectors of the base layer.
+			if i == 0 {
+				_, err = multiBinaryWrite(&chunk, int(node.id), node.Value, len(neighbors))
+			} else {
+				_, err = multiBinaryWrite(&chunk, int(node.id), len(neighbors))
+			}
 			if err != nil {
 				return fmt.Errorf("encode node data: %w", err)
 			}
 
-			for neighbor := range node.neighbors {
-				_, err = binaryWrite(w, neighbor)
+			for _, neighbor := range neighbors {
+				_, err = binaryWrite(&chunk, int(neighbor.id))
 				if err != nil {
-					return fmt.Errorf("encode neighbor %v: %w", neighbor, err)
+					return fmt.Errorf("encode neighbor %v: %w", neighbor.id, err)
+				}
+			}
+
+			nChunk++
+			if nChunk == exportChunkSize {
+				if err := flush(); err != nil {
+					return fmt.Errorf("encode chunk: %w", err)
 				}
 			}
 		}
+		if nChunk > 0 {
+			if err := flush(); err != nil {
+				return fmt.Errorf("encode chunk: %w", err)
+			}
+		}
 	}
 
 	return nil
 }
 
-// Import reads the graph from a reader.
-// T must implement io.ReaderFrom.
-// The imported graph does not have to match the exported graph's parameters (except for
-// dimensionality). The graph will converge onto the new parameters.
-func (h *Graph[K]) Import(r io.Reader) error {
-	var (
-		version int
-		dist    string
+// compareKeys orders nodes by key.
+func (h *Graph[K]) compareKeys(a, b *layerNode) int {
+	return cmp.Compare(h.keys[a.id], h.keys[b.id])
+}
+
+// ExportInfo describes an exported graph, see Inspect.
+type ExportInfo struct {
+	// Version is the version of the encoding.
+	Version int
+
+	// M, Ml, EfSearch and Distance are the parameters of the graph.
+	M        int
+	Ml       float64
+	EfSearch int
+	Distance string
+
+	// DistanceContext is the context of the distance function, see
+	// Graph.SetDistance.
+	DistanceContext []byte
+
+	// Mode is the mode the graph was exported with.
+	Mode ExportMode
+
+	// Nodes, Dims and Layers are the number of nodes, the number of
+	// dimensions and the number of nodes in each layer of the graph.
+	// They are zero for encoding version 1.
+	Nodes  int
+	Dims   int
+	Layers []int
+}
+
+// Inspect reads the header of a graph written by Export, without decoding
+// the rest of it.
+func Inspect(r io.Reader) (ExportInfo, error) {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+	return readExportHeader(r)
+}
+
+// readExportHeader reads the parameters and statistics preceding the
+// key table of an export.
+func readExportHeader(r io.Reader) (ExportInfo, error) {
+	var info ExportInfo
+	_, err := multiBinaryRead(r, &info.Version, &info.M, &info.Ml, &info.EfSearch,
+		&info.Distance,
 	)
-	_, err := multiBinaryRead(r, &version, &h.M, &h.Ml, &h.EfSearch,
-		&dist,
+	if err != nil {
+		return info, err
+	}
+	switch info.Version {
+	case 1:
+		// Version 1 has no further header, and is always full.
+		return info, nil
+	case encodingVersion:
+	default:
+		return info, fmt.Errorf("%w: %d", ErrIncompatibleVersion, info.Version)
+	}
+
+	var (
+		context string
+		m       int
 	)
+	_, err = multiBinaryRead(r, &context, &m)
+	if err != nil {
+		return info, fmt.Errorf("decoding distance context and export mode: %w", err)
+	}
+	if context != "" {
+		info.DistanceContext = []byte(context)
+	}
+	info.Mode = ExportMode(m)
+	if info.Mode < ExportFull || info.Mode > ExportVectors {
+		return info, fmt.Errorf("unknown export mode %d", info.Mode)
+	}
+
+	var nLayers int
+	_, err = multiBinaryRead(r, &info.Nodes, &info.Dims, &nLayers)
+	if err != nil {
+		return info, fmt.Errorf("decoding statistics: %w", err)
+	}
+	// Layers shrink geometrically, so real graphs have far fewer than
+	// 64 of them.
+	if nLayers < 0 || nLayers > 64 {
+		return info, fmt.Errorf("invalid number of layers: %d", nLayers)
+	}
+	info.Layers = make([]int, nLayers)
+	for i := range info.Layers {
+		_, err = binaryRead(r, &info.Layers[i])
+		if err != nil {
+			return info, fmt.Errorf("decoding statistics: %w", err)
+		}
+	}
+	return info, nil
+}
+
+// Import reads the graph from a reader, decoding keys with the graph's
+// KeyCoder. The imported graph does not have to match the exported
+// graph's parameters (except for dimensionality). The graph will converge
+// onto the new parameters.
+//
+// Tombstones of the exported graph are restored, so that they can be
+// applied to other graphs with ApplyTombstones when merging snapshots.
+func (h *Graph[K]) Import(r io.Reader) error {
+	end := h.startSpan(context.Background(), "Import")
+	err := h.importGraph(r)
+	end(err, slog.Int("nodes", h.Len()))
+	return err
+}
+
+func (h *Graph[K]) importGraph(r io.Reader) error {
+	info, err := readExportHeader(r)
 	if err != nil {
 		return err
 	}
+	h.M, h.Ml, h.EfSearch = info.M, info.Ml, info.EfSearch
 
-	var ok bool
-	h.Distance, ok = distanceFuncs[dist]
-	if !ok {
-		return fmt.Errorf("unknown distance function %q", dist)
+	err = h.setDistance(info.Distance, info.DistanceContext)
+	if err != nil {
+		return err
 	}
 	if h.Rng == nil {
 		h.Rng = defaultRand()
 	}
+	mode := info.Mode
+
+	// Changes tracked for SavedGraph and QueryCache don't survive
+	// replacing the graph.
+	h.dirty = nil
+	h.changes.reset()
+	h.pending = nil
+
+	h.timestamps = nil
+	h.boosts = nil
+	h.fields = nil
+	h.added = nil
+	h.sortedKeys = nil
+	h.tombstones = make(map[K]uint64)
+	h.seq = 0
+	h.lastKey = 0
+	if info.Version == 1 {
+		return h.importV1(r)
+	}
+
+	var nIDs, nKeys int
+	_, err = multiBinaryRead(r, &nIDs, &nKeys)
+	if err != nil {
+		return fmt.Errorf("decoding key table size: %w", err)
+	}
+	if nKeys < 0 || nKeys > nIDs || nIDs > math.MaxUint32+1 {
+		return fmt.Errorf("invalid key table size: %d keys for %d IDs", nKeys, nIDs)
+	}
+
+	// Only preallocate up to maxKeyPrealloc IDs so that a corrupt size
+	// fails on EOF rather than exhausting memory. The tables grow to the
+	// largest ID read, and free IDs after it are left for allocID to
+	// append again.
+	var (
+		used = make([]bool, 0, min(nIDs, maxKeyPrealloc))
+		// levels holds the level of each ID, if exported.
+		levels []int
+	)
+	h.keys = make([]K, 0, cap(used))
+	h.ids = make(map[K]uint32, min(nKeys, maxKeyPrealloc))
+	for i := 0; i < nKeys; i++ {
+		var (
+			id, level int
+			key       K
+			added     uint64
+		)
+		_, err = multiBinaryRead(r, &id, h.decodeKey(&key), &level, &added)
+		if err != nil {
+			return fmt.Errorf("decoding key %d: %w", i, err)
+		}
+		if id < 0 || id >= nIDs || id < len(used) && used[id] {
+			return fmt.Errorf("invalid ID %d for key %v", id, key)
+		}
+		if level < 0 || level >= 64 {
+			return fmt.Errorf("invalid level %d for key %v", level, key)
+		}
+		if id >= len(used) {
+			n := id + 1 - len(used)
+			used = append(used, make([]bool, n)...)
+			h.keys = append(h.keys, make([]K, n)...)
+			if mode != ExportFull {
+				levels = append(levels, make([]int, n)...)
+			}
+		}
+		used[id] = true
+		h.keys[id] = key
+		h.ids[key] = uint32(id)
+		if added != 0 {
+			h.setAdded(uint32(id), added)
+		}
+		if levels != nil {
+			levels[id] = level
+		}
+	}
+	h.free = h.free[:0]
+	for id := len(used) - 1; id >= 0; id-- {
+		if !used[id] {
+			h.free = append(h.free, uint32(id))
+		}
+	}
 
-	if version != encodingVersion {
-		return fmt.Errorf("incompatible encoding version: %d", version)
+	var nTombstones int
+	_, err = multiBinaryRead(r, &h.seq, &nTombstones)
+	if err != nil {
+		return fmt.Errorf("decoding tombstones: %w", err)
+	}
+	if nTombstones < 0 {
+		return fmt.Errorf("invalid number of tombstones: %d", nTombstones)
+	}
+	for i := 0; i < nTombstones; i++ {
+		var (
+			key K
+			seq uint64
+		)
+		_, err = multiBinaryRead(r, h.decodeKey(&key), &seq)
+		if err != nil {
+			return fmt.Errorf("decoding tombstone %d: %w", i, err)
+		}
+		h.tombstones[key] = seq
+	}
+	_, err = binaryRead(r, &h.lastKey)
+	if err != nil {
+		return fmt.Errorf("decoding last key: %w", err)
 	}
 
 	var nLayers int
@@ -207,69 +744,415 @@ func (h *Graph[K]) Import(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if nLayers < 0 {
+		return fmt.Errorf("invalid number of layers: %d", nLayers)
+	}
+
+	validID := func(id int) bool {
+		return id >= 0 && id < len(used) && used[id]
+	}
+	layerChunks, err := decodeChunkedLayers(r, nLayers, validID)
+	if err != nil {
+		return err
+	}
 
-	h.layers = make([]*layer[K], nLayers)
+	h.layers = make([]*layer, nLayers)
+	for i, chunks := range layerChunks {
+		h.layers[i], err = linkLayer(chunks)
+		if err != nil {
+			return fmt.Errorf("layer %d: %w", i, err)
+		}
+		if i == 0 {
+			continue
+		}
+		// Upper layers share the vectors of the base layer.
+		for id, node := range h.layers[i].nodes {
+			base, ok := h.layers[0].nodes[id]
+			if !ok {
+				return fmt.Errorf("layer %d: node %d is missing from layer 0", i, id)
+			}
+			node.Value = base.Value
+		}
+	}
+
+	if mode != ExportFull {
+		h.rebuild(mode, levels)
+	}
+	return nil
+}
+
+// importV1 reads the layers of an encoding version 1 graph, which refers
+// to nodes by key and writes every node's vector in every layer. Keys are
+// assigned IDs in order. Version 1 graphs may hold one-way edges, so the
+// layers are rebuilt from the vectors, keeping the level of each node.
+func (h *Graph[K]) importV1(r io.Reader) error {
+	var nLayers int
+	_, err := binaryRead(r, &nLayers)
+	if err != nil {
+		return err
+	}
+	if nLayers < 0 {
+		return fmt.Errorf("invalid number of layers: %d", nLayers)
+	}
+
+	// Keys were written like DefaultKeyCoder writes them.
+	var coder DefaultKeyCoder[K]
+	vecs := make(map[K]Vector)
+	levels := make(map[K]int)
 	for i := 0; i < nLayers; i++ {
 		var nNodes int
 		_, err = binaryRead(r, &nNodes)
 		if err != nil {
-			return err
+			return fmt.Errorf("decoding layer %d: %w", i, err)
+		}
+		if nNodes < 0 {
+			return fmt.Errorf("decoding layer %d: invalid number of nodes %d", i, nNodes)
 		}
-
-		nodes := make(map[K]*layerNode[K], nNodes)
 		for j := 0; j < nNodes; j++ {
-			var key K
-			var vec Vector
-			var nNeighbors int
-			_, err = multiBinaryRead(r, &key, &vec, &nNeighbors)
+			var (
+				key        K
+				vec        Vector
+				nNeighbors int
+			)
+			_, err = multiBinaryRead(r, decodedKey[K]{coder: coder, key: &key}, &vec, &nNeighbors)
 			if err != nil {
-				return fmt.Errorf("decoding node %d: %w", j, err)
+				return fmt.Errorf("decoding layer %d node %d: %w", i, j, err)
+			}
+			if nNeighbors < 0 {
+				return fmt.Errorf("decoding layer %d node %d: invalid number of neighbors %d", i, j, nNeighbors)
 			}
-
-			neighbors := make([]K, nNeighbors)
 			for k := 0; k < nNeighbors; k++ {
-				var neighbor K
-				_, err = binaryRead(r, &neighbor)
+				_, err = coder.DecodeKey(r)
 				if err != nil {
-					return fmt.Errorf("decoding neighbor %d for node %d: %w", k, j, err)
+					return fmt.Errorf("decoding neighbor %d for layer %d node %d: %w", k, i, j, err)
 				}
-				neighbors[k] = neighbor
 			}
+			if i == 0 {
+				vecs[key] = vec
+			} else if _, ok := vecs[key]; !ok {
+				return fmt.Errorf("layer %d: node %v is missing from layer 0", i, key)
+			}
+			levels[key] = i
+		}
+	}
+
+	keys := make([]K, 0, len(vecs))
+	for key := range vecs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	h.keys = nil
+	h.ids = make(map[K]uint32, len(keys))
+	h.free = h.free[:0]
+	h.layers = nil
+	if len(keys) == 0 {
+		return nil
+	}
+	base := &layer{nodes: make(map[uint32]*layerNode, len(keys))}
+	idLevels := make([]int, len(keys))
+	for _, key := range keys {
+		id := h.allocID(key)
+		base.nodes[id] = &layerNode{id: id, Value: vecs[key]}
+		idLevels[id] = levels[key]
+	}
+	h.layers = []*layer{base}
+	h.rebuild(ExportVectors, idLevels)
+	return nil
+}
+
+// decodedNode is a node read by Import whose neighbors are not yet
+// resolved.
+type decodedNode struct {
+	node      *layerNode
+	neighbors []uint32
+}
 
-			node := &layerNode[K]{
-				Node: Node[K]{
-					Key:   key,
-					Value: vec,
-				},
-				neighbors: make(map[K]*layerNode[K]),
+// decodeNodes reads n nodes from r. validID reports whether an ID is
+// in the key table. Vectors are only read if withVectors is set.
+func decodeNodes(r io.Reader, n int, validID func(id int) bool, withVectors bool) ([]decodedNode, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid number of nodes: %d", n)
+	}
+	nodes := make([]decodedNode, 0, min(n, exportChunkSize))
+	for j := 0; j < n; j++ {
+		var id int
+		var vec Vector
+		var nNeighbors int
+		var err error
+		if withVectors {
+			_, err = multiBinaryRead(r, &id, &vec, &nNeighbors)
+		} else {
+			_, err = multiBinaryRead(r, &id, &nNeighbors)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding node %d: %w", j, err)
+		}
+		if !validID(id) {
+			return nil, fmt.Errorf("decoding node %d: unknown ID %d", j, id)
+		}
+		if nNeighbors < 0 {
+			return nil, fmt.Errorf("decoding node %d: invalid number of neighbors %d", j, nNeighbors)
+		}
+
+		neighbors := make([]uint32, nNeighbors)
+		for k := 0; k < nNeighbors; k++ {
+			var neighbor int
+			_, err = binaryRead(r, &neighbor)
+			if err != nil {
+				return nil, fmt.Errorf("decoding neighbor %d for node %d: %w", k, j, err)
 			}
+			neighbors[k] = uint32(neighbor)
+		}
 
-			nodes[key] = node
-			for _, neighbor := range neighbors {
-				node.neighbors[neighbor] = nil
+		nodes = append(nodes, decodedNode{
+			node: &layerNode{
+				id:    uint32(id),
+				Value: vec,
+			},
+			neighbors: neighbors,
+		})
+	}
+	return nodes, nil
+}
+
+// decodeChunkedLayers reads nLayers layers of length-prefixed chunks,
+// and decodes the chunks in parallel. The result is indexed by layer,
+// then chunk. Only the base layer has vectors.
+func decodeChunkedLayers(r io.Reader, nLayers int, validID func(id int) bool) ([][][]decodedNode, error) {
+	type chunk struct {
+		layer, index int
+		n            int
+		data         []byte
+	}
+	var (
+		chunks []chunk
+		out    = make([][][]decodedNode, nLayers)
+	)
+	// Reading is sequential, only decoding is parallel.
+	for i := range out {
+		var nChunks int
+		_, err := binaryRead(r, &nChunks)
+		if err != nil {
+			return nil, fmt.Errorf("decoding layer %d: %w", i, err)
+		}
+		if nChunks < 0 {
+			return nil, fmt.Errorf("decoding layer %d: invalid number of chunks %d", i, nChunks)
+		}
+		out[i] = make([][]decodedNode, nChunks)
+		for j := 0; j < nChunks; j++ {
+			var n, size int
+			_, err = multiBinaryRead(r, &n, &size)
+			if err != nil {
+				return nil, fmt.Errorf("decoding layer %d chunk %d: %w", i, j, err)
+			}
+			if size < 0 {
+				return nil, fmt.Errorf("decoding layer %d chunk %d: invalid size %d", i, j, size)
+			}
+			// Only preallocate up to maxChunkPrealloc so that a corrupt
+			// size fails on EOF rather than exhausting memory.
+			data := make([]byte, min(size, maxChunkPrealloc))
+			_, err = io.ReadFull(r, data)
+			if err == nil && size > len(data) {
+				buf := bytes.NewBuffer(data)
+				_, err = io.CopyN(buf, r, int64(size-len(data)))
+				data = buf.Bytes()
 			}
+			if err != nil {
+				return nil, fmt.Errorf("decoding layer %d chunk %d: %w", i, j, err)
+			}
+			chunks = append(chunks, chunk{layer: i, index: j, n: n, data: data})
 		}
-		// Fill in neighbor pointers
-		for _, node := range nodes {
-			for key := range node.neighbors {
-				node.neighbors[key] = nodes[key]
+	}
+
+	err := parallel(len(chunks), func(k int) error {
+		c := chunks[k]
+		rd := bytes.NewReader(c.data)
+		nodes, err := decodeNodes(rd, c.n, validID, c.layer == 0)
+		if err == nil && rd.Len() > 0 {
+			err = fmt.Errorf("%d trailing bytes", rd.Len())
+		}
+		if err != nil {
+			return fmt.Errorf("decoding layer %d chunk %d: %w", c.layer, c.index, err)
+		}
+		out[c.layer][c.index] = nodes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// linkLayer builds a layer from its decoded chunks, resolving neighbor
+// IDs to nodes in parallel.
+func linkLayer(chunks [][]decodedNode) (*layer, error) {
+	var n int
+	for _, chunk := range chunks {
+		n += len(chunk)
+	}
+	nodes := make(map[uint32]*layerNode, n)
+	for _, chunk := range chunks {
+		for _, d := range chunk {
+			if _, ok := nodes[d.node.id]; ok {
+				return nil, fmt.Errorf("duplicate node %d", d.node.id)
 			}
+			nodes[d.node.id] = d.node
 		}
-		h.layers[i] = &layer[K]{nodes: nodes}
 	}
 
-	return nil
+	// Fill in neighbor pointers. The map is only read from here on.
+	err := parallel(len(chunks), func(i int) error {
+		for _, d := range chunks[i] {
+			node := d.node
+			node.neighbors = make([]*layerNode, 0, len(d.neighbors))
+			for _, neighborID := range d.neighbors {
+				neighbor, ok := nodes[neighborID]
+				if !ok {
+					return fmt.Errorf("node %d has unknown neighbor %d", node.id, neighborID)
+				}
+				node.neighbors = append(node.neighbors, neighbor)
+			}
+			slices.SortFunc(node.neighbors, func(a, b *layerNode) int {
+				return cmp.Compare(a.id, b.id)
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &layer{nodes: nodes}, nil
+}
+
+// parallel calls fn for 0 <= i < n on up to GOMAXPROCS goroutines,
+// and returns the errors joined.
+func parallel(n int, fn func(i int) error) error {
+	var (
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, runtime.GOMAXPROCS(0))
+		errs = make([]error, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// rebuild reconstructs the layers left out by an export in the given
+// mode from the imported base layer.
+func (h *Graph[K]) rebuild(mode ExportMode, levels []int) {
+	if len(h.layers) == 0 {
+		return
+	}
+	if len(h.layers) > 1 {
+		panic("rebuild requires a graph with only a base layer")
+	}
+
+	// Insert in ID order so that rebuilds are reproducible with a
+	// deterministic Rng.
+	base := h.layers[0].nodes
+	ids := make([]uint32, 0, len(base))
+	for id := range base {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	// Nodes keep their exported levels, if any.
+	level := func(id uint32) int {
+		if levels != nil {
+			return levels[id]
+		}
+		return h.randomLevel()
+	}
+	if mode == ExportVectors {
+		h.layers = nil
+		for _, id := range ids {
+			h.insert(id, base[id].Value, level(id), 0)
+		}
+		return
+	}
+	for _, id := range ids {
+		h.insert(id, base[id].Value, level(id), 1)
+	}
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler with the Export
+// encoding, so that graphs can be embedded in values serialized with
+// encoding/gob or similar packages. As with Export, the distance function
+// must be registered with RegisterDistanceFunc. Graphs held in interface
+// values additionally need their concrete type registered with
+// gob.Register, e.g. gob.Register(&Graph[string]{}).
+func (h *Graph[K]) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := h.Export(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	_ encoding.BinaryMarshaler   = (*Graph[int])(nil)
+	_ encoding.BinaryUnmarshaler = (*Graph[int])(nil)
+)
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, see Import.
+func (h *Graph[K]) UnmarshalBinary(data []byte) error {
+	return h.Import(bytes.NewReader(data))
 }
 
 // SavedGraph is a wrapper around a graph that persists
 // changes to a file upon calls to Save. It is more convenient
 // but less powerful than calling Graph.Export and Graph.Import
 // directly.
+//
+// Next to the snapshot at Path, SaveIncremental maintains a delta file at
+// Path + ".delta" holding the nodes added and deleted since the snapshot.
+// It is merged into the graph on load, and folded into the snapshot by
+// Save.
 type SavedGraph[K cmp.Ordered] struct {
 	*Graph[K]
 	Path string
+
+	// base is the checksum of the snapshot, which identifies the delta
+	// batches written on top of it.
+	base uint64
+}
+
+// deltaSuffix is appended to SavedGraph.Path to name the delta file.
+const deltaSuffix = ".delta"
+
+// Delta file operations.
+const (
+	deltaAdd = iota
+	deltaDelete
+)
+
+// deltaHeader precedes each batch of operations in a delta file.
+// It has a fixed size so that a torn batch can be cut off precisely.
+type deltaHeader struct {
+	// Base is the checksum of the snapshot the batch applies to. Batches
+	// of an older snapshot are left behind by a crash in Save, after
+	// the new snapshot replaced the old one, and are skipped.
+	Base uint64
+	// Seq is the sequence number of the graph when the batch was saved,
+	// which the graph resumes after replaying it.
+	Seq      uint64
+	Ops      uint64
+	Size     uint64
+	Checksum uint32
 }
 
+// snapshotTable is the CRC-64 table of snapshot checksums.
+var snapshotTable = crc64.MakeTable(crc64.ECMA)
+
 // LoadSavedGraph opens a graph from a file, reads it, and returns it.
 //
 // If the file does not exist (i.e. this is a new graph),
@@ -289,26 +1172,143 @@ func LoadSavedGraph[K cmp.Ordered](path string) (*SavedGraph[K], error) {
 	}
 
 	g := NewGraph[K]()
+	hash := crc64.New(snapshotTable)
 	if info.Size() > 0 {
-		err = g.Import(bufio.NewReader(f))
+		r := bufio.NewReader(io.TeeReader(f, hash))
+		err = g.Import(r)
+		if err == nil {
+			// Hash the whole file, whatever Import left unread.
+			_, err = io.Copy(io.Discard, r)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("import: %w", err)
 		}
 	}
 
-	return &SavedGraph[K]{Graph: g, Path: path}, nil
+	sg := &SavedGraph[K]{Graph: g, Path: path, base: hash.Sum64()}
+	err = sg.replayDelta()
+	if err != nil {
+		return nil, fmt.Errorf("replay delta: %w", err)
+	}
+	g.dirty = make(map[K]struct{})
+	return sg, nil
 }
 
-// Save writes the graph to the file.
+// replayDelta applies the delta file to the graph. A batch torn by a
+// crash during SaveIncremental is discarded and cut off the file, so that
+// later batches are appended after the last intact one.
+func (g *SavedGraph[K]) replayDelta() error {
+	f, err := os.OpenFile(g.Path+deltaSuffix, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		r      = bufio.NewReader(f)
+		offset int64
+	)
+	for {
+		var hdr deltaHeader
+		err = binary.Read(r, byteOrder, &hdr)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		var data []byte
+		if err == nil {
+			data = make([]byte, min(hdr.Size, maxChunkPrealloc))
+			_, err = io.ReadFull(r, data)
+			if err == nil && hdr.Size > uint64(len(data)) {
+				buf := bytes.NewBuffer(data)
+				_, err = io.CopyN(buf, r, int64(hdr.Size)-int64(len(data)))
+				data = buf.Bytes()
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+			err == nil && crc32.ChecksumIEEE(data) != hdr.Checksum {
+			// Torn batch.
+			return f.Truncate(offset)
+		}
+		if err != nil {
+			return err
+		}
+
+		if hdr.Base == g.base {
+			err = g.applyDelta(bytes.NewReader(data), hdr.Ops)
+			if err != nil {
+				return fmt.Errorf("batch at offset %d: %w", offset, err)
+			}
+			g.seq = max(g.seq, hdr.Seq)
+		}
+		offset += int64(binary.Size(hdr)) + int64(hdr.Size)
+	}
+}
+
+// applyDelta applies n operations read from r.
+func (g *SavedGraph[K]) applyDelta(r *bytes.Reader, n uint64) error {
+	for i := uint64(0); i < n; i++ {
+		var (
+			op  int
+			key K
+		)
+		_, err := multiBinaryRead(r, &op, g.decodeKey(&key))
+		if err != nil {
+			return fmt.Errorf("decoding operation %d: %w", i, err)
+		}
+		switch op {
+		case deltaAdd:
+			var vec Vector
+			_, err = binaryRead(r, &vec)
+			if err != nil {
+				return fmt.Errorf("decoding vector of %v: %w", key, err)
+			}
+			g.Add(MakeNode(key, vec))
+		case deltaDelete:
+			g.Delete(key)
+		default:
+			return fmt.Errorf("unknown operation %d", op)
+		}
+	}
+	return nil
+}
+
+// Save writes the graph to the file, and removes the delta file.
 func (g *SavedGraph[K]) Save() error {
-	tmp, err := renameio.TempFile("", g.Path)
+	hash := crc64.New(snapshotTable)
+	err := saveFile(g.Path, func(w io.Writer) error {
+		return g.Export(io.MultiWriter(w, hash))
+	})
+	if err != nil {
+		return err
+	}
+	g.base = hash.Sum64()
+
+	err = os.Remove(g.Path + deltaSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing delta: %w", err)
+	}
+	g.dirty = make(map[K]struct{})
+
+	return nil
+}
+
+// saveFile atomically replaces the file at path with the output of export.
+func saveFile(path string, export func(io.Writer) error) error {
+	tmp, err := renameio.TempFile("", path)
 	if err != nil {
 		return err
 	}
 	defer tmp.Cleanup()
 
 	wr := bufio.NewWriter(tmp)
-	err = g.Export(wr)
+	err = export(wr)
 	if err != nil {
 		return fmt.Errorf("exporting: %w", err)
 	}
@@ -322,6 +1322,73 @@ func (g *SavedGraph[K]) Save() error {
 	if err != nil {
 		return fmt.Errorf("closing atomically: %w", err)
 	}
+	return nil
+}
+
+// SaveIncremental appends the nodes added and deleted since the last save
+// to the delta file, so that its cost is proportional to the changes
+// rather than the size of the graph. Call Save from time to time to fold
+// the delta into the snapshot, as it grows with every call.
+//
+// If changes weren't tracked, e.g. because the graph was replaced with
+// Import, SaveIncremental falls back to Save.
+func (g *SavedGraph[K]) SaveIncremental() error {
+	if g.dirty == nil {
+		return g.Save()
+	}
+	if len(g.dirty) == 0 {
+		return nil
+	}
+
+	keys := make([]K, 0, len(g.dirty))
+	for key := range g.dirty {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var batch bytes.Buffer
+	for _, key := range keys {
+		var err error
+		if vec, ok := g.Lookup(key); ok {
+			_, err = multiBinaryWrite(&batch, deltaAdd, g.encodeKey(key), vec)
+		} else {
+			_, err = multiBinaryWrite(&batch, deltaDelete, g.encodeKey(key))
+		}
+		if err != nil {
+			return fmt.Errorf("encode %v: %w", key, err)
+		}
+	}
+
+	f, err := os.OpenFile(g.Path+deltaSuffix, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hdr := deltaHeader{
+		Base:     g.base,
+		Seq:      g.seq,
+		Ops:      uint64(len(keys)),
+		Size:     uint64(batch.Len()),
+		Checksum: crc32.ChecksumIEEE(batch.Bytes()),
+	}
+	_, err = binaryWrite(f, hdr)
+	if err != nil {
+		return fmt.Errorf("writing batch header: %w", err)
+	}
+	_, err = f.Write(batch.Bytes())
+	if err != nil {
+		return fmt.Errorf("writing batch: %w", err)
+	}
+	err = f.Sync()
+	if err != nil {
+		return fmt.Errorf("syncing: %w", err)
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
 
+	g.dirty = make(map[K]struct{})
 	return nil
 }
@@ -3,6 +3,13 @@ package hnsw
 import (
 	"bytes"
 	"cmp"
+	"encoding/gob"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -52,22 +59,31 @@ func Test_binaryWrite_string(t *testing.T) {
 func verifyGraphNodes[K cmp.Ordered](t *testing.T, g *Graph[K]) {
 	for _, layer := range g.layers {
 		for _, node := range layer.nodes {
-			for neighborKey, neighbor := range node.neighbors {
-				_, ok := layer.nodes[neighbor.Key]
+			for _, neighbor := range node.neighbors {
+				n, ok := layer.nodes[neighbor.id]
 				if !ok {
 					t.Errorf(
 						"node %v has neighbor %v, but neighbor does not exist",
-						node.Key, neighbor.Key,
+						node.id, neighbor.id,
 					)
 				}
 
-				if neighborKey != neighbor.Key {
-					t.Errorf("node %v has neighbor %v, but neighbor key is %v", node.Key,
-						neighbor.Key,
-						neighborKey,
+				if n != neighbor {
+					t.Errorf("node %v has neighbor %v, but it isn't the layer's node", node.id,
+						neighbor.id,
 					)
 				}
 			}
+
+			if !slices.IsSortedFunc(node.neighbors, func(a, b *layerNode) int {
+				return cmp.Compare(a.id, b.id)
+			}) {
+				t.Errorf("neighbors of node %v are not sorted", node.id)
+			}
+
+			if _, ok := g.Key(node.id); !ok {
+				t.Errorf("node %v has no key", node.id)
+			}
 		}
 	}
 }
@@ -75,8 +91,8 @@ func verifyGraphNodes[K cmp.Ordered](t *testing.T, g *Graph[K]) {
 // requireGraphApproxEquals checks that two graphs are equal.
 func requireGraphApproxEquals[K cmp.Ordered](t *testing.T, g1, g2 *Graph[K]) {
 	require.Equal(t, g1.Len(), g2.Len())
-	a1 := Analyzer[K]{g1}
-	a2 := Analyzer[K]{g2}
+	a1 := Analyzer[K]{Graph: g1}
+	a2 := Analyzer[K]{Graph: g2}
 
 	require.Equal(
 		t,
@@ -155,6 +171,359 @@ func TestGraph_ExportImport(t *testing.T) {
 	verifyGraphNodes(t, g2)
 }
 
+func TestGraph_ExportImportSharedVectors(t *testing.T) {
+	t.Parallel()
+
+	g1 := newTestGraph[int]()
+	for i := 0; i < 256; i++ {
+		g1.Add(MakeNode(i, randFloats(16)))
+	}
+	require.Greater(t, len(g1.layers), 1)
+
+	var full, base bytes.Buffer
+	require.NoError(t, g1.Export(&full))
+	require.NoError(t, g1.ExportWithOptions(&base, ExportOptions{Mode: ExportBaseLayer}))
+	// Upper layers only add their edges, which take less space than
+	// their vectors would.
+	var upperNodes int
+	for _, layer := range g1.layers[1:] {
+		upperNodes += len(layer.nodes)
+	}
+	require.Less(t, full.Len()-base.Len(), upperNodes*16*4)
+
+	g2 := &Graph[int]{}
+	require.NoError(t, g2.Import(&full))
+	requireGraphApproxEquals(t, g1, g2)
+	for _, layer := range g2.layers[1:] {
+		for id, node := range layer.nodes {
+			require.Same(t, &g2.layers[0].nodes[id].Value[0], &node.Value[0])
+		}
+	}
+}
+
+func TestGraph_ExportCanonical(t *testing.T) {
+	t.Parallel()
+
+	g1 := newTestGraph[string]()
+	for i := 0; i < 256; i++ {
+		g1.Add(MakeNode(strconv.Itoa(i), randFloats(4)))
+	}
+	for i := 0; i < 256; i += 16 {
+		g1.Delete(strconv.Itoa(i))
+	}
+	// Free IDs after the last one in use don't survive importing.
+	g1.Delete("255")
+
+	export := func(g *Graph[string]) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, g.ExportWithOptions(&buf, ExportOptions{Canonical: true}))
+		return buf.Bytes()
+	}
+	data := export(g1)
+	for i := 0; i < 4; i++ {
+		require.Equal(t, data, export(g1))
+	}
+
+	// The imported graph exports the same bytes.
+	g2 := &Graph[string]{}
+	require.NoError(t, g2.Import(bytes.NewReader(data)))
+	requireGraphApproxEquals(t, g1, g2)
+	require.Equal(t, data, export(g2))
+}
+
+func TestGraph_ExportModes(t *testing.T) {
+	g1 := newTestGraph[int]()
+	for i := 0; i < 512; i++ {
+		g1.Add(MakeNode(i, randFloats(8)))
+	}
+
+	var full bytes.Buffer
+	require.NoError(t, g1.Export(&full))
+
+	prevSize := full.Len()
+	for _, mode := range []ExportMode{ExportBaseLayer, ExportVectors} {
+		var buf bytes.Buffer
+		err := g1.ExportWithOptions(&buf, ExportOptions{Mode: mode})
+		require.NoError(t, err)
+		require.Less(t, buf.Len(), prevSize, "mode %d", mode)
+		prevSize = buf.Len()
+
+		g2 := &Graph[int]{DebugChecks: true}
+		require.NoError(t, g2.Import(&buf))
+		require.NoError(t, g2.checkInvariants())
+		verifyGraphNodes(t, g2)
+		require.Equal(t, g1.Len(), g2.Len())
+		require.Greater(t, len(g2.layers), 1, "mode %d", mode)
+		if mode == ExportBaseLayer {
+			require.Equal(t,
+				(&Analyzer[int]{Graph: g1}).Connectivity()[0],
+				(&Analyzer[int]{Graph: g2}).Connectivity()[0],
+			)
+		}
+
+		// Nodes keep their levels, but the edges of rebuilt layers differ
+		// from the original ones, so only expect comparable search
+		// quality.
+		require.Equal(t,
+			(&Analyzer[int]{Graph: g1}).Topography(),
+			(&Analyzer[int]{Graph: g2}).Topography(),
+			"mode %d", mode,
+		)
+		for key := range g1.ids {
+			level1, _ := g1.Level(key)
+			level2, ok := g2.Level(key)
+			require.True(t, ok)
+			require.Equal(t, level1, level2, "mode %d key %d", mode, key)
+		}
+		require.InDelta(t, selfRecall(g1), selfRecall(g2), 0.2, "mode %d", mode)
+		for i := 0; i < 512; i += 64 {
+			id1, _ := g1.ID(i)
+			id2, _ := g2.ID(i)
+			require.Equal(t, id1, id2)
+		}
+	}
+}
+
+// selfRecall returns the fraction of nodes that are found by searching
+// for their own vector.
+func selfRecall[K cmp.Ordered](g *Graph[K]) float64 {
+	var hits int
+	for key, id := range g.ids {
+		results := g.Search(g.layers[0].nodes[id].Value, 1)
+		if len(results) > 0 && results[0].Key == key {
+			hits++
+		}
+	}
+	return float64(hits) / float64(g.Len())
+}
+
+func TestGraph_ExportImportChunks(t *testing.T) {
+	g1 := newTestGraph[int]()
+	for i := 0; i < 3*exportChunkSize+1; i++ {
+		g1.Add(MakeNode(i, randFloats(2)))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, g1.Export(&buf))
+	data := buf.Bytes()
+
+	g2 := &Graph[int]{}
+	require.NoError(t, g2.Import(bytes.NewReader(data)))
+	requireGraphApproxEquals(t, g1, g2)
+	require.NoError(t, g2.checkInvariants())
+
+	// A truncated file fails instead of importing a partial graph.
+	err := (&Graph[int]{}).Import(bytes.NewReader(data[:len(data)-1]))
+	require.Error(t, err)
+
+	// So does a corrupt key table size, without allocating the table.
+	buf.Reset()
+	_, err = multiBinaryWrite(&buf, encodingVersion, 16, 0.25, 20, "euclidean", "", 0,
+		0, 0, 0, math.MaxUint32, 1)
+	require.NoError(t, err)
+	err = (&Graph[int]{}).Import(&buf)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestGraph_ImportV1(t *testing.T) {
+	g1 := newTestGraph[int]()
+	for i := 0; i < 256; i++ {
+		g1.Add(MakeNode(i, randFloats(3)))
+	}
+
+	// Version 1 refers to nodes by key and writes their vectors in every
+	// layer.
+	var buf bytes.Buffer
+	_, err := multiBinaryWrite(&buf, 1, g1.M, g1.Ml, g1.EfSearch, "euclidean", len(g1.layers))
+	require.NoError(t, err)
+	for _, layer := range g1.layers {
+		_, err = binaryWrite(&buf, len(layer.nodes))
+		require.NoError(t, err)
+		for _, node := range layer.nodes {
+			_, err = multiBinaryWrite(&buf, g1.keys[node.id], node.Value, len(node.neighbors))
+			require.NoError(t, err)
+			for _, neighbor := range node.neighbors {
+				_, err = binaryWrite(&buf, g1.keys[neighbor.id])
+				require.NoError(t, err)
+			}
+		}
+	}
+
+	info, err := Inspect(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, 1, info.Version)
+
+	g2 := &Graph[int]{}
+	require.NoError(t, g2.Import(&buf))
+	require.NoError(t, g2.checkInvariants())
+	require.Equal(t, g1.Len(), g2.Len())
+	require.Equal(t, len(g1.layers), len(g2.layers))
+	for i := 0; i < 256; i++ {
+		level1, _ := g1.Level(i)
+		level2, ok := g2.Level(i)
+		require.True(t, ok)
+		require.Equal(t, level1, level2, "key %d", i)
+	}
+	require.InDelta(t, selfRecall(g1), selfRecall(g2), 0.2)
+}
+
+func TestInspect(t *testing.T) {
+	g := newTestGraph[int]()
+	for i := 0; i < 256; i++ {
+		g.Add(MakeNode(i, randFloats(3)))
+	}
+
+	for _, mode := range []ExportMode{ExportFull, ExportVectors} {
+		var buf bytes.Buffer
+		err := g.ExportWithOptions(&buf, ExportOptions{Mode: mode})
+		require.NoError(t, err)
+
+		info, err := Inspect(&buf)
+		require.NoError(t, err)
+		require.Equal(t, ExportInfo{
+			Version:  encodingVersion,
+			M:        g.M,
+			Ml:       g.Ml,
+			EfSearch: g.EfSearch,
+			Distance: "euclidean",
+			Mode:     mode,
+			Nodes:    256,
+			Dims:     3,
+			Layers:   (&Analyzer[int]{Graph: g}).Topography(),
+		}, info)
+	}
+
+	_, err := Inspect(bytes.NewReader([]byte{0x7f}))
+	require.Error(t, err)
+}
+
+func TestGraph_ExportImportTombstones(t *testing.T) {
+	g1 := newTestGraph[int]()
+	for i := 0; i < 16; i++ {
+		g1.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	g1.Delete(3)
+	g1.Delete(5)
+
+	buf := &bytes.Buffer{}
+	err := g1.Export(buf)
+	require.NoError(t, err)
+
+	g2 := &Graph[int]{}
+	err = g2.Import(buf)
+	require.NoError(t, err)
+	require.Equal(t, g1.Seq(), g2.Seq())
+	require.Equal(t, map[int]uint64{3: 17, 5: 18}, g2.Tombstones())
+
+	// An older snapshot still containing the deleted keys must not
+	// resurrect them once the newer tombstones are applied.
+	old := newTestGraph[int]()
+	for i := 0; i < 16; i++ {
+		old.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	require.Equal(t, 2, old.ApplyTombstones(g2.Tombstones()))
+	require.Equal(t, 14, old.Len())
+	_, ok := old.Lookup(3)
+	require.False(t, ok)
+	require.Equal(t, g1.Seq(), old.Seq())
+	verifyGraphNodes(t, old)
+
+	// A key added again after its delete is kept, also once exported.
+	g1.Add(MakeNode(5, Vector{5}))
+	buf.Reset()
+	require.NoError(t, g1.Export(buf))
+	g3 := &Graph[int]{}
+	require.NoError(t, g3.Import(buf))
+	for _, g := range []*Graph[int]{g1, g3} {
+		require.Equal(t, 0, g.ApplyTombstones(g2.Tombstones()))
+		_, ok = g.Lookup(5)
+		require.True(t, ok)
+		require.Equal(t, map[int]uint64{3: 17}, g.Tombstones())
+	}
+}
+
+type (
+	testUserID string
+	testShard  uint
+)
+
+// upperKeyCoder stores string keys in upper case, to tell it apart from
+// the default encoding.
+type upperKeyCoder struct{}
+
+func (upperKeyCoder) EncodeKey(w io.Writer, key string) error {
+	_, err := binaryWrite(w, strings.ToUpper(key))
+	return err
+}
+
+func (upperKeyCoder) DecodeKey(r io.Reader) (string, error) {
+	var key string
+	_, err := binaryRead(r, &key)
+	return strings.ToLower(key), err
+}
+
+func requireKeysRoundTrip[K cmp.Ordered](t *testing.T, g1 *Graph[K], keys ...K) *bytes.Buffer {
+	t.Helper()
+	for i, key := range keys {
+		g1.Add(MakeNode(key, Vector{float32(i)}))
+	}
+	g1.Delete(keys[0])
+
+	var buf bytes.Buffer
+	require.NoError(t, g1.Export(&buf))
+	data := slices.Clone(buf.Bytes())
+
+	g2 := &Graph[K]{KeyCoder: g1.KeyCoder}
+	require.NoError(t, g2.Import(&buf))
+	for _, key := range keys[1:] {
+		want, _ := g1.Lookup(key)
+		got, ok := g2.Lookup(key)
+		require.True(t, ok, "key %v", key)
+		require.Equal(t, want, got)
+	}
+	require.Equal(t, g1.Tombstones(), g2.Tombstones())
+	return bytes.NewBuffer(data)
+}
+
+func TestGraph_KeyCoder(t *testing.T) {
+	t.Run("NamedTypes", func(t *testing.T) {
+		requireKeysRoundTrip(t, newTestGraph[testUserID](), "alice", "bob", "carol")
+		requireKeysRoundTrip(t, newTestGraph[testShard](), 1, 2, 3)
+		requireKeysRoundTrip(t, newTestGraph[float64](), 0.5, 1.5, 2.5)
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		g := newTestGraph[string]()
+		g.KeyCoder = upperKeyCoder{}
+		buf := requireKeysRoundTrip(t, g, "alice", "bob", "carol")
+		require.Contains(t, buf.String(), "CAROL")
+		require.NotContains(t, buf.String(), "carol")
+	})
+}
+
+func TestGraph_Gob(t *testing.T) {
+	type index struct {
+		Name  string
+		Graph *Graph[string]
+	}
+
+	g := newTestGraph[string]()
+	for i := 0; i < 64; i++ {
+		g.Add(MakeNode(strconv.Itoa(i), randFloats(4)))
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(index{Name: "test", Graph: g})
+	require.NoError(t, err)
+
+	var decoded index
+	err = gob.NewDecoder(&buf).Decode(&decoded)
+	require.NoError(t, err)
+	require.Equal(t, "test", decoded.Name)
+	requireGraphApproxEquals(t, g, decoded.Graph)
+	verifyGraphNodes(t, decoded.Graph)
+}
+
 func TestSavedGraph(t *testing.T) {
 	dir := t.TempDir()
 
@@ -180,6 +549,91 @@ func TestSavedGraph(t *testing.T) {
 
 const benchGraphSize = 100
 
+func TestSavedGraph_SaveIncremental(t *testing.T) {
+	path := t.TempDir() + "/graph"
+
+	g1, err := LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		g1.Add(MakeNode(i, randFloats(16)))
+	}
+	require.NoError(t, g1.Save())
+	snapshot, err := os.Stat(path)
+	require.NoError(t, err)
+
+	g1.Add(MakeNode(1000, randFloats(16)))
+	// The delta holds only the last of several changes to a key.
+	g1.Add(MakeNode(5, randFloats(16)))
+	g1.Add(MakeNode(5, randFloats(16)))
+	g1.Delete(7)
+	require.NoError(t, g1.SaveIncremental())
+	g1.Delete(1000)
+	require.NoError(t, g1.SaveIncremental())
+
+	// The snapshot is untouched and the delta only holds the changes.
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, snapshot.ModTime(), info.ModTime())
+	delta, err := os.Stat(path + deltaSuffix)
+	require.NoError(t, err)
+	require.Less(t, delta.Size(), snapshot.Size()/100)
+
+	requireLoaded := func() *SavedGraph[int] {
+		g2, err := LoadSavedGraph[int](path)
+		require.NoError(t, err)
+		require.Equal(t, g1.Len(), g2.Len())
+		require.Equal(t, g1.Seq(), g2.Seq())
+		for _, key := range []int{5, 7, 1000, 2000, 3000} {
+			want, wantOK := g1.Lookup(key)
+			got, ok := g2.Lookup(key)
+			require.Equal(t, wantOK, ok, "key %v", key)
+			require.Equal(t, want, got, "key %v", key)
+		}
+		require.NoError(t, g2.checkInvariants())
+		return g2
+	}
+	requireLoaded()
+
+	// A batch torn by a crash is discarded, and later batches are
+	// still loaded.
+	f, err := os.OpenFile(path+deltaSuffix, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	g2 := requireLoaded()
+	g2.Delete(5)
+	require.NoError(t, g2.SaveIncremental())
+	g1 = g2
+	requireLoaded()
+
+	// Save folds the delta into the snapshot.
+	require.NoError(t, g2.Save())
+	_, err = os.Stat(path + deltaSuffix)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	requireLoaded()
+
+	// A crash in Save after replacing the snapshot, but before removing
+	// the delta, doesn't bring back nodes deleted since the delta.
+	g2.Add(MakeNode(2000, randFloats(16)))
+	require.NoError(t, g2.SaveIncremental())
+	stale, err := os.ReadFile(path + deltaSuffix)
+	require.NoError(t, err)
+	g2.Delete(2000)
+	require.NoError(t, g2.Save())
+	require.NoError(t, os.WriteFile(path+deltaSuffix, stale, 0o600))
+	g2 = requireLoaded()
+	_, ok := g2.Lookup(2000)
+	require.False(t, ok)
+
+	// Batches appended after the stale ones are still loaded.
+	g2.Add(MakeNode(3000, randFloats(16)))
+	require.NoError(t, g2.SaveIncremental())
+	g1 = g2
+	requireLoaded()
+}
+
 func BenchmarkGraph_Import(b *testing.B) {
 	b.ReportAllocs()
 	g := newTestGraph[int]()
@@ -208,6 +662,27 @@ func BenchmarkGraph_Import(b *testing.B) {
 	}
 }
 
+// BenchmarkGraph_ImportLarge imports a graph spanning many chunks, where
+// Import decodes in parallel.
+func BenchmarkGraph_ImportLarge(b *testing.B) {
+	b.ReportAllocs()
+	g := newTestGraph[int]()
+	for i := 0; i < 20000; i++ {
+		g.Add(MakeNode(i, randFloats(256)))
+	}
+
+	buf := &bytes.Buffer{}
+	err := g.Export(buf)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	b.SetBytes(int64(buf.Len()))
+	for i := 0; i < b.N; i++ {
+		err = (&Graph[int]{}).Import(bytes.NewReader(buf.Bytes()))
+		require.NoError(b, err)
+	}
+}
+
 func BenchmarkGraph_Export(b *testing.B) {
 	b.ReportAllocs()
 	g := newTestGraph[int]()
@@ -231,3 +706,22 @@ func BenchmarkGraph_Export(b *testing.B) {
 		buf.Reset()
 	}
 }
+
+func BenchmarkDefaultKeyCoder(b *testing.B) {
+	var (
+		coder DefaultKeyCoder[int]
+		buf   bytes.Buffer
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		err := coder.EncodeKey(&buf, i)
+		if err != nil {
+			b.Fatal(err)
+		}
+		key, err := coder.DecodeKey(&buf)
+		if err != nil || key != i {
+			b.Fatal(key, err)
+		}
+	}
+}
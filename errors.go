@@ -0,0 +1,52 @@
+package hnsw
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the package, to be tested with errors.Is. They are
+// wrapped with details, e.g. the name of a collection or the version
+// found in an export.
+var (
+	// ErrDimensionMismatch is returned when a vector doesn't have the
+	// dimensions of the graph or collection. The error is a
+	// *DimensionError. Graph methods panic with it instead.
+	ErrDimensionMismatch = errors.New("dimension mismatch")
+
+	// ErrInvalidK is returned by searches that return errors when k is
+	// not positive.
+	ErrInvalidK = errors.New("k must be positive")
+
+	// ErrUnknownDistance is returned when exporting a graph whose
+	// distance function is not registered with RegisterDistanceFunc
+	// or set with Graph.SetDistance, or importing one whose distance
+	// function is not registered under the exported name.
+	ErrUnknownDistance = errors.New("unknown distance function")
+
+	// ErrIncompatibleVersion is returned when importing data written by
+	// an incompatible version of the package.
+	ErrIncompatibleVersion = errors.New("incompatible encoding version")
+
+	// ErrGraphEmpty is returned by operations that need at least one
+	// node, such as Graph.SearchRerank.
+	ErrGraphEmpty = errors.New("graph is empty")
+
+	// ErrBehind is returned by Graph.SearchAfter and LiveGraph.SearchAfter
+	// when the graph hasn't caught up to the requested sequence number.
+	ErrBehind = errors.New("graph is behind")
+)
+
+// DimensionError is the error for a vector of Got dimensions where Want
+// are expected. It matches ErrDimensionMismatch.
+type DimensionError struct {
+	Want, Got int
+}
+
+func (e *DimensionError) Error() string {
+	return fmt.Sprintf("%d dimensions, not %d", e.Got, e.Want)
+}
+
+func (e *DimensionError) Is(target error) bool {
+	return target == ErrDimensionMismatch
+}
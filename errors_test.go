@@ -0,0 +1,76 @@
+package hnsw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("DimensionMismatch", func(t *testing.T) {
+		c := NewCollections[int]()
+		_, err := c.Create("text", 3, nil)
+		require.NoError(t, err)
+
+		err = c.Add("text", MakeNode(1, Vector{1, 2}))
+		require.ErrorIs(t, err, ErrDimensionMismatch)
+		var dimErr *DimensionError
+		require.ErrorAs(t, err, &dimErr)
+		require.Equal(t, DimensionError{Want: 3, Got: 2}, *dimErr)
+
+		g := newTestGraph[int]()
+		g.Add(MakeNode(1, Vector{1, 2}))
+		defer func() {
+			err, _ := recover().(error)
+			require.ErrorIs(t, err, ErrDimensionMismatch)
+		}()
+		g.Search(Vector{1, 2, 3}, 1)
+	})
+
+	t.Run("InvalidK", func(t *testing.T) {
+		c := NewCollections[int]()
+		_, err := c.Create("text", 1, nil)
+		require.NoError(t, err)
+		_, err = c.Search("text", Vector{1}, 0)
+		require.ErrorIs(t, err, ErrInvalidK)
+
+		g := newTestGraph[int]()
+		_, err = g.SearchRerank(context.Background(), Vector{1}, -1, RerankOptions[int]{})
+		require.ErrorIs(t, err, ErrInvalidK)
+	})
+
+	t.Run("GraphEmpty", func(t *testing.T) {
+		g := newTestGraph[int]()
+		_, err := g.SearchRerank(context.Background(), Vector{1}, 1, RerankOptions[int]{})
+		require.ErrorIs(t, err, ErrGraphEmpty)
+	})
+
+	t.Run("UnknownDistance", func(t *testing.T) {
+		g := newTestGraph[int]()
+		g.Distance = func(a, b Vector) float32 { return 0 }
+		err := g.Export(&bytes.Buffer{})
+		require.ErrorIs(t, err, ErrUnknownDistance)
+
+		var buf bytes.Buffer
+		g = newTestGraph[int]()
+		g.Add(MakeNode(1, Vector{1}))
+		require.NoError(t, g.Export(&buf))
+		data := bytes.Replace(buf.Bytes(), []byte("euclidean"), []byte("euclidian"), 1)
+		err = newTestGraph[int]().Import(bytes.NewReader(data))
+		require.ErrorIs(t, err, ErrUnknownDistance)
+	})
+
+	t.Run("IncompatibleVersion", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := multiBinaryWrite(&buf, 99, 16, 0.25, 20, "euclidean")
+		require.NoError(t, err)
+		err = newTestGraph[int]().Import(&buf)
+		require.ErrorIs(t, err, ErrIncompatibleVersion)
+		require.False(t, errors.Is(err, ErrUnknownDistance))
+	})
+}
@@ -0,0 +1,98 @@
+package hnsw_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/coder/hnsw"
+)
+
+func ExampleGraph_Search() {
+	g := hnsw.NewGraph[int]()
+	g.Add(
+		hnsw.MakeNode(1, []float32{1, 1, 1}),
+		hnsw.MakeNode(2, []float32{1, -1, 0.999}),
+		hnsw.MakeNode(3, []float32{1, 0, -0.5}),
+	)
+
+	neighbors := g.Search(
+		[]float32{0.5, 0.5, 0.5},
+		1,
+	)
+	fmt.Printf("best friend: %v\n", neighbors[0].Value)
+	// Output: best friend: [1 1 1]
+}
+
+func ExampleSavedGraph() {
+	dir, err := os.MkdirTemp("", "hnsw")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "some.graph")
+
+	g1, err := hnsw.LoadSavedGraph[int](path)
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < 128; i++ {
+		g1.Add(hnsw.MakeNode(i, []float32{float32(i), 1}))
+	}
+	err = g1.Save()
+	if err != nil {
+		panic(err)
+	}
+
+	// Later...
+	g2, err := hnsw.LoadSavedGraph[int](path)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(g2.Len())
+	// Output: 128
+}
+
+// A query can be moved away from a result the user marked as irrelevant,
+// as in Rocchio's relevance feedback.
+func ExampleWeightedSum() {
+	g := hnsw.NewGraph[string]()
+	g.Distance = hnsw.EuclideanDistance
+	g.Add(
+		hnsw.MakeNode("apple", []float32{1, 0}),
+		hnsw.MakeNode("pear", []float32{1, -1}),
+		hnsw.MakeNode("apricot", []float32{1, 0.7}),
+	)
+
+	query := []float32{1, -0.2}
+	fmt.Println(g.Search(query, 2)[1].Key)
+
+	negative, _ := g.Lookup("pear")
+	query = hnsw.WeightedSum([]hnsw.Vector{query, negative}, []float32{1.5, -0.5})
+	fmt.Println(g.Search(query, 2)[1].Key)
+	// Output:
+	// pear
+	// apricot
+}
+
+// Nodes are added and deleted in batches by passing several at once.
+func ExampleGraph_BatchDelete() {
+	g := hnsw.NewGraph[int]()
+	g.Distance = hnsw.EuclideanDistance
+	nodes := make([]hnsw.Node[int], 100)
+	for i := range nodes {
+		nodes[i] = hnsw.MakeNode(i, []float32{float32(i)})
+	}
+	g.Add(nodes...)
+
+	fmt.Println(g.BatchDelete(10, 11, 12, 1000))
+	fmt.Println(g.Len())
+	for _, node := range g.Search([]float32{11}, 2) {
+		fmt.Println(node.Key)
+	}
+	// Output:
+	// 3
+	// 97
+	// 9
+	// 13
+}
@@ -0,0 +1,198 @@
+package hnsw
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/coder/hnsw/heap"
+)
+
+// filterSamples is the number of nodes sampled to estimate how many nodes
+// a Filter allows.
+const filterSamples = 64
+
+// Filter restricts a search to a subset of the nodes of a graph. A node
+// is allowed if it is in Keys, when Keys is not nil, and Allow returns
+// true for it, when Allow is not nil.
+type Filter[K cmp.Ordered] struct {
+	// Allow reports whether the node with the given key may be returned.
+	Allow func(key K) bool
+
+	// Keys are the keys of the nodes that may be returned. Keys not in
+	// the graph are ignored.
+	Keys []K
+
+	// ScanBelow is the estimated number of allowed nodes below which
+	// SearchFiltered compares the query with each of them rather than
+	// traversing the graph, where most nodes visited would be disallowed.
+	// Defaults to M times the size of the search's beam. Negative values
+	// disable scanning.
+	ScanBelow int
+
+	// CacheKey identifies the filter for QueryCache.SearchFiltered, e.g.
+	// "tenant=acme". Filters that allow the same nodes must have the same
+	// key, and others different keys. Searches with filters without a
+	// key are not cached.
+	CacheKey string
+}
+
+// allows reports whether the filter allows the node with the given key.
+func (f *Filter[K]) allows(key K) bool {
+	if f.Keys != nil && !slices.Contains(f.Keys, key) {
+		return false
+	}
+	return f.Allow == nil || f.Allow(key)
+}
+
+// SearchFiltered is like SearchWithOptions, but returns only nodes
+// allowed by filter.
+//
+// Searches of the graph traverse disallowed nodes to reach allowed ones,
+// which wastes effort when few nodes are allowed. So the number of
+// allowed nodes is estimated first, from len(filter.Keys) or a random
+// sample of nodes, and if it is below filter.ScanBelow the allowed nodes
+// are scanned instead, which is exact.
+func (h *Graph[K]) SearchFiltered(near Vector, k int, filter Filter[K], opts SearchOptions) []SearchResult[K] {
+	h.assertDims(near)
+	if len(h.layers) == 0 || k <= 0 {
+		return nil
+	}
+
+	var keys bitset
+	if filter.Keys != nil {
+		for _, key := range filter.Keys {
+			if id, ok := h.ids[key]; ok {
+				keys.set(id)
+			}
+		}
+	}
+	allow := func(id uint32) bool {
+		if filter.Keys != nil && !keys.has(id) {
+			return false
+		}
+		return filter.Allow == nil || filter.Allow(h.keys[id])
+	}
+
+	n := k
+	if opts.reranks() {
+		// Retrieve more nodes, as ranking may reorder them.
+		n = max(k, h.EfSearch)
+	}
+	scanBelow := filter.ScanBelow
+	if scanBelow == 0 {
+		scanBelow = h.M * max(n, h.EfSearch)
+	}
+	if scanBelow > 0 && h.estimateAllowed(filter, allow) < scanBelow {
+		var stats *searchStats
+		if opts.Stats != nil {
+			stats = &searchStats{}
+			defer func() { *opts.Stats = stats.public() }()
+		}
+		return h.searchResults(h.scan(near, n, filter, opts, allow, stats), k, opts)
+	}
+	results, _ := h.searchPartial(near, k, opts, allow)
+	return results
+}
+
+// estimateAllowed estimates the number of nodes allowed by filter.
+func (h *Graph[K]) estimateAllowed(filter Filter[K], allow func(id uint32) bool) int {
+	if filter.Keys != nil && filter.Allow == nil {
+		return len(filter.Keys)
+	}
+	base := h.layers[0].nodes
+	if len(base) <= filterSamples {
+		// Counting is as cheap as sampling.
+		var allowed int
+		for id := range base {
+			if allow(id) {
+				allowed++
+			}
+		}
+		return allowed
+	}
+
+	if h.Rng == nil {
+		h.Rng = defaultRand()
+	}
+	var sampled, allowed int
+	// IDs may be free, so draw until enough are in the graph, giving up
+	// on a sparse ID space.
+	for i := 0; i < 4*filterSamples && sampled < filterSamples; i++ {
+		id := uint32(h.Rng.Intn(len(h.keys)))
+		if _, ok := base[id]; !ok {
+			continue
+		}
+		sampled++
+		if allow(id) {
+			allowed++
+		}
+	}
+	if sampled == 0 {
+		return len(base)
+	}
+	estimate := allowed * len(base) / sampled
+	if filter.Keys != nil {
+		estimate = min(estimate, len(filter.Keys))
+	}
+	return estimate
+}
+
+// scan returns the n allowed nodes closest to near, closest first, by
+// comparing near with every allowed node. A nil allow allows all nodes.
+func (h *Graph[K]) scan(near Vector, n int, filter Filter[K], opts SearchOptions, allow func(id uint32) bool, stats *searchStats) []searchCandidate {
+	var (
+		base    = h.layers[0].nodes
+		nearest = heap.NewBounded[keyedCandidate[K]](n)
+	)
+	consider := func(node *layerNode) {
+		dist := h.Distance(node.Value, near)
+		stats.add(dist)
+		if opts.MaxDistance > 0 && dist > opts.MaxDistance {
+			return
+		}
+		nearest.Push(keyedCandidate[K]{searchCandidate{node: node, dist: dist}, h.keys[node.id]})
+	}
+
+	if filter.Keys != nil {
+		var seen bitset
+		for _, key := range filter.Keys {
+			id, ok := h.ids[key]
+			if !ok || seen.has(id) {
+				continue
+			}
+			seen.set(id)
+			if filter.Allow == nil || filter.Allow(key) {
+				consider(base[id])
+			}
+		}
+	} else {
+		for id, node := range base {
+			if allow == nil || allow(id) {
+				consider(node)
+			}
+		}
+	}
+	// A scan visits the allowed nodes of the base layer.
+	stats.endLayer(0)
+	sorted := nearest.Sorted()
+	nodes := make([]searchCandidate, len(sorted))
+	for i, c := range sorted {
+		nodes[i] = c.searchCandidate
+	}
+	return nodes
+}
+
+// keyedCandidate is a searchCandidate that is ordered by key at equal
+// distance, so that which of the nodes tied at the n-th distance a scan
+// keeps doesn't depend on the order in which it visits them.
+type keyedCandidate[K cmp.Ordered] struct {
+	searchCandidate
+	key K
+}
+
+func (c keyedCandidate[K]) Less(o keyedCandidate[K]) bool {
+	if c.dist != o.dist {
+		return c.dist < o.dist
+	}
+	return c.key < o.key
+}
@@ -0,0 +1,132 @@
+package hnsw
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_SearchFiltered(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	g.M = 16
+	g.EfSearch = 64
+	for i := 0; i < 2000; i++ {
+		g.Add(MakeNode(i, randFloats(8)))
+	}
+	query := randFloats(8)
+
+	// exact returns the keys of the k allowed nodes closest to query.
+	exact := func(k int, allow func(int) bool) []int {
+		var keys []int
+		for _, c := range g.scan(query, g.Len(), Filter[int]{}, SearchOptions{}, func(id uint32) bool {
+			return allow(g.keys[id])
+		}, nil) {
+			keys = append(keys, g.keys[c.node.id])
+		}
+		return keys[:min(k, len(keys))]
+	}
+	keys := func(results []SearchResult[int]) []int {
+		out := make([]int, len(results))
+		for i, r := range results {
+			out[i] = r.Key
+		}
+		return out
+	}
+	even := func(key int) bool { return key%2 == 0 }
+	rare := func(key int) bool { return key%500 == 0 }
+
+	t.Run("Traverse", func(t *testing.T) {
+		filter := Filter[int]{Allow: even, ScanBelow: -1}
+		results := g.SearchFiltered(query, 10, filter, SearchOptions{})
+		require.Len(t, results, 10)
+		for _, r := range results {
+			require.True(t, even(r.Key))
+		}
+		require.True(t, slices.IsSortedFunc(results, func(a, b SearchResult[int]) int {
+			return cmp.Compare(a.Distance, b.Distance)
+		}))
+		var found int
+		for _, key := range exact(10, even) {
+			if slices.Contains(keys(results), key) {
+				found++
+			}
+		}
+		require.GreaterOrEqual(t, found, 8)
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		// Only 4 nodes are allowed, which traversal would hardly find.
+		results := g.SearchFiltered(query, 10, Filter[int]{Allow: rare}, SearchOptions{})
+		require.Equal(t, exact(10, rare), keys(results))
+
+		results = g.SearchFiltered(query, 2, Filter[int]{Keys: []int{1, 3, 3, 5, 7, -1}}, SearchOptions{})
+		require.Equal(t, exact(2, func(key int) bool {
+			return key == 1 || key == 3 || key == 5 || key == 7
+		}), keys(results))
+	})
+
+	t.Run("KeysAndAllow", func(t *testing.T) {
+		filter := Filter[int]{Keys: []int{0, 1, 2, 3, 4, 5}, Allow: even, ScanBelow: -1}
+		results := g.SearchFiltered(query, 10, filter, SearchOptions{})
+		require.ElementsMatch(t, []int{0, 2, 4}, keys(results))
+	})
+
+	t.Run("MaxDistance", func(t *testing.T) {
+		all := g.SearchFiltered(query, 4, Filter[int]{Allow: rare}, SearchOptions{})
+		require.Len(t, all, 4)
+		results := g.SearchFiltered(query, 4, Filter[int]{Allow: rare}, SearchOptions{
+			MaxDistance: all[1].Distance,
+		})
+		require.Equal(t, keys(all[:2]), keys(results))
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		results := g.SearchFiltered(query, 10, Filter[int]{Keys: []int{}}, SearchOptions{})
+		require.Empty(t, results)
+		results = NewGraph[int]().SearchFiltered(query, 10, Filter[int]{Allow: even}, SearchOptions{})
+		require.Empty(t, results)
+	})
+}
+
+func TestGraph_ExactBelow(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	g.M = 2
+	g.EfSearch = 1
+	for i := 0; i < 200; i++ {
+		g.Add(MakeNode(i, randFloats(8)))
+	}
+	exact := func(query Vector, k int, allow func(int) bool) []int {
+		var want []int
+		for _, c := range g.scan(query, g.Len(), Filter[int]{}, SearchOptions{}, nil, nil) {
+			if key := g.keys[c.node.id]; allow == nil || allow(key) {
+				want = append(want, key)
+			}
+		}
+		return want[:k]
+	}
+
+	g.ExactBelow = g.Len() + 1
+	odd := Filter[int]{Allow: func(key int) bool { return key%2 == 1 }, ScanBelow: -1}
+	for i := 0; i < 20; i++ {
+		query := randFloats(8)
+		var stats SearchStats
+		results := g.SearchWithOptions(query, 10, SearchOptions{Stats: &stats})
+		require.Equal(t, exact(query, 10, nil), keys(results))
+		require.Equal(t, g.Len(), stats.Visited)
+
+		results = g.SearchFiltered(query, 10, odd, SearchOptions{})
+		require.Equal(t, exact(query, 10, odd.Allow), keys(results))
+	}
+
+	// Larger graphs are traversed.
+	g.ExactBelow = g.Len()
+	var stats SearchStats
+	g.SearchWithOptions(randFloats(8), 10, SearchOptions{Stats: &stats})
+	require.Less(t, stats.Visited, g.Len())
+}
@@ -0,0 +1,328 @@
+package hnsw
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+// FrozenGraph is an immutable copy of a Graph laid out for fast searches,
+// see Graph.Freeze. Nodes are numbered densely, neighbor lists of each
+// layer are packed into a single array (compressed sparse row), and
+// vectors into another, so that searches chase no pointers and allocate
+// nothing but their results.
+//
+// It is safe for concurrent use.
+type FrozenGraph[K cmp.Ordered] struct {
+	distance DistanceFunc
+	score    ScoreFunc
+	efSearch int
+	dims     int
+
+	// keys and vectors hold the key and vector of each node by index.
+	keys    []K
+	vectors []float32
+
+	layers []frozenLayer
+	entry  uint32
+
+	scratch sync.Pool // *frozenScratch
+}
+
+// frozenLayer is the adjacency of a layer in compressed sparse row
+// layout: the neighbors of node i are neighbors[offsets[i]:offsets[i+1]].
+// Nodes that are not in the layer have no neighbors.
+type frozenLayer struct {
+	offsets   []uint32
+	neighbors []uint32
+}
+
+func (l *frozenLayer) neighborsOf(i uint32) []uint32 {
+	return l.neighbors[l.offsets[i]:l.offsets[i+1]]
+}
+
+// Freeze returns a FrozenGraph with the nodes and edges of the graph, for
+// serving searches once writes have stopped. The graph is copied, so it
+// may be discarded or modified afterwards without affecting the frozen
+// graph. Searches traverse the same edges as on the graph.
+//
+// Nodes are laid out in breadth-first order from the entry point of
+// searches, so that nodes visited by the same search tend to be close in
+// memory.
+func (h *Graph[K]) Freeze() *FrozenGraph[K] {
+	return h.freeze(h.bfsOrder())
+}
+
+// freeze is Freeze with the IDs of the nodes in the order to lay them
+// out in.
+func (h *Graph[K]) freeze(ids []uint32) *FrozenGraph[K] {
+	f := &FrozenGraph[K]{
+		distance: h.Distance,
+		score:    h.Score,
+		efSearch: h.EfSearch,
+		dims:     h.Dims(),
+	}
+	if f.score == nil {
+		f.score = ScoreFuncFor(h.Distance)
+	}
+	if h.Len() == 0 {
+		return f
+	}
+
+	base := h.layers[0].nodes
+	index := make(map[uint32]uint32, len(ids))
+	f.keys = make([]K, len(ids))
+	f.vectors = make([]float32, 0, len(ids)*f.dims)
+	for i, id := range ids {
+		index[id] = uint32(i)
+		f.keys[i] = h.keys[id]
+		f.vectors = append(f.vectors, base[id].Value...)
+	}
+
+	f.layers = make([]frozenLayer, len(h.layers))
+	for l, layer := range h.layers {
+		fl := &f.layers[l]
+		fl.offsets = make([]uint32, len(ids)+1)
+		for i, id := range ids {
+			if node, ok := layer.nodes[id]; ok {
+				start := len(fl.neighbors)
+				for _, neighbor := range node.neighbors {
+					fl.neighbors = append(fl.neighbors, index[neighbor.id])
+				}
+				// Visit neighbors in memory order.
+				slices.Sort(fl.neighbors[start:])
+			}
+			fl.offsets[i+1] = uint32(len(fl.neighbors))
+		}
+	}
+	f.entry = index[h.layers[len(h.layers)-1].entry().id]
+	return f
+}
+
+// idOrder returns the IDs of the nodes in ascending order.
+func (h *Graph[K]) idOrder() []uint32 {
+	if h.Len() == 0 {
+		return nil
+	}
+	ids := make([]uint32, 0, h.Len())
+	for id := range h.layers[0].nodes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// bfsOrder returns the IDs of the nodes in breadth-first order over the
+// base layer, starting from the entry point of searches. Nodes that are
+// not reachable from it follow in ID order.
+func (h *Graph[K]) bfsOrder() []uint32 {
+	if h.Len() == 0 {
+		return nil
+	}
+	var (
+		base    = h.layers[0].nodes
+		ids     = make([]uint32, 0, len(base))
+		visited bitset
+	)
+	entry := h.layers[len(h.layers)-1].entry()
+	ids = append(ids, entry.id)
+	visited.set(entry.id)
+	for i := 0; i < len(ids); i++ {
+		for _, neighbor := range base[ids[i]].neighbors {
+			if !visited.has(neighbor.id) {
+				visited.set(neighbor.id)
+				ids = append(ids, neighbor.id)
+			}
+		}
+	}
+	if len(ids) < len(base) {
+		for _, id := range h.idOrder() {
+			if !visited.has(id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// Len returns the number of nodes in the graph.
+func (f *FrozenGraph[K]) Len() int {
+	return len(f.keys)
+}
+
+// Dims returns the number of dimensions in the graph, or 0 if the graph
+// is empty.
+func (f *FrozenGraph[K]) Dims() int {
+	return f.dims
+}
+
+func (f *FrozenGraph[K]) vector(i uint32) Vector {
+	start := int(i) * f.dims
+	return f.vectors[start : start+f.dims : start+f.dims]
+}
+
+// Lookup returns the vector with the given key. Nodes are not indexed by
+// key, so it takes time linear in the size of the graph.
+func (f *FrozenGraph[K]) Lookup(key K) (Vector, bool) {
+	i := slices.Index(f.keys, key)
+	if i < 0 {
+		return nil, false
+	}
+	return f.vector(uint32(i)), true
+}
+
+// Search is like Graph.Search. The vectors of the results share the
+// memory of the frozen graph and must not be modified.
+func (f *FrozenGraph[K]) Search(near Vector, k int) []Node[K] {
+	results := f.AppendSearch(nil, near, k)
+	out := make([]Node[K], len(results))
+	for i, result := range results {
+		out[i] = result.Node
+	}
+	return out
+}
+
+// AppendSearch appends the k nearest neighbors of near to dst, with
+// their distance and score, and returns the extended slice. It doesn't
+// allocate if dst has room for the results.
+func (f *FrozenGraph[K]) AppendSearch(dst []SearchResult[K], near Vector, k int) []SearchResult[K] {
+	if f.Len() == 0 || k <= 0 {
+		return dst
+	}
+	if len(near) != f.dims {
+		panic(&DimensionError{Want: f.dims, Got: len(near)})
+	}
+
+	s, _ := f.scratch.Get().(*frozenScratch)
+	if s == nil {
+		s = &frozenScratch{visited: make([]uint32, f.Len())}
+	}
+	defer f.scratch.Put(s)
+
+	entry := f.entry
+	for l := len(f.layers) - 1; l > 0; l-- {
+		entry = f.search(s, l, entry, near, 1)[0].index
+	}
+	for _, c := range f.search(s, 0, entry, near, k) {
+		dst = append(dst, SearchResult[K]{
+			Node:     Node[K]{Key: f.keys[c.index], Value: f.vector(c.index)},
+			Distance: c.dist,
+			Score:    f.score(c.dist),
+		})
+	}
+	return dst
+}
+
+// frozenCandidate is a node found by a search of a FrozenGraph.
+type frozenCandidate struct {
+	index uint32
+	dist  float32
+}
+
+// frozenScratch is the memory reused across searches of a FrozenGraph.
+type frozenScratch struct {
+	// visited holds the epoch in which each node was last visited, so
+	// that it is reset by incrementing epoch.
+	visited    []uint32
+	epoch      uint32
+	candidates []frozenCandidate // min-heap
+	nearest    []frozenCandidate // max-heap
+}
+
+// search is layerNode.search on a layer of the frozen graph. It returns
+// the k nearest nodes sorted by distance, in memory owned by s.
+func (f *FrozenGraph[K]) search(s *frozenScratch, l int, entry uint32, target Vector, k int) []frozenCandidate {
+	s.epoch++
+	if s.epoch == 0 {
+		clear(s.visited)
+		s.epoch = 1
+	}
+	var (
+		layer = &f.layers[l]
+		ef    = max(k, f.efSearch)
+		minOf = func(a, b frozenCandidate) bool { return a.dist < b.dist }
+		maxOf = func(a, b frozenCandidate) bool { return a.dist > b.dist }
+	)
+	s.candidates = s.candidates[:0]
+	s.nearest = s.nearest[:0]
+
+	c := frozenCandidate{index: entry, dist: f.distance(f.vector(entry), target)}
+	s.visited[entry] = s.epoch
+	s.candidates = heapPush(s.candidates, c, minOf)
+	s.nearest = heapPush(s.nearest, c, maxOf)
+
+	for len(s.candidates) > 0 {
+		var current frozenCandidate
+		current, s.candidates = heapPop(s.candidates, minOf)
+		if len(s.nearest) == ef && current.dist > s.nearest[0].dist {
+			break
+		}
+		for _, neighbor := range layer.neighborsOf(current.index) {
+			if s.visited[neighbor] == s.epoch {
+				continue
+			}
+			s.visited[neighbor] = s.epoch
+
+			c := frozenCandidate{index: neighbor, dist: f.distance(f.vector(neighbor), target)}
+			switch {
+			case len(s.nearest) < ef:
+				s.nearest = heapPush(s.nearest, c, maxOf)
+			case c.dist < s.nearest[0].dist:
+				s.nearest[0] = c
+				heapDown(s.nearest, 0, maxOf)
+			default:
+				continue
+			}
+			s.candidates = heapPush(s.candidates, c, minOf)
+		}
+	}
+
+	slices.SortFunc(s.nearest, func(a, b frozenCandidate) int {
+		if c := cmp.Compare(a.dist, b.dist); c != 0 {
+			return c
+		}
+		return cmp.Compare(f.keys[a.index], f.keys[b.index])
+	})
+	return s.nearest[:min(k, len(s.nearest))]
+}
+
+// heapPush, heapPop and heapDown implement a binary heap ordered by less
+// on a slice. Unlike container/heap, they don't box elements, so they
+// don't allocate once the slice has grown.
+func heapPush[T any](h []T, x T, less func(a, b T) bool) []T {
+	h = append(h, x)
+	for i := len(h) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !less(h[i], h[parent]) {
+			break
+		}
+		h[i], h[parent] = h[parent], h[i]
+		i = parent
+	}
+	return h
+}
+
+func heapPop[T any](h []T, less func(a, b T) bool) (T, []T) {
+	x := h[0]
+	n := len(h) - 1
+	h[0] = h[n]
+	h = h[:n]
+	heapDown(h, 0, less)
+	return x, h
+}
+
+func heapDown[T any](h []T, i int, less func(a, b T) bool) {
+	for {
+		smallest := i
+		for _, child := range [2]int{2*i + 1, 2*i + 2} {
+			if child < len(h) && less(h[child], h[smallest]) {
+				smallest = child
+			}
+		}
+		if smallest == i {
+			return
+		}
+		h[i], h[smallest] = h[smallest], h[i]
+		i = smallest
+	}
+}
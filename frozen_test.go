@@ -0,0 +1,98 @@
+package hnsw
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_Freeze(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 1000; i++ {
+		g.Add(MakeNode(i, Vector{rng.Float32(), rng.Float32(), rng.Float32()}))
+	}
+	// Freed IDs are skipped.
+	for i := 0; i < 1000; i += 10 {
+		g.Delete(i)
+	}
+
+	f := g.Freeze()
+	require.Equal(t, g.Len(), f.Len())
+	require.Equal(t, g.Dims(), f.Dims())
+	for i := 0; i < 1000; i += 7 {
+		want, wantOK := g.Lookup(i)
+		got, ok := f.Lookup(i)
+		require.Equal(t, wantOK, ok)
+		require.Equal(t, want, got)
+	}
+
+	for i := 0; i < 100; i++ {
+		q := Vector{rng.Float32(), rng.Float32(), rng.Float32()}
+		require.Equal(t, g.SearchWithOptions(q, 10, SearchOptions{}), f.AppendSearch(nil, q, 10))
+	}
+
+	// The frozen graph doesn't change with the graph.
+	g.Add(MakeNode(2000, Vector{0.5, 0.5, 0.5}))
+	require.NotEqual(t, 2000, f.Search(Vector{0.5, 0.5, 0.5}, 1)[0].Key)
+
+	require.Zero(t, newTestGraph[int]().Freeze().Len())
+	require.Empty(t, newTestGraph[int]().Freeze().Search(Vector{1}, 1))
+}
+
+func TestFrozenGraph_AppendSearchAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool doesn't reuse memory reliably with the race detector")
+	}
+
+	g := newTestGraph[int]()
+	for i := 0; i < 1000; i++ {
+		g.Add(MakeNode(i, randFloats(3)))
+	}
+	f := g.Freeze()
+
+	var (
+		q   = Vector{0.1, 0.2, 0.3}
+		dst = make([]SearchResult[int], 0, 10)
+	)
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = f.AppendSearch(dst[:0], q, 10)
+	})
+	require.Zero(t, allocs)
+}
+
+func BenchmarkFrozenGraph_Search(b *testing.B) {
+	g := newTestGraph[int]()
+	for i := 0; i < 50000; i++ {
+		g.Add(MakeNode(i, randFloats(32)))
+	}
+	queries := make([]Vector, 256)
+	for i := range queries {
+		queries[i] = randFloats(32)
+	}
+
+	b.Run("Graph", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			g.SearchWithOptions(queries[i%len(queries)], 10, SearchOptions{})
+		}
+	})
+	for _, order := range []struct {
+		name string
+		ids  func() []uint32
+	}{
+		{"IDOrder", g.idOrder},
+		{"BFSOrder", g.bfsOrder},
+	} {
+		b.Run("Frozen/"+order.name, func(b *testing.B) {
+			f := g.freeze(order.ids())
+			dst := make([]SearchResult[int], 0, 10)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				dst = f.AppendSearch(dst[:0], queries[i%len(queries)], 10)
+			}
+		})
+	}
+}
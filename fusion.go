@@ -0,0 +1,244 @@
+package hnsw
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/coder/hnsw/heap"
+)
+
+// FusionStrategy determines how SearchMulti combines the results of
+// several queries. Unknown strategies are treated as FuseRRF.
+type FusionStrategy int
+
+const (
+	// FuseRRF ranks nodes by reciprocal rank fusion, summing 1/(60+rank)
+	// over the queries. It only depends on ranks, so it is robust to
+	// queries whose distances are on different scales.
+	FuseRRF FusionStrategy = iota
+
+	// FuseMeanScore ranks nodes by the mean of their scores across all
+	// queries.
+	FuseMeanScore
+)
+
+// rrfK dampens the contribution of top ranks in reciprocal rank fusion,
+// 60 is the value from the original paper.
+const rrfK = 60
+
+// multiCandidate is a node visited by searchMulti along with its distance
+// to each target.
+type multiCandidate struct {
+	node  *layerNode
+	dists []float32
+	// nearest is the distance to the closest target.
+	nearest float32
+}
+
+func (c multiCandidate) Less(o multiCandidate) bool {
+	return c.nearest < o.nearest
+}
+
+// searchMulti is like layerNode.search, but traverses the layer once from
+// the given entry points for several targets. Candidates are expanded in order of their distance to the
+// nearest target, and every visited node is measured against all targets so
+// that the visited set is shared. As in the original HNSW algorithm, the
+// traversal ends once the closest candidate is farther than the efSearch
+// nearest nodes of every target. It returns the union of the k nearest
+// nodes of each target.
+func searchMulti(
+	entries []*layerNode,
+	k int,
+	efSearch int,
+	targets []Vector,
+	distance DistanceFunc,
+) []multiCandidate {
+	var (
+		candidates = heap.Heap[multiCandidate]{}
+		// results holds the ef nearest nodes of each target, sorted by
+		// distance.
+		results = make([][]searchCandidate, len(targets))
+		visited = make(map[uint32]multiCandidate)
+		ef      = max(k, efSearch)
+	)
+
+	// inRange reports whether a node at the given distances is within
+	// the result set boundary of any target.
+	inRange := func(dists []float32) bool {
+		for i, d := range dists {
+			if len(results[i]) < ef || d <= results[i][len(results[i])-1].dist {
+				return true
+			}
+		}
+		return false
+	}
+
+	visit := func(node *layerNode) {
+		c := multiCandidate{node: node, dists: make([]float32, len(targets))}
+		for i, target := range targets {
+			d := distance(node.Value, target)
+			c.dists[i] = d
+			if i == 0 || d < c.nearest {
+				c.nearest = d
+			}
+
+			if len(results[i]) < ef || d < results[i][len(results[i])-1].dist {
+				j, _ := slices.BinarySearchFunc(results[i], d, func(c searchCandidate, d float32) int {
+					return cmp.Compare(c.dist, d)
+				})
+				results[i] = slices.Insert(results[i], j, searchCandidate{node: node, dist: d})
+				if len(results[i]) > ef {
+					results[i] = results[i][:ef]
+				}
+			}
+		}
+		visited[node.id] = c
+		candidates.Push(c)
+	}
+
+	for _, entry := range entries {
+		if _, ok := visited[entry.id]; !ok {
+			visit(entry)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		current := candidates.Pop()
+		// Termination condition: the closest remaining candidate is
+		// outside the result set boundary of every target.
+		if !inRange(current.dists) {
+			break
+		}
+		for _, neighbor := range current.node.neighbors {
+			if _, ok := visited[neighbor.id]; ok {
+				continue
+			}
+			visit(neighbor)
+		}
+	}
+
+	var (
+		out  []multiCandidate
+		seen bitset
+	)
+	for _, result := range results {
+		for _, c := range result[:min(k, len(result))] {
+			if seen.has(c.node.id) {
+				continue
+			}
+			seen.set(c.node.id)
+			out = append(out, visited[c.node.id])
+		}
+	}
+	return out
+}
+
+// SearchMulti finds the k nearest neighbors of several queries at once,
+// e.g. embeddings of multiple phrasings of the same question, and fuses
+// them into a single ranking using the given strategy.
+//
+// The base layer is traversed once for all queries, sharing the visited
+// set, which is cheaper than calling Search for each query.
+//
+// The Score of each result is the fused score normalized to [0, 1], and
+// its Distance is the mean distance to the queries. Results with equal
+// scores are ordered by key.
+func (h *Graph[K]) SearchMulti(queries []Vector, k int, fusion FusionStrategy) []SearchResult[K] {
+	if len(queries) == 0 || len(h.layers) == 0 || k <= 0 {
+		return nil
+	}
+	for _, q := range queries {
+		h.assertDims(q)
+	}
+
+	// Descend the upper layers separately for each query to find good
+	// entry points into the base layer.
+	entries := make([]*layerNode, len(queries))
+	for i, q := range queries {
+		var elevator *layerNode
+		for layer := len(h.layers) - 1; layer > 0; layer-- {
+			searchPoint := h.layers[layer].entry()
+			if elevator != nil {
+				searchPoint = h.layers[layer].nodes[elevator.id]
+			}
+			elevator = searchPoint.search(&searchParams{
+				k:        1,
+				efSearch: h.EfSearch,
+				target:   q,
+				distance: h.Distance,
+				maxDist:  noMaxDist,
+			})[0].node
+		}
+		if elevator == nil {
+			elevator = h.layers[0].entry()
+		} else {
+			elevator = h.layers[0].nodes[elevator.id]
+		}
+		entries[i] = elevator
+	}
+
+	candidates := searchMulti(entries, k, h.EfSearch, queries, h.Distance)
+
+	score := h.Score
+	if score == nil {
+		score = ScoreFuncFor(h.Distance)
+	}
+
+	fused := make([]float32, len(candidates))
+	switch fusion {
+	case FuseMeanScore:
+		for i, c := range candidates {
+			for _, d := range c.dists {
+				fused[i] += score(d)
+			}
+			fused[i] /= float32(len(queries))
+		}
+	default:
+		// FuseRRF and unknown strategies. Nodes at equal distances are
+		// ranked by key.
+		order := make([]int, len(candidates))
+		for q := range queries {
+			for i := range order {
+				order[i] = i
+			}
+			slices.SortFunc(order, func(a, b int) int {
+				if c := cmp.Compare(candidates[a].dists[q], candidates[b].dists[q]); c != 0 {
+					return c
+				}
+				return cmp.Compare(h.keys[candidates[a].node.id], h.keys[candidates[b].node.id])
+			})
+			for rank, i := range order {
+				fused[i] += 1 / float32(rrfK+rank+1)
+			}
+		}
+		// The best possible fused score is being ranked first for every
+		// query.
+		best := float32(len(queries)) / (rrfK + 1)
+		for i := range fused {
+			fused[i] /= best
+		}
+	}
+
+	out := make([]SearchResult[K], len(candidates))
+	for i, c := range candidates {
+		var sum float32
+		for _, d := range c.dists {
+			sum += d
+		}
+		out[i] = SearchResult[K]{
+			Node:     h.node(c.node),
+			Distance: sum / float32(len(queries)),
+			Score:    fused[i],
+		}
+	}
+	slices.SortFunc(out, func(a, b SearchResult[K]) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
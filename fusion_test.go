@@ -0,0 +1,48 @@
+package hnsw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_SearchMulti(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+
+	keys := func(results []SearchResult[int]) []int {
+		var out []int
+		for _, r := range results {
+			out = append(out, r.Key)
+		}
+		return out
+	}
+
+	// Ties are ordered by key.
+	results := g.SearchMulti([]Vector{{10}, {11}}, 2, FuseMeanScore)
+	require.Equal(t, []int{10, 11}, keys(results))
+	require.InDelta(t, 0.75, results[0].Score, 1e-6)
+	require.InDelta(t, 0.5, results[0].Distance, 1e-6)
+
+	results = g.SearchMulti([]Vector{{10}, {100}}, 2, FuseRRF)
+	require.Equal(t, []int{10, 100}, keys(results))
+	for _, r := range results {
+		require.Greater(t, r.Score, float32(0))
+		require.LessOrEqual(t, r.Score, float32(1))
+	}
+
+	results = g.SearchMulti([]Vector{{42}}, 3, FuseRRF)
+	require.Equal(t, 42, results[0].Key)
+	require.ElementsMatch(t, []int{41, 42, 43}, keys(results))
+	require.InDelta(t, 1, results[0].Score, 1e-6)
+
+	// Unknown strategies fall back to FuseRRF.
+	require.Equal(t, results, g.SearchMulti([]Vector{{42}}, 3, FusionStrategy(-1)))
+
+	require.Nil(t, g.SearchMulti(nil, 3, FuseRRF))
+	require.Nil(t, g.SearchMulti([]Vector{{42}}, 0, FuseRRF))
+}
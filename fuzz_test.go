@@ -0,0 +1,83 @@
+package hnsw
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// FuzzGraph applies a random sequence of operations to a graph with
+// DebugChecks enabled, so that any broken invariant or panic fails.
+//
+// Each operation is encoded as two bytes: an opcode and an operand that
+// selects the key, which keeps the key space small enough for deletes and
+// replacements to hit existing nodes.
+func FuzzGraph(f *testing.F) {
+	f.Add([]byte{0, 1, 0, 2, 0, 3, 1, 2, 2, 0})
+	f.Add([]byte{0, 1, 0, 1, 0, 1, 1, 1, 0, 1, 3, 0})
+	f.Add([]byte{
+		0, 0, 0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 0, 7,
+		1, 0, 1, 2, 1, 4, 1, 6, 2, 3, 3, 0, 1, 1, 2, 9,
+	})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		g := newTestGraph[int]()
+		g.M = 4
+		g.DebugChecks = true
+
+		present := make(map[int]bool)
+		for i := 0; i+1 < len(ops); i += 2 {
+			key := int(ops[i+1] % 32)
+			// Derive the vector from the operation's position so that
+			// replacements move nodes around.
+			vec := Vector{float32(key), float32(i % 7)}
+
+			switch ops[i] % 5 {
+			case 0:
+				g.Add(MakeNode(key, vec))
+				present[key] = true
+			case 1:
+				require.Equal(t, present[key], g.Delete(key))
+				delete(present, key)
+			case 2:
+				k := int(ops[i+1]%8) + 1
+				results := g.Search(vec, k)
+				require.LessOrEqual(t, len(results), k)
+				if len(present) > 0 {
+					require.NotEmpty(t, results)
+				}
+				for _, result := range results {
+					require.True(t, present[result.Key], "search returned deleted key %v", result.Key)
+				}
+			case 3:
+				var buf bytes.Buffer
+				require.NoError(t, g.Export(&buf))
+
+				imported := &Graph[int]{DebugChecks: true}
+				require.NoError(t, imported.Import(&buf))
+				require.NoError(t, imported.checkInvariants())
+				require.Equal(t, g.Len(), imported.Len())
+				require.Equal(t, g.Tombstones(), imported.Tombstones())
+				g = imported
+			case 4:
+				next := (key + 1) % 32
+				want := 0
+				for _, k := range []int{key, next} {
+					if present[k] {
+						want++
+						delete(present, k)
+					}
+				}
+				require.Equal(t, want, g.BatchDelete(key, next))
+			}
+		}
+
+		require.Equal(t, len(present), g.Len())
+		require.NoError(t, g.checkInvariants())
+		for key := range present {
+			_, ok := g.Lookup(key)
+			require.True(t, ok, "key %v is missing", key)
+		}
+	})
+}
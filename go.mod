@@ -4,12 +4,14 @@ go 1.21.4
 
 require github.com/stretchr/testify v1.9.0
 
-require github.com/google/renameio v1.0.1
+require (
+	github.com/google/renameio v1.0.1
+	github.com/viterin/vek v0.4.2
+)
 
 require (
 	github.com/chewxy/math32 v1.10.1 // indirect
 	github.com/viterin/partial v1.1.0 // indirect
-	github.com/viterin/vek v0.4.2 // indirect
 	golang.org/x/sys v0.11.0 // indirect
 )
 
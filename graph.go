@@ -2,14 +2,18 @@ package hnsw
 
 import (
 	"cmp"
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"log/slog"
+	"maps"
 	"math"
 	"math/rand"
 	"slices"
 	"time"
 
 	"github.com/coder/hnsw/heap"
-	"golang.org/x/exp/maps"
 )
 
 type Vector = []float32
@@ -24,178 +28,439 @@ func MakeNode[K cmp.Ordered](key K, vec Vector) Node[K] {
 	return Node[K]{Key: key, Value: vec}
 }
 
+// SplitVectors returns views of consecutive vectors with dims dimensions
+// in buf, without copying, e.g. to pass embeddings from a contiguous
+// buffer to AddRef. The capacity of each view is limited to its length,
+// so that appending to one view never overwrites the next.
+// It panics if len(buf) is not a multiple of dims.
+func SplitVectors(buf []float32, dims int) []Vector {
+	if dims <= 0 || len(buf)%dims != 0 {
+		panic(fmt.Sprintf("buffer of length %d does not hold vectors of %d dimensions", len(buf), dims))
+	}
+	vecs := make([]Vector, len(buf)/dims)
+	for i := range vecs {
+		vecs[i] = buf[i*dims : (i+1)*dims : (i+1)*dims]
+	}
+	return vecs
+}
+
 // layerNode is a node in a layer of the graph.
-type layerNode[K cmp.Ordered] struct {
-	Node[K]
+type layerNode struct {
+	// id is the dense internal ID of the node, shared by all of its
+	// layers. The key is kept once per graph in Graph.keys.
+	id    uint32
+	Value Vector
 
-	// neighbors is map of neighbor keys to neighbor nodes.
-	// It is a map and not a slice to allow for efficient deletes, esp.
-	// when M is high.
-	neighbors map[K]*layerNode[K]
+	// neighbors holds the neighbor nodes sorted by ID. A sorted slice
+	// costs a fraction of the memory of a map, is cheap to iterate in a
+	// deterministic order, and still finds neighbors in O(log M).
+	neighbors []*layerNode
 }
 
-// addNeighbor adds a o neighbor to the node, replacing the neighbor
-// with the worst distance if the neighbor set is full.
-func (n *layerNode[K]) addNeighbor(newNode *layerNode[K], m int, dist DistanceFunc) {
+// neighborIndex returns the position of the neighbor with the given ID,
+// or where it would be inserted, and whether it's present.
+func (n *layerNode) neighborIndex(id uint32) (int, bool) {
+	return slices.BinarySearchFunc(n.neighbors, id, func(o *layerNode, id uint32) int {
+		return cmp.Compare(o.id, id)
+	})
+}
+
+// hasNeighbor reports whether the node has a neighbor with the given ID.
+func (n *layerNode) hasNeighbor(id uint32) bool {
+	_, ok := n.neighborIndex(id)
+	return ok
+}
+
+// sharesNeighbor reports whether the node and o have a neighbor in common.
+func (n *layerNode) sharesNeighbor(o *layerNode) bool {
+	// Both neighbor lists are sorted by ID.
+	a, b := n.neighbors, o.neighbors
+	for len(a) > 0 && len(b) > 0 {
+		switch c := cmp.Compare(a[0].id, b[0].id); {
+		case c < 0:
+			a = a[1:]
+		case c > 0:
+			b = b[1:]
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// edgeDelta counts the edges created and removed by an operation on
+// the graph.
+type edgeDelta struct {
+	added, removed int
+}
+
+func (d *edgeDelta) add(o edgeDelta) {
+	d.added += o.added
+	d.removed += o.removed
+}
+
+// link adds o to the neighbors of the node in one direction, and reports
+// whether it wasn't a neighbor already.
+func (n *layerNode) link(o *layerNode, m int) bool {
+	i, ok := n.neighborIndex(o.id)
+	if ok {
+		return false
+	}
 	if n.neighbors == nil {
-		n.neighbors = make(map[K]*layerNode[K], m)
+		// One extra slot for the neighbor that is about to be evicted.
+		n.neighbors = make([]*layerNode, 0, m+1)
 	}
+	n.neighbors = slices.Insert(n.neighbors, i, o)
+	return true
+}
 
-	n.neighbors[newNode.Key] = newNode
+// unlink removes the neighbor with the given ID in one direction, and
+// reports whether it was a neighbor.
+func (n *layerNode) unlink(id uint32) bool {
+	i, ok := n.neighborIndex(id)
+	if ok {
+		n.neighbors = slices.Delete(n.neighbors, i, i+1)
+	}
+	return ok
+}
+
+// addNeighbor connects the node and newNode in both directions, replacing
+// the neighbor with the worst distance on either side if its neighbor set is
+// full.
+//
+// Edges are kept bidirectional so that isolate can find every node that
+// refers to a deleted node.
+func (n *layerNode) addNeighbor(newNode *layerNode, m int, dist DistanceFunc) edgeDelta {
+	var d edgeDelta
+	// Edges are bidirectional, so count each once.
+	forward := n.link(newNode, m)
+	if newNode.link(n, m) || forward {
+		d.added++
+	}
+
+	d.add(n.evictWorst(m, dist))
+	d.add(newNode.evictWorst(m, dist))
+	return d
+}
+
+// evictWorst removes the neighbor with the worst distance if the node has
+// more than m neighbors.
+//
+// Neighbors that share a neighbor with the node are evicted first, as they
+// stay connected to it through that neighbor. Evicting the only edge
+// between two groups of nodes would split the graph.
+func (n *layerNode) evictWorst(m int, dist DistanceFunc) edgeDelta {
 	if len(n.neighbors) <= m {
-		return
+		return edgeDelta{}
 	}
 
-	// Find the neighbor with the worst distance.
+	// Find the neighbor with the worst distance, preferring shared ones.
 	var (
 		worstDist = float32(math.Inf(-1))
-		worst     *layerNode[K]
+		worst     *layerNode
+		shared    bool
 	)
 	for _, neighbor := range n.neighbors {
 		d := dist(neighbor.Value, n.Value)
+		s := n.sharesNeighbor(neighbor)
 		// d > worstDist may always be false if the distance function
 		// returns NaN, e.g., when the embeddings are zero.
-		if d > worstDist || worst == nil {
+		if worst == nil || s && !shared || s == shared && d > worstDist {
 			worstDist = d
 			worst = neighbor
+			shared = s
 		}
 	}
 
-	delete(n.neighbors, worst.Key)
+	n.unlink(worst.id)
 	// Delete backlink from the worst neighbor.
-	delete(worst.neighbors, n.Key)
-	worst.replenish(m)
+	worst.unlink(n.id)
+	d := edgeDelta{removed: 1}
+	d.add(worst.replenish(m, dist))
+	return d
 }
 
-type searchCandidate[K cmp.Ordered] struct {
-	node *layerNode[K]
+type searchCandidate struct {
+	node *layerNode
 	dist float32
 }
 
-func (s searchCandidate[K]) Less(o searchCandidate[K]) bool {
+func (s searchCandidate) Less(o searchCandidate) bool {
 	return s.dist < o.dist
 }
 
-// search returns the layer node closest to the target node
-// within the same layer.
-func (n *layerNode[K]) search(
+// stopCheckInterval is the number of candidates search expands between
+// calls to stop, which may be comparatively expensive.
+const stopCheckInterval = 16
+
+// searchParams configures layerNode.search.
+type searchParams struct {
 	// k is the number of candidates in the result set.
-	k int,
-	efSearch int,
-	target Vector,
-	distance DistanceFunc,
-) []searchCandidate[K] {
-	// This is a basic greedy algorithm to find the entry point at the given level
-	// that is closest to the target node.
-	candidates := heap.Heap[searchCandidate[K]]{}
-	candidates.Init(make([]searchCandidate[K], 0, efSearch))
-	candidates.Push(
-		searchCandidate[K]{
-			node: n,
-			dist: distance(n.Value, target),
-		},
-	)
+	k        int
+	efSearch int
+	target   Vector
+	distance DistanceFunc
+	// maxDist excludes farther nodes from the result set. They are still
+	// traversed since they may lead to closer nodes. Searches without a
+	// limit set it to noMaxDist.
+	maxDist float32
+	// allow, if not nil, reports whether a node may be in the result set.
+	// Other nodes are still traversed.
+	allow func(id uint32) bool
+	// explore, if not nil, is consulted whenever the search would stop.
+	// When it returns true, the next candidate is expanded anyway.
+	explore func() bool
+	// stop, if not nil, is consulted periodically. When it returns true,
+	// the search returns the best nodes found so far.
+	stop func() bool
+	// lowMem bounds the memory of the search by ef, see
+	// Graph.LowMemorySearch.
+	lowMem bool
+	// stats, if not nil, is updated with the work done.
+	stats *searchStats
+}
+
+// search returns the p.k layer nodes closest to p.target within the same
+// layer, closest first.
+func (n *layerNode) search(p *searchParams) []searchCandidate {
+	// This is the beam search of the original HNSW paper: candidates are
+	// expanded closest first, and the ef nearest nodes seen so far are
+	// kept in a bounded heap whose worst element bounds the search.
 	var (
-		result  = heap.Heap[searchCandidate[K]]{}
-		visited = make(map[K]bool)
+		ef         = max(p.k, p.efSearch)
+		candidates = heap.Heap[searchCandidate]{}
+		nearest    = heap.NewBounded[searchCandidate](ef)
+		visited    visitedSet
+
+		maxExpanded = -1
 	)
-	result.Init(make([]searchCandidate[K], 0, k))
+	candidates.Init(make([]searchCandidate, 0, ef))
+	if p.lowMem {
+		visited.lossy = newLossySet(lowMemVisited * ef)
+		maxExpanded = lowMemExpanded * ef
+	}
+
+	entry := searchCandidate{node: n, dist: p.distance(n.Value, p.target)}
+	p.stats.add(entry.dist)
+	candidates.Push(entry)
+	if p.allow == nil || p.allow(n.id) {
+		nearest.Push(entry)
+	}
+	visited.set(n.id)
 
-	// Begin with the entry node in the result set.
-	result.Push(candidates.Min())
-	visited[n.Key] = true
+	for expanded := 0; candidates.Len() > 0 && expanded != maxExpanded; expanded++ {
+		if p.stop != nil && expanded%stopCheckInterval == 0 && p.stop() {
+			break
+		}
 
-	for candidates.Len() > 0 {
 		var (
-			current  = candidates.Pop().node
-			improved = false
+			current   = candidates.Pop()
+			exploring = false
 		)
 
-		// We iterate the map in a sorted, deterministic fashion for
-		// tests.
-		neighborKeys := maps.Keys(current.neighbors)
-		slices.Sort(neighborKeys)
-		for _, neighborID := range neighborKeys {
-			neighbor := current.neighbors[neighborID]
-			if visited[neighborID] {
+		// Termination condition: the closest remaining candidate is
+		// farther than every node in the full result set.
+		if nearest.Full() && current.dist > nearest.Max().dist {
+			if p.explore == nil || !p.explore() {
+				break
+			}
+			// Expand a non-improving candidate to escape a
+			// local minimum, following all of its neighbors.
+			exploring = true
+		}
+
+		// Neighbors are sorted by ID, so iteration is deterministic
+		// for tests.
+		for _, neighbor := range current.node.neighbors {
+			if visited.has(neighbor.id) {
 				continue
 			}
-			visited[neighborID] = true
-
-			dist := distance(neighbor.Value, target)
-			improved = improved || dist < result.Min().dist
-			if result.Len() < k {
-				result.Push(searchCandidate[K]{node: neighbor, dist: dist})
-			} else if dist < result.Max().dist {
-				result.PopLast()
-				result.Push(searchCandidate[K]{node: neighbor, dist: dist})
+			visited.set(neighbor.id)
+
+			c := searchCandidate{node: neighbor, dist: p.distance(neighbor.Value, p.target)}
+			p.stats.add(c.dist)
+			if p.allow != nil && !p.allow(neighbor.id) {
+				// Disallowed nodes may lead to allowed ones closer than
+				// the result set.
+				if !nearest.Full() || c.dist < nearest.Max().dist || exploring {
+					candidates.Push(c)
+				}
+			} else if p.lowMem && containsNode(nearest.Slice(), neighbor) {
+				// Forgotten by visited, but already in the result set.
+				continue
+			} else if nearest.Push(c) || exploring {
+				candidates.Push(c)
 			}
-
-			candidates.Push(searchCandidate[K]{node: neighbor, dist: dist})
-			// Always store candidates if we haven't reached the limit.
-			if candidates.Len() > efSearch {
-				candidates.PopLast()
+			if p.lowMem && candidates.Len() > ef {
+				candidates.PopMax()
 			}
 		}
+		p.stats.expand(candidates.Len())
+	}
 
-		// Termination condition: no improvement in distance and at least
-		// kMin candidates in the result set.
-		if !improved && result.Len() >= k {
+	// Nodes beyond maxDist were only useful for traversal.
+	result := nearest.Sorted()
+	for i, c := range result {
+		if c.dist > p.maxDist {
+			result = result[:i]
 			break
 		}
 	}
-
-	return result.Slice()
+	return result[:min(p.k, len(result))]
 }
 
-func (n *layerNode[K]) replenish(m int) {
+// replenish restores connectivity after the node lost a neighbor by
+// linking it to neighbors of its neighbors that have spare capacity.
+func (n *layerNode) replenish(m int, dist DistanceFunc) edgeDelta {
+	var d edgeDelta
 	if len(n.neighbors) >= m {
-		return
+		return d
 	}
 
-	// Restore connectivity by adding new neighbors.
 	// This is a naive implementation that could be improved by
 	// using a priority queue to find the best candidates.
-	for _, neighbor := range n.neighbors {
-		for key, candidate := range neighbor.neighbors {
-			if _, ok := n.neighbors[key]; ok {
-				// do not add duplicates
+	//
+	// Adding neighbors reorders n.neighbors, so iterate over a copy.
+	for _, neighbor := range slices.Clone(n.neighbors) {
+		for _, candidate := range neighbor.neighbors {
+			if candidate == n || len(candidate.neighbors) >= m {
+				// Linking to a full candidate would evict one of its
+				// neighbors, which can cascade indefinitely.
 				continue
 			}
-			if candidate == n {
+			if n.hasNeighbor(candidate.id) {
+				// do not add duplicates
 				continue
 			}
-			n.addNeighbor(candidate, m, CosineDistance)
+			d.add(n.addNeighbor(candidate, m, dist))
 			if len(n.neighbors) >= m {
-				return
+				return d
 			}
 		}
 	}
+	return d
+}
+
+// keepPruned links an under-full new node to the nearest candidates of
+// its insertion that have room for another neighbor, so that linking
+// doesn't evict any edge. candidates are sorted by distance.
+func (n *layerNode) keepPruned(candidates []searchCandidate, m int, dist DistanceFunc) edgeDelta {
+	var d edgeDelta
+	for _, c := range candidates {
+		if len(n.neighbors) >= m {
+			break
+		}
+		if len(c.node.neighbors) >= m || n.hasNeighbor(c.node.id) {
+			continue
+		}
+		d.add(n.addNeighbor(c.node, m, dist))
+	}
+	return d
+}
+
+// repair is a more thorough replenish used after a neighbor was deleted.
+// Candidates are tried closest first, and a full candidate accepts the node
+// by displacing a farther neighbor, which is then replenished in turn.
+//
+// deleted is the neighbor list of the deleted node, if known. Its members
+// were connected through the deleted node, so they are candidates too.
+func (n *layerNode) repair(m int, dist DistanceFunc, deleted []*layerNode) edgeDelta {
+	var d edgeDelta
+	if len(n.neighbors) >= m {
+		return d
+	}
+
+	var (
+		candidates []searchCandidate
+		seen       bitset
+	)
+	consider := func(candidate *layerNode) {
+		if n.hasNeighbor(candidate.id) {
+			// do not add duplicates
+			return
+		}
+		if candidate == n || seen.has(candidate.id) {
+			return
+		}
+		seen.set(candidate.id)
+		candidates = append(candidates, searchCandidate{
+			node: candidate,
+			dist: dist(candidate.Value, n.Value),
+		})
+	}
+	for _, neighbor := range n.neighbors {
+		for _, candidate := range neighbor.neighbors {
+			consider(candidate)
+		}
+	}
+	for _, candidate := range deleted {
+		consider(candidate)
+	}
+	slices.SortFunc(candidates, func(a, b searchCandidate) int {
+		return cmp.Compare(a.dist, b.dist)
+	})
+
+	for _, candidate := range candidates {
+		if n.hasNeighbor(candidate.node.id) {
+			// Linked by a replenishment in the meantime.
+			continue
+		}
+		if len(candidate.node.neighbors) >= m && !candidate.node.prefers(candidate.dist, dist) {
+			continue
+		}
+		d.add(n.addNeighbor(candidate.node, m, dist))
+		if len(n.neighbors) >= m {
+			return d
+		}
+	}
+	return d
+}
+
+// prefers reports whether a node at distance d would be closer to the node
+// than its worst neighbor.
+func (n *layerNode) prefers(d float32, dist DistanceFunc) bool {
+	for _, neighbor := range n.neighbors {
+		if dist(neighbor.Value, n.Value) > d {
+			return true
+		}
+	}
+	return false
+}
+
+// detach removes the backlinks of all neighbors to the node, making it
+// unreachable. The node's own neighbor list is kept.
+func (n *layerNode) detach() {
+	for _, neighbor := range n.neighbors {
+		neighbor.unlink(n.id)
+	}
 }
 
 // isolates remove the node from the graph by removing all connections
-// to neighbors.
-func (n *layerNode[K]) isolate(m int) {
+// to neighbors. The returned delta covers the edges changed by repairing
+// the neighborhood, not the node's own edges.
+func (n *layerNode) isolate(m int, dist DistanceFunc) edgeDelta {
+	n.detach()
+	// Only repair once the node is unreachable, otherwise
+	// replenishment may reconnect neighbors to the removed node.
+	var d edgeDelta
 	for _, neighbor := range n.neighbors {
-		delete(neighbor.neighbors, n.Key)
-		neighbor.replenish(m)
+		d.add(neighbor.repair(m, dist, n.neighbors))
 	}
+	return d
 }
 
-type layer[K cmp.Ordered] struct {
+type layer struct {
 	// nodes is a map of nodes IDs to nodes.
 	// All nodes in a higher layer are also in the lower layers, an essential
 	// property of the graph.
-	//
-	// nodes is exported for interop with encoding/gob.
-	nodes map[K]*layerNode[K]
+	nodes map[uint32]*layerNode
 }
 
 // entry returns the entry node of the layer.
 // It doesn't matter which node is returned, even that the
 // entry node is consistent, so we just return the first node
 // in the map to avoid tracking extra state.
-func (l *layer[K]) entry() *layerNode[K] {
+func (l *layer) entry() *layerNode {
 	if l == nil {
 		return nil
 	}
@@ -205,7 +470,7 @@ func (l *layer[K]) entry() *layerNode[K] {
 	return nil
 }
 
-func (l *layer[K]) size() int {
+func (l *layer) size() int {
 	if l == nil {
 		return 0
 	}
@@ -220,12 +485,15 @@ type Graph[K cmp.Ordered] struct {
 	Distance DistanceFunc
 
 	// Rng is used for level generation. It may be set to a deterministic value
-	// for reproducibility. Note that deterministic number generation can lead to
-	// degenerate graphs when exposed to adversarial inputs.
+	// for reproducibility, or wrap any rand.Source with rand.New. Note that
+	// deterministic number generation can lead to degenerate graphs when
+	// exposed to adversarial inputs. If nil, each graph gets its own
+	// generator seeded from crypto/rand.
 	Rng *rand.Rand
 
 	// M is the maximum number of neighbors to keep for each node.
-	// A good default for OpenAI embeddings is 16.
+	// A good default for OpenAI embeddings is 16. See RecommendParams for
+	// deriving M, Ml and EfSearch from the expected workload.
 	M int
 
 	// Ml is the level generation factor.
@@ -237,12 +505,134 @@ type Graph[K cmp.Ordered] struct {
 	// the expense of memory.
 	EfSearch int
 
+	// Score converts distances into the SearchResult.Score of search
+	// results. If nil, a default for the distance function is used, see
+	// ScoreFuncFor. It is not persisted by Export.
+	Score ScoreFunc
+
+	// DeferRepair makes Delete only remove the edges of deleted nodes, and
+	// queue their former neighbors for Repair instead of replenishing
+	// their neighborhoods right away. This bounds the latency of deletes
+	// at the cost of lower recall until the queue is worked off, see
+	// RepairInBackground.
+	DeferRepair bool
+
+	// KeepPrunedConnections makes Add fill up the neighbors of a new node
+	// that ended up with fewer than M, because full neighbors pruned
+	// their edge to it, with the next nearest candidates found while
+	// inserting that have room for another neighbor. This keeps nodes
+	// connected under heavy churn, at the cost of slightly slower
+	// inserts. It is not persisted by Export.
+	KeepPrunedConnections bool
+
+	// ExactBelow makes searches of graphs with fewer nodes compare the
+	// query with every node instead of traversing the graph, so that
+	// small graphs, where a scan is cheap, return exact results rather
+	// than approximate ones. Zero disables it. See Filter.ScanBelow for
+	// filtered searches that allow few nodes. It is not persisted by
+	// Export.
+	ExactBelow int
+
+	// LowMemorySearch bounds the memory of searches by EfSearch instead
+	// of the size of the graph, for devices with little RAM. Searches
+	// then keep at most EfSearch candidates, remember a fixed number of
+	// visited nodes and expand a fixed number of candidates, so they may
+	// revisit nodes and miss some that a regular search finds. It
+	// applies to searches, not to inserts.
+	LowMemorySearch bool
+
+	// KeyCoder encodes keys for Export and Import. If nil,
+	// DefaultKeyCoder is used. Exported graphs must be imported with a
+	// compatible KeyCoder.
+	KeyCoder KeyCoder[K]
+
+	// Logger, if set, receives warnings about signs of degradation of the
+	// graph, such as NaN distances or nodes left without neighbors by
+	// deletes, which otherwise go unnoticed until recall drops. It is not
+	// persisted by Export.
+	Logger *slog.Logger
+
+	// Tracer, if set, receives a span for each Add, Search, Import and
+	// Export. It is not persisted by Export.
+	Tracer Tracer
+
+	// Journal, if set, records every node added and deleted. It is not
+	// persisted by Export.
+	Journal *Journal[K]
+
+	// CopyVectors makes Add copy the vectors of added nodes, so that the
+	// caller may reuse their memory afterwards. By default, the graph
+	// references the vectors. See AddRef.
+	CopyVectors bool
+
+	// DebugChecks makes Add and Delete verify the structural invariants
+	// of the graph after every node, panicking with a description of the
+	// first violation. It is meant for tests and development, as each
+	// check walks the whole graph.
+	DebugChecks bool
+
 	// layers is a slice of layers in the graph.
-	layers []*layer[K]
+	layers []*layer
+
+	// ids maps keys to dense internal IDs, and keys maps them back.
+	// IDs of deleted nodes are kept in free and reused by later inserts
+	// so that the ID space stays dense.
+	ids  map[K]uint32
+	keys []K
+	free []uint32
+
+	// timestamps holds the Unix nanoseconds set by SetTimestamp by ID,
+	// or 0 if unset, boosts the boosts set by SetBoost, and fields the
+	// fields set by SetField by name and ID, or NaN if unset.
+	timestamps []int64
+	boosts     []float32
+	fields     map[string][]float32
+
+	// distance is the configuration of Distance set by SetDistance, if
+	// Distance hasn't been replaced since.
+	distance struct {
+		name    string
+		context []byte
+		fn      DistanceFunc
+	}
+
+	// seq is incremented by every mutation. tombstones maps deleted keys
+	// to the sequence number of their deletion, so that consumers merging
+	// snapshots don't resurrect them.
+	seq        uint64
+	tombstones map[K]uint64
+
+	// added holds the sequence number of the add of each node by ID, so
+	// that ApplyTombstones doesn't delete nodes added after the delete.
+	added []uint64
+
+	// lastKey is the last key allocated by NextKey.
+	lastKey uint64
+
+	// sortedKeys caches the keys in ascending order for KeysInRange. It
+	// is nil when stale.
+	sortedKeys []K
+
+	// pending holds the nodes queued for repair by DeferRepair.
+	pending []pendingRepair
+
+	// dirty holds the keys added or deleted since SavedGraph last saved.
+	// Changes are only tracked while it is non-nil.
+	dirty map[K]struct{}
+
+	// changes holds the keys of the latest mutations, for QueryCache.
+	changes changeLog[K]
 }
 
+// defaultRand returns a generator seeded independently of those of other
+// graphs, even ones created at the same instant.
 func defaultRand() *rand.Rand {
-	return rand.New(rand.NewSource(time.Now().UnixNano()))
+	var seed [8]byte
+	if _, err := crand.Read(seed[:]); err != nil {
+		// crypto/rand only fails on broken systems.
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
 }
 
 // NewGraph returns a new graph with default parameters, roughly designed for
@@ -307,7 +697,7 @@ func (g *Graph[K]) assertDims(n Vector) {
 	}
 	hasDims := g.Dims()
 	if hasDims != len(n) {
-		panic(fmt.Sprint("embedding dimension mismatch: ", hasDims, " != ", len(n)))
+		panic(fmt.Errorf("embedding has %w", &DimensionError{Want: hasDims, Got: len(n)}))
 	}
 }
 
@@ -320,130 +710,648 @@ func (g *Graph[K]) Dims() int {
 	return len(g.layers[0].entry().Value)
 }
 
-func ptr[T any](v T) *T {
-	return &v
+// allocID returns the internal ID for a new node with the given key.
+func (g *Graph[K]) allocID(key K) uint32 {
+	if g.ids == nil {
+		g.ids = make(map[K]uint32)
+	}
+
+	var id uint32
+	if n := len(g.free); n > 0 {
+		id = g.free[n-1]
+		g.free = g.free[:n-1]
+		g.keys[id] = key
+	} else {
+		if len(g.keys) > math.MaxUint32 {
+			panic("graph has too many nodes")
+		}
+		id = uint32(len(g.keys))
+		g.keys = append(g.keys, key)
+	}
+	g.ids[key] = id
+	if n := len(g.sortedKeys); n > 0 && g.sortedKeys[n-1] < key {
+		// Keys that grow, e.g. prefixed by a timestamp, keep the cache.
+		g.sortedKeys = append(g.sortedKeys, key)
+	} else {
+		g.sortedKeys = nil
+	}
+	return id
+}
+
+// setAdded records the sequence number of the add of a node.
+func (g *Graph[K]) setAdded(id uint32, seq uint64) {
+	if int(id) >= len(g.added) {
+		g.added = append(g.added, make([]uint64, len(g.keys)-len(g.added))...)
+	}
+	g.added[id] = seq
+}
+
+// releaseID frees the internal ID of a deleted key.
+func (g *Graph[K]) releaseID(key K) {
+	id, ok := g.ids[key]
+	if !ok {
+		return
+	}
+	delete(g.ids, key)
+	g.sortedKeys = nil
+
+	var zero K
+	g.keys[id] = zero
+	if int(id) < len(g.timestamps) {
+		g.timestamps[id] = 0
+	}
+	if int(id) < len(g.boosts) {
+		g.boosts[id] = 0
+	}
+	if int(id) < len(g.added) {
+		g.added[id] = 0
+	}
+	for _, values := range g.fields {
+		if int(id) < len(values) {
+			values[id] = float32(math.NaN())
+		}
+	}
+	g.free = append(g.free, id)
+}
+
+// ID returns the dense internal ID of a key.
+//
+// IDs are assigned on insert, are unique among the nodes in the graph, and
+// are preserved by Export and Import. The ID of a deleted key may be reused
+// by a later insert.
+func (g *Graph[K]) ID(key K) (uint32, bool) {
+	id, ok := g.ids[key]
+	return id, ok
+}
+
+// Key returns the key for an internal ID as returned by ID.
+func (g *Graph[K]) Key(id uint32) (K, bool) {
+	var zero K
+	if int(id) >= len(g.keys) {
+		return zero, false
+	}
+	key := g.keys[id]
+	if cur, ok := g.ids[key]; !ok || cur != id {
+		return zero, false
+	}
+	return key, true
+}
+
+// node returns the Node for a layer node.
+func (g *Graph[K]) node(n *layerNode) Node[K] {
+	return Node[K]{Key: g.keys[n.id], Value: n.Value}
 }
 
 // Add inserts nodes into the graph.
 // If another node with the same ID exists, it is replaced.
+//
+// Unless CopyVectors is set, the graph references the vectors of the
+// nodes as AddRef does.
+//
+// Seq then returns the sequence number of the last node added.
 func (g *Graph[K]) Add(nodes ...Node[K]) {
+	end := g.startSpan(context.Background(), "Add")
+	g.add(nodes, g.CopyVectors, "Add")
+	end(nil, slog.Int("nodes", len(nodes)), slog.Int("len", g.Len()))
+}
+
+// AddRef is like Add, but the graph always references the vectors of
+// the nodes instead of copying them, even if CopyVectors is set. This
+// avoids doubling memory when the vectors already live in a large buffer,
+// e.g. one that is memory-mapped or from Arrow, see SplitVectors.
+//
+// The caller transfers ownership of the vectors to the graph: they must
+// not be modified while their node is in the graph, and the backing
+// memory must stay valid until then. Vectors returned by Lookup and
+// Search share the same memory.
+func (g *Graph[K]) AddRef(nodes ...Node[K]) {
+	end := g.startSpan(context.Background(), "AddRef")
+	g.add(nodes, false, "AddRef")
+	end(nil, slog.Int("nodes", len(nodes)), slog.Int("len", g.Len()))
+}
+
+func (g *Graph[K]) add(nodes []Node[K], copyVectors bool, op string) {
 	for _, node := range nodes {
 		key := node.Key
 		vec := node.Value
+		if copyVectors {
+			vec = slices.Clone(vec)
+		}
 
 		g.assertDims(vec)
-		insertLevel := g.randomLevel()
-		// Create layers that don't exist yet.
-		for insertLevel >= len(g.layers) {
-			g.layers = append(g.layers, &layer[K]{})
-		}
+		// Replace any existing node with the same key.
+		g.delete(key, nil)
+		delete(g.tombstones, key)
+		g.seq++
+		g.markDirty(key)
+		g.journal(g.seq, JournalAdd, key)
+
+		id := g.allocID(key)
+		g.setAdded(id, g.seq)
+		preLen := g.Len()
+		g.insert(id, vec, g.randomLevel(), 0)
 
-		if insertLevel < 0 {
-			panic("invalid level")
+		// Invariant check: the node should have been added to the graph.
+		if g.Len() != preLen+1 {
+			panic("node not added")
 		}
+		g.debugCheck(op, key)
+	}
+}
 
-		var elevator *K
+// insert links the node with the given ID into the layers from minLevel up
+// to level, creating layers as needed. The node must already be in the
+// layers below minLevel.
+func (g *Graph[K]) insert(id uint32, vec Vector, level, minLevel int) {
+	if level < 0 {
+		panic("invalid level")
+	}
+	if level < minLevel {
+		return
+	}
+	// Create layers that don't exist yet.
+	for level >= len(g.layers) {
+		g.layers = append(g.layers, &layer{})
+	}
 
-		preLen := g.Len()
+	var (
+		elevator *layerNode
+		stats    *searchStats
+	)
+	if g.Logger != nil {
+		stats = &searchStats{}
+		defer g.warnNaN("Add", stats)
+	}
 
-		// Insert node at each layer, beginning with the highest.
-		for i := len(g.layers) - 1; i >= 0; i-- {
-			layer := g.layers[i]
-			newNode := &layerNode[K]{
-				Node: Node[K]{
-					Key:   key,
-					Value: vec,
-				},
-			}
+	// Insert node at each layer, beginning with the highest.
+	for i := len(g.layers) - 1; i >= minLevel; i-- {
+		layer := g.layers[i]
+		newNode := &layerNode{
+			id:    id,
+			Value: vec,
+		}
 
-			// Insert the new node into the layer.
-			if layer.entry() == nil {
-				layer.nodes = map[K]*layerNode[K]{key: newNode}
-				continue
-			}
+		// Insert the new node into the layer.
+		if layer.entry() == nil {
+			layer.nodes = map[uint32]*layerNode{id: newNode}
+			continue
+		}
 
-			// Now at the highest layer with more than one node, so we can begin
-			// searching for the best way to enter the graph.
-			searchPoint := layer.entry()
+		// Now at the highest layer with more than one node, so we can begin
+		// searching for the best way to enter the graph.
+		searchPoint := layer.entry()
 
-			// On subsequent layers, we use the elevator node to enter the graph
-			// at the best point.
-			if elevator != nil {
-				searchPoint = layer.nodes[*elevator]
-			}
+		// On subsequent layers, we use the elevator node to enter the graph
+		// at the best point.
+		if elevator != nil {
+			searchPoint = layer.nodes[elevator.id]
+		}
 
-			if g.Distance == nil {
-				panic("(*Graph).Distance must be set")
-			}
+		if g.Distance == nil {
+			panic("(*Graph).Distance must be set")
+		}
 
-			neighborhood := searchPoint.search(g.M, g.EfSearch, vec, g.Distance)
-			if len(neighborhood) == 0 {
-				// This should never happen because the searchPoint itself
-				// should be in the result set.
-				panic("no nodes found")
-			}
+		k := g.M
+		if g.KeepPrunedConnections {
+			// The search considers EfSearch candidates anyway.
+			k = max(g.M, g.EfSearch)
+		}
+		neighborhood := searchPoint.search(&searchParams{
+			k:        k,
+			efSearch: g.EfSearch,
+			target:   vec,
+			distance: g.Distance,
+			maxDist:  noMaxDist,
+			stats:    stats,
+		})
+		if len(neighborhood) == 0 {
+			// This should never happen because the searchPoint itself
+			// should be in the result set.
+			panic("no nodes found")
+		}
 
-			// Re-set the elevator node for the next layer.
-			elevator = ptr(neighborhood[0].node.Key)
+		// Re-set the elevator node for the next layer.
+		elevator = neighborhood[0].node
 
-			if insertLevel >= i {
-				if _, ok := layer.nodes[key]; ok {
-					g.Delete(key)
-				}
-				// Insert the new node into the layer.
-				layer.nodes[key] = newNode
-				for _, node := range neighborhood {
-					// Create a bi-directional edge between the new node and the best node.
-					node.node.addNeighbor(newNode, g.M, g.Distance)
-					newNode.addNeighbor(node.node, g.M, g.Distance)
-				}
+		if level >= i {
+			// Insert the new node into the layer.
+			layer.nodes[id] = newNode
+			for _, node := range neighborhood[:min(g.M, len(neighborhood))] {
+				// Create a bi-directional edge between the new node and the best node.
+				node.node.addNeighbor(newNode, g.M, g.Distance)
+			}
+			if g.KeepPrunedConnections {
+				newNode.keepPruned(neighborhood, g.M, g.Distance)
 			}
-		}
-
-		// Invariant check: the node should have been added to the graph.
-		if g.Len() != preLen+1 {
-			panic("node not added")
 		}
 	}
 }
 
+// strictEfFactor widens the beam of the base layer for
+// SearchOptions.Strict.
+const strictEfFactor = 4
+
+// noMaxDist is the maxDist passed to layerNode.search when results
+// aren't limited by distance.
+var noMaxDist = float32(math.Inf(1))
+
+// SearchOptions configures a search.
+// The zero value is equivalent to calling Search.
+type SearchOptions struct {
+	// MaxDistance, if greater than zero, excludes nodes farther than
+	// MaxDistance from the query, so that searches without a good match
+	// return fewer than k results instead of poor ones.
+	MaxDistance float32
+
+	// HalfLife, if greater than zero, ranks results by their Score
+	// multiplied by a recency decay that halves every HalfLife since the
+	// node's timestamp, see Graph.SetTimestamp. Nodes without a timestamp
+	// are not decayed. The decay is applied to the EfSearch nearest
+	// nodes, so that fresher nodes can outrank slightly closer stale ones.
+	HalfLife time.Duration
+
+	// Now is the time the decay is measured from. Defaults to the current
+	// time.
+	Now time.Time
+
+	// BoostWeight, if greater than zero, ranks results by a blend of
+	// their Score and the node's boost, see Graph.SetBoost:
+	// (1-BoostWeight)*Score + BoostWeight*boost. It is at most 1, and
+	// applied after HalfLife to the EfSearch nearest nodes.
+	BoostWeight float32
+
+	// Context is passed to Graph.Tracer, so that the span of the search
+	// is part of the caller's trace.
+	Context context.Context
+
+	// Deadline, if not zero, bounds the duration of the search. Once it
+	// has passed, the search returns the best nodes found so far, see
+	// Graph.SearchPartial.
+	Deadline time.Time
+
+	// Expr, if not nil, ranks results by a weighted sum of their Score
+	// and other signals instead, see ScoreExpr. HalfLife is then only the
+	// half-life of the recency signal, and BoostWeight is ignored.
+	Expr *ScoreExpr
+
+	// Stats, if not nil, is set to the work done by the search.
+	Stats *SearchStats
+
+	// Strict trades speed for exactness in the base layer, where the
+	// results are found: it is searched with four times the beam of
+	// max(k, EfSearch), and the results are the k nearest of all nodes
+	// visited there, in order of distance. A closer node is then much less
+	// likely to be missed in favor of a farther one, but the search is not
+	// exhaustive, see Graph.ExactBelow.
+	Strict bool
+
+	// Exploration is the probability in [0, 1] that the search keeps
+	// expanding candidates once the greedy descent stops improving.
+	// Small values (e.g. 0.1) improve recall on clustered data, where
+	// the greedy descent can get stuck in a local minimum, at the cost
+	// of more distance computations. Random choices are drawn from
+	// Graph.Rng.
+	Exploration float64
+
+	// efSearch, if greater than zero, overrides Graph.EfSearch. It is
+	// unexported, as only Analyzer.ExpectedWorkEstimate needs it.
+	efSearch int
+}
+
+// SearchResult is a node found by a search.
+type SearchResult[K cmp.Ordered] struct {
+	Node[K]
+
+	// Distance is the distance between the node and the query.
+	Distance float32
+
+	// Score is the similarity between the node and the query in [0, 1],
+	// where higher is more similar. See Graph.Score. Ranking options
+	// adjust it, and SearchOptions.Expr replaces it.
+	Score float32
+}
+
 // Search finds the k nearest neighbors from the target node.
 func (h *Graph[K]) Search(near Vector, k int) []Node[K] {
+	results := h.SearchWithOptions(near, k, SearchOptions{})
+	out := make([]Node[K], len(results))
+	for i, result := range results {
+		out[i] = result.Node
+	}
+	return out
+}
+
+// SearchWithOptions is like Search, but with additional options and
+// the distance and score of each result.
+//
+// Results are ordered by distance, closest first, or by score when
+// options rank them. Results at equal distance, or at equal score, are
+// ordered by key, so that searches of the same graph are repeatable,
+// e.g. for tests and pagination.
+func (h *Graph[K]) SearchWithOptions(near Vector, k int, opts SearchOptions) []SearchResult[K] {
+	results, _ := h.SearchPartial(near, k, opts)
+	return results
+}
+
+// SearchPartial is like SearchWithOptions, but also reports whether the
+// search was cut short by opts.Deadline. If so, the results are the best
+// found so far, and may be fewer than k or farther than those of a
+// complete search.
+func (h *Graph[K]) SearchPartial(near Vector, k int, opts SearchOptions) (results []SearchResult[K], truncated bool) {
+	return h.searchPartial(near, k, opts, nil)
+}
+
+// searchPartial is SearchPartial, restricted to nodes for which allow
+// returns true if allow is not nil.
+func (h *Graph[K]) searchPartial(near Vector, k int, opts SearchOptions, allow func(id uint32) bool) (results []SearchResult[K], truncated bool) {
 	h.assertDims(near)
 	if len(h.layers) == 0 {
-		return nil
+		return nil, false
 	}
 
 	var (
 		efSearch = h.EfSearch
+		maxDist  = noMaxDist
+
+		explore func() bool
+		stop    func() bool
 
-		elevator *K
+		elevator *layerNode
 	)
+	if opts.efSearch > 0 {
+		efSearch = opts.efSearch
+	}
 
+	var stats *searchStats
+	if h.Logger != nil {
+		stats = &searchStats{}
+		defer h.warnNaN("Search", stats)
+	}
+	if opts.Stats != nil {
+		if stats == nil {
+			stats = &searchStats{}
+		}
+		defer func() { *opts.Stats = stats.public() }()
+	}
+	if h.Tracer != nil {
+		if stats == nil {
+			stats = &searchStats{}
+		}
+		end := h.startSpan(opts.Context, "Search")
+		defer func() {
+			// efSearch is read once the search has set it for the base
+			// layer.
+			end(nil,
+				slog.Int("k", k),
+				slog.Int("ef", max(k, efSearch)),
+				slog.Int("visited", stats.visited),
+				slog.Int("results", len(results)),
+				slog.Bool("truncated", truncated),
+			)
+		}()
+	}
+
+	if h.Len() < h.ExactBelow {
+		n := k
+		if opts.reranks() {
+			n = max(k, efSearch)
+		}
+		return h.searchResults(h.scan(near, n, Filter[K]{}, opts, allow, stats), k, opts), false
+	}
+	if !opts.Deadline.IsZero() {
+		stop = func() bool {
+			truncated = truncated || !time.Now().Before(opts.Deadline)
+			return truncated
+		}
+	}
+	if opts.MaxDistance > 0 {
+		maxDist = opts.MaxDistance
+	}
+	if opts.Exploration > 0 {
+		if h.Rng == nil {
+			h.Rng = defaultRand()
+		}
+		explore = func() bool {
+			return h.Rng.Float64() < opts.Exploration
+		}
+	}
+
+	params := searchParams{
+		k:        1,
+		efSearch: efSearch,
+		target:   near,
+		distance: h.Distance,
+		maxDist:  noMaxDist,
+		explore:  explore,
+		stop:     stop,
+		lowMem:   h.LowMemorySearch,
+		stats:    stats,
+	}
 	for layer := len(h.layers) - 1; layer >= 0; layer-- {
 		searchPoint := h.layers[layer].entry()
 		if elevator != nil {
-			searchPoint = h.layers[layer].nodes[*elevator]
+			searchPoint = h.layers[layer].nodes[elevator.id]
 		}
 
 		// Descending hierarchies
 		if layer > 0 {
-			nodes := searchPoint.search(1, efSearch, near, h.Distance)
-			elevator = ptr(nodes[0].node.Key)
+			nodes := searchPoint.search(&params)
+			stats.endLayer(layer)
+			elevator = nodes[0].node
 			continue
 		}
 
-		nodes := searchPoint.search(k, efSearch, near, h.Distance)
-		out := make([]Node[K], 0, len(nodes))
+		if opts.Strict {
+			efSearch = strictEfFactor * max(k, efSearch)
+		}
+		// Retrieve the whole result set, as ranking may reorder it, and
+		// searchResults breaks ties at the k-th distance by key.
+		params.k, params.efSearch = max(k, efSearch), efSearch
+		params.maxDist, params.allow = maxDist, allow
+		nodes := searchPoint.search(&params)
+		stats.endLayer(layer)
+		return h.searchResults(nodes, k, opts), truncated
+	}
 
-		for _, node := range nodes {
-			out = append(out, node.node.Node)
+	panic("unreachable")
+}
+
+// searchResults converts the candidates found by a search, closest
+// first, into the top k results according to opts. Candidates at equal
+// distance are ordered by key.
+func (h *Graph[K]) searchResults(nodes []searchCandidate, k int, opts SearchOptions) []SearchResult[K] {
+	score := h.Score
+	if score == nil {
+		score = ScoreFuncFor(h.Distance)
+	}
+	slices.SortStableFunc(nodes, func(a, b searchCandidate) int {
+		if c := cmp.Compare(a.dist, b.dist); c != 0 {
+			return c
 		}
+		return cmp.Compare(h.keys[a.node.id], h.keys[b.node.id])
+	})
+	if !opts.reranks() {
+		nodes = nodes[:min(k, len(nodes))]
+	}
+	out := make([]SearchResult[K], 0, len(nodes))
+	for _, node := range nodes {
+		out = append(out, SearchResult[K]{
+			Node:     h.node(node.node),
+			Distance: node.dist,
+			Score:    score(node.dist),
+		})
+	}
+	if opts.reranks() {
+		out = h.rank(out, k, opts)
+	}
+	return out
+}
 
-		return out
+// Neighbors finds the k nearest neighbors of the node with the given key,
+// excluding the node itself, e.g. for "more like this" queries. It is
+// like searching for the node's vector, but starts from the node in the
+// base layer instead of descending from the top layer. It returns nil if
+// the key is not in the graph.
+func (h *Graph[K]) Neighbors(key K, k int) []Node[K] {
+	id, ok := h.ids[key]
+	if !ok || k <= 0 {
+		return nil
 	}
+	start := h.layers[0].nodes[id]
+
+	// The node itself is almost always the nearest, so search for one
+	// more.
+	nodes := start.search(&searchParams{
+		k:        k + 1,
+		efSearch: max(h.EfSearch, k+1),
+		target:   start.Value,
+		distance: h.Distance,
+		maxDist:  noMaxDist,
+	})
+	out := make([]Node[K], 0, k)
+	for _, node := range nodes {
+		if node.node.id == id || len(out) == k {
+			continue
+		}
+		out = append(out, h.node(node.node))
+	}
+	return out
+}
 
-	panic("unreachable")
+// FindDuplicates returns the clusters of nodes whose vectors are within
+// threshold of each other, e.g. to clean a dataset of near-identical
+// entries. Nodes are clustered transitively: two nodes are in the same
+// cluster if a chain of nodes within threshold of the next one connects
+// them. Each cluster holds at least two keys, sorted, and clusters are
+// sorted by their first key.
+//
+// It searches the graph for the nearest neighbors of every node, so like
+// any search it may miss some duplicates, especially if a node has more
+// than EfSearch of them.
+func (h *Graph[K]) FindDuplicates(threshold float32) [][]K {
+	if h.Len() == 0 {
+		return nil
+	}
+
+	// parent is a union-find forest over IDs.
+	parent := make([]uint32, len(h.keys))
+	for i := range parent {
+		parent[i] = uint32(i)
+	}
+	var find func(id uint32) uint32
+	find = func(id uint32) uint32 {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+
+	ef := max(h.M, h.EfSearch)
+	for id, node := range h.layers[0].nodes {
+		params := searchParams{
+			k:        ef,
+			efSearch: ef,
+			target:   node.Value,
+			distance: h.Distance,
+			maxDist:  threshold,
+		}
+		for _, c := range node.search(&params) {
+			if c.node.id == id {
+				continue
+			}
+			a, b := find(id), find(c.node.id)
+			if a != b {
+				parent[max(a, b)] = min(a, b)
+			}
+		}
+	}
+
+	clusters := make(map[uint32][]K)
+	for id := range h.layers[0].nodes {
+		root := find(id)
+		clusters[root] = append(clusters[root], h.keys[id])
+	}
+	var out [][]K
+	for _, cluster := range clusters {
+		if len(cluster) > 1 {
+			slices.Sort(cluster)
+			out = append(out, cluster)
+		}
+	}
+	slices.SortFunc(out, func(a, b []K) int {
+		return cmp.Compare(a[0], b[0])
+	})
+	return out
+}
+
+// RandomWalk walks up to steps edges of the base layer from the node with
+// the given key, choosing each next node uniformly among the neighbors of
+// the current one with Rng. It returns the keys of the visited nodes,
+// beginning with start, and nil if start is not in the graph. Nodes may be
+// visited more than once.
+//
+// Walks over the proximity graph sample nodes similar to start, e.g. for
+// recommendations, or to derive graph-based features.
+func (h *Graph[K]) RandomWalk(start K, steps int) []K {
+	id, ok := h.ids[start]
+	if !ok {
+		return nil
+	}
+	if h.Rng == nil {
+		h.Rng = defaultRand()
+	}
+
+	node := h.layers[0].nodes[id]
+	walk := make([]K, 1, max(steps, 0)+1)
+	walk[0] = start
+	for i := 0; i < steps && len(node.neighbors) > 0; i++ {
+		node = node.neighbors[h.Rng.Intn(len(node.neighbors))]
+		walk = append(walk, h.keys[node.id])
+	}
+	return walk
+}
+
+// AdjacencyList returns the edges of a layer, 0 being the base layer, as
+// a map from the key of each node in the layer to the keys of its
+// neighbors. Edges are bidirectional, so each appears in the lists of
+// both nodes. It returns nil if the layer doesn't exist.
+//
+// The result is a copy that may be modified freely, e.g. to feed the
+// structure of the graph into graph analytics libraries.
+func (h *Graph[K]) AdjacencyList(layer int) map[K][]K {
+	if layer < 0 || layer >= len(h.layers) {
+		return nil
+	}
+	nodes := h.layers[layer].nodes
+	adj := make(map[K][]K, len(nodes))
+	for id, node := range nodes {
+		neighbors := make([]K, len(node.neighbors))
+		for i, neighbor := range node.neighbors {
+			neighbors[i] = h.keys[neighbor.id]
+		}
+		adj[h.keys[id]] = neighbors
+	}
+	return adj
 }
 
 // Len returns the number of nodes in the graph.
@@ -457,34 +1365,380 @@ func (h *Graph[K]) Len() int {
 // Delete removes a node from the graph by key.
 // It tries to preserve the clustering properties of the graph by
 // replenishing connectivity in the affected neighborhoods.
+//
+// The key is recorded as a tombstone until it is added again,
+// see Tombstones. Seq then returns the sequence number of the delete.
 func (h *Graph[K]) Delete(key K) bool {
-	if len(h.layers) == 0 {
+	if !h.delete(key, nil) {
 		return false
 	}
+	h.recordDelete(key)
+	h.debugCheck("Delete", key)
+	return true
+}
+
+// DeleteReport describes the effect of a delete on the graph, see
+// DeleteWithReport.
+type DeleteReport[K cmp.Ordered] struct {
+	// Deleted reports whether the key was in the graph.
+	Deleted bool
+	// Layers is the number of layers the node was removed from.
+	Layers int
+	// Neighbors are the keys of the nodes that lost an edge to the
+	// deleted node, in sorted order.
+	Neighbors []K
+	// EdgesRemoved is the number of edges of the deleted node, summed
+	// over all layers.
+	EdgesRemoved int
+	// EdgesAdded and EdgesEvicted are the number of edges created and
+	// displaced while repairing the affected neighborhoods. They are zero
+	// if repairs are deferred.
+	EdgesAdded, EdgesEvicted int
+	// Deferred is the number of neighborhoods queued for Repair.
+	Deferred int
+	// Seq is the sequence number of the delete, if Deleted.
+	Seq uint64
+}
+
+// DeleteWithReport is like Delete, but reports which neighborhoods were
+// affected and how many edges were changed to repair them. It is meant for
+// diagnosing the connectivity of the graph after deletes.
+func (h *Graph[K]) DeleteWithReport(key K) DeleteReport[K] {
+	var report DeleteReport[K]
+	if !h.delete(key, &report) {
+		return report
+	}
+	h.recordDelete(key)
+	report.Seq = h.seq
+	h.debugCheck("DeleteWithReport", key)
+	return report
+}
 
-	var deleted bool
-	for _, layer := range h.layers {
-		node, ok := layer.nodes[key]
+// recordDelete records the tombstone of a deleted key.
+func (h *Graph[K]) recordDelete(key K) {
+	h.seq++
+	if h.tombstones == nil {
+		h.tombstones = make(map[K]uint64)
+	}
+	h.tombstones[key] = h.seq
+	h.markDirty(key)
+	h.journal(h.seq, JournalDelete, key)
+}
+
+// markDirty records that key changed, if changes are tracked.
+func (h *Graph[K]) markDirty(key K) {
+	if h.dirty != nil {
+		h.dirty[key] = struct{}{}
+	}
+	h.changes.record(key)
+}
+
+// BatchDelete removes nodes from the graph by key, and returns the number
+// of nodes deleted.
+//
+// Unlike calling Delete for each key, it first removes all nodes and then
+// repairs each affected neighborhood once, which is much faster when the
+// deleted nodes share neighbors. With DeferRepair set, the affected nodes
+// are queued as usual.
+func (h *Graph[K]) BatchDelete(keys ...K) int {
+	var (
+		deferRepair = h.DeferRepair
+		start       = len(h.pending)
+		deleted     int
+	)
+	h.DeferRepair = true
+	for _, key := range keys {
+		if h.Delete(key) {
+			deleted++
+		}
+	}
+	h.DeferRepair = deferRepair
+
+	if !deferRepair {
+		batch := h.pending[start:]
+		h.pending = h.pending[:start]
+		h.repairOnce(batch)
+		if len(h.pending) == 0 {
+			h.pending = nil
+		}
+		if len(keys) > 0 {
+			h.debugCheck("BatchDelete", keys[len(keys)-1])
+		}
+	}
+	return deleted
+}
+
+// DeleteWhere removes the nodes for which match returns true, as with
+// BatchDelete, and returns the number of nodes deleted, e.g. to delete
+// the nodes of a tenant or those older than a retention period. match is
+// called for every node, in the order of internal IDs, before any is
+// deleted. It must not modify the graph.
+func (h *Graph[K]) DeleteWhere(match func(Node[K]) bool) int {
+	var keys []K
+	for _, id := range h.idOrder() {
+		node := Node[K]{Key: h.keys[id], Value: h.layers[0].nodes[id].Value}
+		if match(node) {
+			keys = append(keys, node.Key)
+		}
+	}
+	return h.BatchDelete(keys...)
+}
+
+// delete removes a node from the graph without recording a tombstone.
+// If report is not nil, the effect of the delete is added to it.
+func (h *Graph[K]) delete(key K, report *DeleteReport[K]) bool {
+	id, ok := h.ids[key]
+	if !ok {
+		return false
+	}
+
+	var (
+		deleted   bool
+		neighbors bitset
+	)
+	for level, layer := range h.layers {
+		node, ok := layer.nodes[id]
 		if !ok {
 			continue
 		}
-		delete(layer.nodes, key)
-		node.isolate(h.M)
+		delete(layer.nodes, id)
+		if report != nil {
+			report.Layers++
+			report.EdgesRemoved += len(node.neighbors)
+			for _, neighbor := range node.neighbors {
+				if !neighbors.has(neighbor.id) {
+					neighbors.set(neighbor.id)
+					neighborKey, _ := h.Key(neighbor.id)
+					report.Neighbors = append(report.Neighbors, neighborKey)
+				}
+			}
+		}
+		if h.DeferRepair {
+			node.detach()
+			for _, neighbor := range node.neighbors {
+				h.pending = append(h.pending, pendingRepair{
+					level:   level,
+					node:    neighbor,
+					deleted: node.neighbors,
+				})
+			}
+			if report != nil {
+				report.Deferred += len(node.neighbors)
+			}
+		} else {
+			d := node.isolate(h.M, h.Distance)
+			h.warnIsolated(level, node.neighbors)
+			if report != nil {
+				report.EdgesAdded += d.added
+				report.EdgesEvicted += d.removed
+			}
+		}
 		deleted = true
 	}
+	h.releaseID(key)
+	if report != nil {
+		report.Deleted = deleted
+		slices.Sort(report.Neighbors)
+	}
+
+	// Drop layers emptied by the delete so that searches always
+	// begin from a populated layer.
+	for len(h.layers) > 0 && h.layers[len(h.layers)-1].size() == 0 {
+		h.layers = h.layers[:len(h.layers)-1]
+	}
+
+	return deleted
+}
+
+// Seq returns the sequence number of the last mutation. It is incremented
+// by every added and deleted node, and preserved by Export and Import.
+func (h *Graph[K]) Seq() uint64 {
+	return h.seq
+}
+
+// SearchAfter is like SearchWithOptions, but fails with ErrBehind unless
+// the graph has applied the mutation with sequence number seq, as
+// returned by Seq or DeleteWithReport. A graph loaded with LoadSavedGraph
+// resumes the sequence number of the graph that saved it, so a client can
+// read its own writes from such a replica by passing the sequence number
+// of its last write. Otherwise, sequence numbers are only comparable on
+// the graph that issued them.
+func (h *Graph[K]) SearchAfter(seq uint64, near Vector, k int, opts SearchOptions) ([]SearchResult[K], error) {
+	if h.seq < seq {
+		return nil, fmt.Errorf("%w: at %d, not %d", ErrBehind, h.seq, seq)
+	}
+	return h.SearchWithOptions(near, k, opts), nil
+}
 
+// Tombstones returns the keys deleted from the graph, mapped to the
+// sequence number of their deletion. A key is no longer a tombstone once
+// it is added again.
+//
+// Tombstones are preserved by Export and Import, so that replicas merging
+// an older snapshot with a newer one can tell deleted keys apart from
+// keys the older snapshot doesn't know about yet. See ApplyTombstones.
+func (h *Graph[K]) Tombstones() map[K]uint64 {
+	tombstones := make(map[K]uint64, len(h.tombstones))
+	maps.Copy(tombstones, h.tombstones)
+	return tombstones
+}
+
+// ApplyTombstones deletes the given keys from the graph and records them
+// as tombstones, keeping the latest sequence number of each key. It is
+// typically called with the Tombstones of a newer snapshot, and returns
+// the number of nodes deleted. Nodes added after a tombstone's sequence
+// number are kept, as the add supersedes the delete.
+func (h *Graph[K]) ApplyTombstones(tombstones map[K]uint64) int {
+	var deleted int
+	for key, seq := range tombstones {
+		h.seq = max(h.seq, seq)
+		if id, ok := h.ids[key]; ok && int(id) < len(h.added) && h.added[id] > seq {
+			continue
+		}
+		if h.delete(key, nil) {
+			deleted++
+			h.markDirty(key)
+			h.journal(seq, JournalDelete, key)
+			h.debugCheck("ApplyTombstones", key)
+		}
+		if h.tombstones == nil {
+			h.tombstones = make(map[K]uint64)
+		}
+		if seq > h.tombstones[key] {
+			h.tombstones[key] = seq
+		}
+	}
 	return deleted
 }
 
+// PruneTombstones forgets tombstones with a sequence number at or below
+// seq, e.g. once every replica has caught up to seq. It returns the number
+// of tombstones removed.
+func (h *Graph[K]) PruneTombstones(seq uint64) int {
+	var pruned int
+	for key, s := range h.tombstones {
+		if s <= seq {
+			delete(h.tombstones, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// Level returns the highest layer the node with the given key is in, 0
+// being the base layer. Levels are drawn from a geometric distribution
+// with parameter Ml when nodes are added, so a node's level is mostly
+// useful for debugging, e.g. to find nodes promoted unusually high.
+func (h *Graph[K]) Level(key K) (int, bool) {
+	id, ok := h.ids[key]
+	if !ok {
+		return 0, false
+	}
+	return h.level(id), true
+}
+
+// level returns the highest layer the node with the given ID is in.
+func (h *Graph[K]) level(id uint32) int {
+	for i := len(h.layers) - 1; i > 0; i-- {
+		if _, ok := h.layers[i].nodes[id]; ok {
+			return i
+		}
+	}
+	return 0
+}
+
 // Lookup returns the vector with the given key.
 func (h *Graph[K]) Lookup(key K) (Vector, bool) {
-	if len(h.layers) == 0 {
+	id, ok := h.ids[key]
+	if !ok || len(h.layers) == 0 {
 		return nil, false
 	}
 
-	node, ok := h.layers[0].nodes[key]
+	node, ok := h.layers[0].nodes[id]
 	if !ok {
 		return nil, false
 	}
 	return node.Value, ok
 }
+
+// lowMemVisited and lowMemExpanded are the number of visited nodes
+// remembered and the number of candidates expanded by a search with
+// Graph.LowMemorySearch, in multiples of ef.
+const (
+	lowMemVisited  = 16
+	lowMemExpanded = 16
+)
+
+// visitedSet is the set of nodes visited by a search. It is a bitset,
+// which grows with the largest ID visited, unless lossy is set.
+type visitedSet struct {
+	exact bitset
+	lossy lossySet
+}
+
+func (v *visitedSet) has(id uint32) bool {
+	if v.lossy != nil {
+		return v.lossy.has(id)
+	}
+	return v.exact.has(id)
+}
+
+func (v *visitedSet) set(id uint32) {
+	if v.lossy != nil {
+		v.lossy.set(id)
+		return
+	}
+	v.exact.set(id)
+}
+
+// lossySet is a fixed-size set of IDs that forgets an ID when another
+// one hashes to its slot. Slots hold IDs plus one, so that 0 is empty.
+type lossySet []uint32
+
+// newLossySet returns a lossySet with at least n slots.
+func newLossySet(n int) lossySet {
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	return make(lossySet, size)
+}
+
+func (s lossySet) slot(id uint32) int {
+	// Fibonacci hashing spreads consecutive IDs over the slots.
+	return int((id * 2654435769) & uint32(len(s)-1))
+}
+
+func (s lossySet) has(id uint32) bool {
+	return s[s.slot(id)] == id+1
+}
+
+func (s lossySet) set(id uint32) {
+	s[s.slot(id)] = id + 1
+}
+
+// containsNode reports whether node is among the candidates.
+func containsNode(candidates []searchCandidate, node *layerNode) bool {
+	for _, c := range candidates {
+		if c.node == node {
+			return true
+		}
+	}
+	return false
+}
+
+// bitset is a growable set of internal IDs.
+type bitset []uint64
+
+func (b bitset) has(id uint32) bool {
+	i := int(id / 64)
+	return i < len(b) && b[i]&(1<<(id%64)) != 0
+}
+
+func (b *bitset) set(id uint32) {
+	i := int(id / 64)
+	if i >= len(*b) {
+		*b = append(*b, make([]uint64, i-len(*b)+1)...)
+	}
+	(*b)[i] |= 1 << (id % 64)
+}
@@ -0,0 +1,254 @@
+package hnsw
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// DistanceFunc64 is a distance function for float64 vectors, see
+// Graph64.
+type DistanceFunc64 func(a, b []float64) float64
+
+// CosineDistance64 is CosineDistance for float64 vectors.
+func CosineDistance64(a, b []float64) float64 {
+	var dot, normA, normB float64
+	b = b[:len(a)]
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+}
+
+// EuclideanDistance64 is EuclideanDistance for float64 vectors.
+func EuclideanDistance64(a, b []float64) float64 {
+	var sum float64
+	b = b[:len(a)]
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// distanceFuncs64 are the float64 counterparts of the registered
+// distance functions of the package.
+var distanceFuncs64 = map[string]DistanceFunc64{
+	"euclidean": EuclideanDistance64,
+	"cosine":    CosineDistance64,
+}
+
+// Node64 is a node of a Graph64.
+type Node64[K cmp.Ordered] struct {
+	Key   K
+	Value []float64
+}
+
+// SearchResult64 is a node found by Graph64.Search.
+type SearchResult64[K cmp.Ordered] struct {
+	Node64[K]
+
+	// Distance is the distance between the node and the query, computed
+	// in float64.
+	Distance float64
+}
+
+// Graph64 is a graph of float64 vectors, for workloads that need their
+// precision. The graph is traversed with the vectors rounded to float32,
+// and the nearest nodes found are then ranked by their exact distance in
+// float64. This keeps searches as fast as on a Graph, and makes the order
+// and distances of the results exact, but the set of nodes found is only
+// as good as the float32 approximation.
+//
+// Vectors are stored twice, in float32 in Graph and in float64.
+type Graph64[K cmp.Ordered] struct {
+	// Graph holds the float32 approximation of the vectors. Its
+	// parameters configure the Graph64. It must not be modified directly.
+	Graph *Graph[K]
+
+	// Distance is the distance function of the float64 vectors. It must
+	// match Graph.Distance, and defaults to the counterpart of
+	// CosineDistance or EuclideanDistance.
+	Distance DistanceFunc64
+
+	// vectors holds the float64 vectors by internal ID of Graph.
+	vectors [][]float64
+}
+
+// NewGraph64 returns a new Graph64 with the defaults of NewGraph.
+func NewGraph64[K cmp.Ordered]() *Graph64[K] {
+	return &Graph64[K]{Graph: NewGraph[K]()}
+}
+
+func (g *Graph64[K]) distance() DistanceFunc64 {
+	if g.Distance != nil {
+		return g.Distance
+	}
+	if name, ok := distanceFuncToName(g.Graph.Distance); ok {
+		if fn, ok := distanceFuncs64[name]; ok {
+			return fn
+		}
+	}
+	panic("hnsw: Graph64.Distance must be set for a custom Graph.Distance")
+}
+
+// Add inserts nodes into the graph, replacing nodes with the same keys.
+func (g *Graph64[K]) Add(nodes ...Node64[K]) {
+	for _, node := range nodes {
+		if id, ok := g.Graph.ids[node.Key]; ok {
+			// The node may get another ID.
+			g.vectors[id] = nil
+		}
+		g.Graph.Add(MakeNode(node.Key, toFloat32(node.Value)))
+		id := g.Graph.ids[node.Key]
+		if int(id) >= len(g.vectors) {
+			g.vectors = append(g.vectors, make([][]float64, int(id)+1-len(g.vectors))...)
+		}
+		g.vectors[id] = node.Value
+	}
+}
+
+// Delete removes the node with the given key, and reports whether it
+// existed.
+func (g *Graph64[K]) Delete(key K) bool {
+	id, ok := g.Graph.ids[key]
+	if !ok {
+		return false
+	}
+	g.vectors[id] = nil
+	return g.Graph.Delete(key)
+}
+
+// Lookup returns the vector with the given key.
+func (g *Graph64[K]) Lookup(key K) ([]float64, bool) {
+	id, ok := g.Graph.ids[key]
+	if !ok {
+		return nil, false
+	}
+	return g.vectors[id], true
+}
+
+// Len returns the number of nodes in the graph.
+func (g *Graph64[K]) Len() int {
+	return g.Graph.Len()
+}
+
+// Search finds the k nearest neighbors of near, closest first. It
+// searches Graph for the max(k, EfSearch) nearest neighbors, and returns
+// the k nearest of those by their float64 distance. Results at equal
+// distance are ordered by key.
+func (g *Graph64[K]) Search(near []float64, k int) []SearchResult64[K] {
+	if k <= 0 {
+		return nil
+	}
+	var (
+		distance = g.distance()
+		nodes    = g.Graph.Search(toFloat32(near), max(k, g.Graph.EfSearch))
+		results  = make([]SearchResult64[K], len(nodes))
+	)
+	for i, node := range nodes {
+		vec := g.vectors[g.Graph.ids[node.Key]]
+		results[i] = SearchResult64[K]{
+			Node64:   Node64[K]{Key: node.Key, Value: vec},
+			Distance: distance(vec, near),
+		}
+	}
+	slices.SortFunc(results, func(a, b SearchResult64[K]) int {
+		if c := cmp.Compare(a.Distance, b.Distance); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return results[:min(k, len(results))]
+}
+
+const graph64EncodingVersion = 1
+
+// Export writes the graph to w: Graph, as written by Graph.Export,
+// followed by the float64 vectors.
+func (g *Graph64[K]) Export(w io.Writer) error {
+	var buf bytes.Buffer
+	err := g.Graph.Export(&buf)
+	if err != nil {
+		return err
+	}
+	// The graph is length-prefixed so that Import doesn't depend on how
+	// much of the stream Graph.Import buffers.
+	_, err = multiBinaryWrite(w, graph64EncodingVersion, buf.Len())
+	if err != nil {
+		return fmt.Errorf("encode header: %w", err)
+	}
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("encode graph: %w", err)
+	}
+
+	// Import preserves internal IDs, so the vectors are written in ID
+	// order, without their keys.
+	for _, id := range g.Graph.idOrder() {
+		_, err = binaryWrite(w, g.vectors[id])
+		if err != nil {
+			return fmt.Errorf("encode vector %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Import replaces the graph with the one read from r, as written by
+// Export. Graph must be set, as for Graph.Import.
+func (g *Graph64[K]) Import(r io.Reader) error {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+	var version, size int
+	_, err := multiBinaryRead(r, &version, &size)
+	if err != nil {
+		return fmt.Errorf("decode header: %w", err)
+	}
+	if version != graph64EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrIncompatibleVersion, version)
+	}
+	if size < 0 {
+		return fmt.Errorf("invalid graph size %d", size)
+	}
+
+	lr := io.LimitReader(r, int64(size))
+	err = g.Graph.Import(bufio.NewReader(lr))
+	if err != nil {
+		return fmt.Errorf("import graph: %w", err)
+	}
+	// Skip anything Graph.Import left unread.
+	_, err = io.Copy(io.Discard, lr)
+	if err != nil {
+		return fmt.Errorf("import graph: %w", err)
+	}
+
+	dims := g.Graph.Dims()
+	g.vectors = make([][]float64, len(g.Graph.keys))
+	for _, id := range g.Graph.idOrder() {
+		var vec []float64
+		_, err = binaryRead(r, &vec)
+		if err != nil {
+			return fmt.Errorf("decode vector %d: %w", id, err)
+		}
+		if len(vec) != dims {
+			return fmt.Errorf("vector %d has %w", id, &DimensionError{Want: dims, Got: len(vec)})
+		}
+		g.vectors[id] = vec
+	}
+	return nil
+}
+
+func toFloat32(v []float64) Vector {
+	out := make(Vector, len(v))
+	for i, x := range v {
+		out[i] = float32(x)
+	}
+	return out
+}
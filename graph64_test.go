@@ -0,0 +1,65 @@
+package hnsw
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph64(t *testing.T) {
+	t.Parallel()
+
+	g := NewGraph64[int]()
+	g.Graph = newTestGraph[int]()
+	g.Graph.EfSearch = 64
+	// The vectors differ below the precision of float32.
+	for i := 0; i < 50; i++ {
+		g.Add(Node64[int]{Key: i, Value: []float64{1 + float64(i)*1e-10, 2}})
+	}
+	require.Equal(t, 50, g.Len())
+
+	query := []float64{1 + 7.1e-10, 2}
+	keys := func(results []SearchResult64[int]) []int {
+		out := make([]int, len(results))
+		for i, r := range results {
+			out[i] = r.Key
+		}
+		return out
+	}
+	results := g.Search(query, 3)
+	require.Equal(t, []int{7, 8, 6}, keys(results))
+	require.InDelta(t, 0.1e-10, results[0].Distance, 1e-15)
+
+	// Replacing and deleting nodes keeps the vectors in sync.
+	g.Add(Node64[int]{Key: 7, Value: []float64{5, 5}})
+	require.True(t, g.Delete(8))
+	require.False(t, g.Delete(8))
+	vec, ok := g.Lookup(7)
+	require.True(t, ok)
+	require.Equal(t, []float64{5, 5}, vec)
+	_, ok = g.Lookup(8)
+	require.False(t, ok)
+	require.Equal(t, []int{6, 9, 5}, keys(g.Search(query, 3)))
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Export(&buf))
+	loaded := NewGraph64[int]()
+	require.NoError(t, loaded.Import(&buf))
+	require.Equal(t, g.Len(), loaded.Len())
+	for i := 0; i < 50; i++ {
+		want, ok := g.Lookup(i)
+		got, _ := loaded.Lookup(i)
+		require.Equal(t, want, got)
+		_, loadedOK := loaded.Lookup(i)
+		require.Equal(t, ok, loadedOK)
+	}
+	loaded.Graph.EfSearch = 64
+	require.Equal(t, []int{6, 9, 5}, keys(loaded.Search(query, 3)))
+
+	// Ties are ordered by key.
+	for _, key := range []int{102, 100, 101} {
+		g.Add(Node64[int]{Key: key, Value: []float64{-3, 3}})
+	}
+	require.Equal(t, []int{100, 101, 102}, keys(g.Search([]float64{-3, 3}, 3)))
+}
@@ -0,0 +1,102 @@
+package heap
+
+import (
+	"container/heap"
+	"slices"
+)
+
+// maxHeap is innerHeap with the order reversed.
+type maxHeap[T Lessable[T]] struct {
+	innerHeap[T]
+}
+
+func (h *maxHeap[T]) Less(i, j int) bool {
+	return h.data[j].Less(h.data[i])
+}
+
+// Bounded keeps the smallest elements (according to Less) pushed onto it,
+// up to a fixed capacity. Once full, pushing an element smaller than the
+// current maximum evicts the maximum.
+//
+// It is a max-heap, so the worst retained element is available in
+// constant time, as needed for the result set of a nearest neighbor
+// search.
+type Bounded[T Lessable[T]] struct {
+	inner    maxHeap[T]
+	capacity int
+}
+
+// NewBounded returns an empty heap that retains at most capacity elements.
+func NewBounded[T Lessable[T]](capacity int) *Bounded[T] {
+	if capacity < 0 {
+		panic("heap: negative capacity")
+	}
+	return &Bounded[T]{
+		inner:    maxHeap[T]{innerHeap[T]{data: make([]T, 0, capacity)}},
+		capacity: capacity,
+	}
+}
+
+// Len returns the number of elements in the heap.
+func (b *Bounded[T]) Len() int {
+	return b.inner.Len()
+}
+
+// Cap returns the maximum number of elements in the heap.
+func (b *Bounded[T]) Cap() int {
+	return b.capacity
+}
+
+// Full reports whether the heap holds Cap elements.
+func (b *Bounded[T]) Full() bool {
+	return b.Len() >= b.capacity
+}
+
+// Push adds x to the heap, evicting the maximum element if the heap is
+// full, and reports whether x was retained. x is not retained if the
+// heap is full and x is not smaller than the maximum element.
+// The complexity is O(log n) where n = b.Len().
+func (b *Bounded[T]) Push(x T) bool {
+	if !b.Full() {
+		heap.Push(&b.inner, x)
+		return true
+	}
+	if b.capacity == 0 || !x.Less(b.inner.data[0]) {
+		return false
+	}
+	b.inner.data[0] = x
+	heap.Fix(&b.inner, 0)
+	return true
+}
+
+// Max returns the maximum element in the heap.
+func (b *Bounded[T]) Max() T {
+	return b.inner.data[0]
+}
+
+// PopMax removes and returns the maximum element in the heap.
+// The complexity is O(log n) where n = b.Len().
+func (b *Bounded[T]) PopMax() T {
+	return heap.Pop(&b.inner).(T)
+}
+
+// Slice returns the elements in heap order. The slice is owned by
+// the heap.
+func (b *Bounded[T]) Slice() []T {
+	return b.inner.data
+}
+
+// Sorted returns a copy of the elements, sorted in ascending order.
+func (b *Bounded[T]) Sorted() []T {
+	sorted := slices.Clone(b.inner.data)
+	slices.SortFunc(sorted, func(x, y T) int {
+		switch {
+		case x.Less(y):
+			return -1
+		case y.Less(x):
+			return 1
+		}
+		return 0
+	})
+	return sorted
+}
@@ -12,6 +12,9 @@ type Lessable[T any] interface {
 // it implements the std heap interface.
 type innerHeap[T Lessable[T]] struct {
 	data []T
+	// handles holds the handle of each element pushed with PushHandle,
+	// and is nil until then.
+	handles []*Handle
 }
 
 func (h *innerHeap[T]) Len() int {
@@ -24,19 +27,49 @@ func (h *innerHeap[T]) Less(i, j int) bool {
 
 func (h *innerHeap[T]) Swap(i, j int) {
 	h.data[i], h.data[j] = h.data[j], h.data[i]
+	if h.handles != nil {
+		h.handles[i], h.handles[j] = h.handles[j], h.handles[i]
+		h.handles[i].set(i)
+		h.handles[j].set(j)
+	}
 }
 
 func (h *innerHeap[T]) Push(x interface{}) {
 	h.data = append(h.data, x.(T))
+	if h.handles != nil {
+		h.handles = append(h.handles, nil)
+	}
 }
 
 func (h *innerHeap[T]) Pop() interface{} {
 	n := len(h.data)
 	x := h.data[n-1]
 	h.data = h.data[:n-1]
+	if h.handles != nil {
+		h.handles[n-1].set(-1)
+		h.handles = h.handles[:n-1]
+	}
 	return x
 }
 
+// Handle refers to an element pushed with PushHandle, wherever the heap
+// moves it.
+type Handle struct {
+	index int
+}
+
+func (hd *Handle) set(i int) {
+	if hd != nil {
+		hd.index = i
+	}
+}
+
+// Index returns the index of the element in the heap, or -1 once it has
+// been removed.
+func (hd *Handle) Index() int {
+	return hd.index
+}
+
 // Heap represents the heap data structure using a flat array to store the elements.
 // It is a wrapper around the standard library's heap.
 type Heap[T Lessable[T]] struct {
@@ -49,6 +82,10 @@ type Heap[T Lessable[T]] struct {
 // The complexity is O(n) where n = h.Len().
 func (h *Heap[T]) Init(d []T) {
 	h.inner.data = d
+	for _, hd := range h.inner.handles {
+		hd.set(-1)
+	}
+	h.inner.handles = nil
 	heap.Init(&h.inner)
 }
 
@@ -63,6 +100,19 @@ func (h *Heap[T]) Push(x T) {
 	heap.Push(&h.inner, x)
 }
 
+// PushHandle is like Push, but returns a handle to the element for Update.
+// Tracking handles makes every later operation slightly slower.
+func (h *Heap[T]) PushHandle(x T) *Handle {
+	if h.inner.handles == nil {
+		h.inner.handles = make([]*Handle, len(h.inner.data), cap(h.inner.data))
+	}
+	hd := &Handle{index: len(h.inner.data)}
+	h.inner.data = append(h.inner.data, x)
+	h.inner.handles = append(h.inner.handles, hd)
+	heap.Fix(&h.inner, hd.index)
+	return hd
+}
+
 // Pop removes and returns the minimum element (according to Less) from the heap.
 // The complexity is O(log n) where n = h.Len().
 // Pop is equivalent to Remove(h, 0).
@@ -70,6 +120,9 @@ func (h *Heap[T]) Pop() T {
 	return heap.Pop(&h.inner).(T)
 }
 
+// PopLast removes and returns the last element of the heap's underlying
+// slice. It is a leaf, but not necessarily the maximum element; use
+// Bounded to keep the smallest elements of a stream.
 func (h *Heap[T]) PopLast() T {
 	return h.Remove(h.Len() - 1)
 }
@@ -80,14 +133,54 @@ func (h *Heap[T]) Remove(i int) T {
 	return heap.Remove(&h.inner, i).(T)
 }
 
+// Fix re-establishes the heap ordering after the element at index i has
+// changed its value.
+// The complexity is O(log n) where n = h.Len().
+func (h *Heap[T]) Fix(i int) {
+	heap.Fix(&h.inner, i)
+}
+
+// Update replaces the element of a handle returned by PushHandle with x,
+// e.g. to decrease its key, and re-establishes the heap ordering. It
+// panics if the element has been removed.
+// The complexity is O(log n) where n = h.Len().
+func (h *Heap[T]) Update(hd *Handle, x T) {
+	if hd.index < 0 {
+		panic("heap: update of removed element")
+	}
+	h.inner.data[hd.index] = x
+	heap.Fix(&h.inner, hd.index)
+}
+
 // Min returns the minimum element in the heap.
 func (h *Heap[T]) Min() T {
 	return h.inner.data[0]
 }
 
 // Max returns the maximum element in the heap.
+// The complexity is O(n) where n = h.Len(), as it scans all leaves. Use
+// Bounded for constant time access to the maximum.
 func (h *Heap[T]) Max() T {
-	return h.inner.data[h.inner.Len()-1]
+	return h.inner.data[h.maxIndex()]
+}
+
+// PopMax removes and returns the maximum element in the heap.
+// The complexity is O(n) where n = h.Len(), like Max.
+func (h *Heap[T]) PopMax() T {
+	return h.Remove(h.maxIndex())
+}
+
+// maxIndex returns the index of the maximum element.
+func (h *Heap[T]) maxIndex() int {
+	data := h.inner.data
+	// The maximum is one of the leaves, which make up the second half.
+	i := len(data) - 1
+	for j := len(data) / 2; j < len(data); j++ {
+		if data[i].Less(data[j]) {
+			i = j
+		}
+	}
+	return i
 }
 
 func (h *Heap[T]) Slice() []T {
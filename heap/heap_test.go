@@ -32,3 +32,54 @@ func TestHeap(t *testing.T) {
 		t.Errorf("Heap did not return sorted elements: %+v", inOrder)
 	}
 }
+
+func TestHeap_MaxUpdate(t *testing.T) {
+	h := Heap[Int]{}
+	for _, x := range []Int{5, 1, 3, 7, 2} {
+		h.Push(x)
+	}
+	hd := h.PushHandle(9)
+	h.Push(4)
+	require.Equal(t, Int(9), h.Max())
+	require.Equal(t, Int(9), h.Slice()[hd.Index()])
+
+	// Decrease the key of the maximum.
+	h.Update(hd, 0)
+	require.Equal(t, 0, hd.Index())
+	require.Equal(t, Int(0), h.Min())
+	require.Equal(t, Int(7), h.Max())
+	require.Equal(t, Int(7), h.PopMax())
+	require.Equal(t, Int(5), h.Max())
+	require.Equal(t, Int(0), h.Slice()[hd.Index()])
+
+	// Handles follow their element as others are pushed and popped.
+	h.Update(hd, 6)
+	for h.Len() > 0 && h.Min() != 6 {
+		h.Pop()
+		require.Equal(t, Int(6), h.Slice()[hd.Index()])
+	}
+	require.Equal(t, Int(6), h.Pop())
+	require.Equal(t, -1, hd.Index())
+	require.Panics(t, func() { h.Update(hd, 1) })
+}
+
+func TestBounded(t *testing.T) {
+	b := NewBounded[Int](5)
+	var all []Int
+	for i := 0; i < 100; i++ {
+		x := Int(rand.Int() % 1000)
+		all = append(all, x)
+		b.Push(x)
+		require.LessOrEqual(t, b.Len(), 5)
+	}
+	require.True(t, b.Full())
+
+	slices.Sort(all)
+	require.Equal(t, all[:5], b.Sorted())
+	require.Equal(t, all[4], b.Max())
+	require.False(t, b.Push(all[4]+1))
+	require.Equal(t, all[4], b.PopMax())
+	require.Equal(t, 4, b.Len())
+
+	require.False(t, NewBounded[Int](0).Push(1))
+}
@@ -0,0 +1,232 @@
+package hnsw
+
+import (
+	"cmp"
+	"slices"
+)
+
+// SparseVector is a sparse vector, e.g. a SPLADE or BM25 term weighting,
+// holding the values of its non-zero dimensions.
+type SparseVector struct {
+	Indices []uint32
+	Values  []float32
+}
+
+// Dot returns the dot product of v and o.
+func (v SparseVector) Dot(o SparseVector) float32 {
+	if len(v.Indices) > len(o.Indices) {
+		v, o = o, v
+	}
+	values := make(map[uint32]float32, len(v.Indices))
+	for i, idx := range v.Indices {
+		values[idx] += v.Values[i]
+	}
+	var dot float32
+	for i, idx := range o.Indices {
+		dot += values[idx] * o.Values[i]
+	}
+	return dot
+}
+
+// HybridNode is a node of a HybridIndex.
+type HybridNode[K cmp.Ordered] struct {
+	Key    K
+	Dense  Vector
+	Sparse SparseVector
+}
+
+// HybridResult is a node found by HybridIndex.Search.
+type HybridResult[K cmp.Ordered] struct {
+	Key K
+
+	// Score is the fused score, alpha*DenseScore + (1-alpha)*SparseScore.
+	Score float32
+
+	// DenseScore is the score of the dense distance, see
+	// SearchResult.Score, and SparseScore the dot product of the sparse
+	// vectors divided by the largest among the candidates, so that both
+	// are in [0, 1].
+	DenseScore, SparseScore float32
+}
+
+// HybridIndex stores a dense and a sparse vector for each key, and fuses
+// their scores at query time, e.g. to blend a SPLADE model's matching of
+// exact terms with a dense embedding's matching of meaning.
+//
+// Dense vectors are searched in Dense, and sparse vectors exactly in an
+// inverted index, which is fast as long as queries have few non-zero
+// dimensions.
+type HybridIndex[K cmp.Ordered] struct {
+	// Dense holds the dense vectors. Its parameters configure the dense
+	// search. It must not be modified directly.
+	Dense *Graph[K]
+
+	sparse map[K]SparseVector
+	// postings maps each dimension to the keys with a value in it.
+	postings map[uint32]map[K]float32
+}
+
+// NewHybridIndex returns a new HybridIndex with the defaults of NewGraph.
+func NewHybridIndex[K cmp.Ordered]() *HybridIndex[K] {
+	return &HybridIndex[K]{Dense: NewGraph[K]()}
+}
+
+// Add inserts nodes into the index, replacing nodes with the same keys.
+// Either vector of a node may be empty, but not both.
+func (x *HybridIndex[K]) Add(nodes ...HybridNode[K]) {
+	if x.sparse == nil {
+		x.sparse = make(map[K]SparseVector)
+		x.postings = make(map[uint32]map[K]float32)
+	}
+	for _, node := range nodes {
+		if len(node.Sparse.Indices) != len(node.Sparse.Values) {
+			panic("hnsw: SparseVector needs a value for each index")
+		}
+		if len(node.Dense) == 0 && len(node.Sparse.Indices) == 0 {
+			panic("hnsw: HybridNode needs a dense or sparse vector")
+		}
+		x.deleteSparse(node.Key)
+		if len(node.Dense) > 0 {
+			x.Dense.Add(MakeNode(node.Key, node.Dense))
+		} else {
+			x.Dense.Delete(node.Key)
+		}
+		if len(node.Sparse.Indices) == 0 {
+			continue
+		}
+		x.sparse[node.Key] = node.Sparse
+		for i, idx := range node.Sparse.Indices {
+			keys, ok := x.postings[idx]
+			if !ok {
+				keys = make(map[K]float32)
+				x.postings[idx] = keys
+			}
+			keys[node.Key] += node.Sparse.Values[i]
+		}
+	}
+}
+
+func (x *HybridIndex[K]) deleteSparse(key K) bool {
+	vec, ok := x.sparse[key]
+	if !ok {
+		return false
+	}
+	delete(x.sparse, key)
+	for _, idx := range vec.Indices {
+		delete(x.postings[idx], key)
+		if len(x.postings[idx]) == 0 {
+			delete(x.postings, idx)
+		}
+	}
+	return true
+}
+
+// Delete removes the node with the given key, and reports whether it
+// existed.
+func (x *HybridIndex[K]) Delete(key K) bool {
+	sparse := x.deleteSparse(key)
+	dense := x.Dense.Delete(key)
+	return sparse || dense
+}
+
+// Lookup returns the vectors of the node with the given key.
+func (x *HybridIndex[K]) Lookup(key K) (HybridNode[K], bool) {
+	dense, denseOK := x.Dense.Lookup(key)
+	sparse, sparseOK := x.sparse[key]
+	return HybridNode[K]{Key: key, Dense: dense, Sparse: sparse}, denseOK || sparseOK
+}
+
+// Len returns the number of nodes in the index.
+func (x *HybridIndex[K]) Len() int {
+	n := x.Dense.Len()
+	for key := range x.sparse {
+		if _, ok := x.Dense.ids[key]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Search returns the k nodes with the highest fused score for the query
+// vectors, highest first. alpha in [0, 1] weighs the dense score against
+// the sparse one: 1 is a pure dense search and 0 a pure sparse search.
+// Either query vector may be empty, leaving its scores at 0.
+//
+// The candidates are the max(k, EfSearch) nearest nodes by each vector,
+// so nodes that rank poorly by both are missed even if their fused score
+// would be high.
+func (x *HybridIndex[K]) Search(dense Vector, sparse SparseVector, k int, alpha float32) []HybridResult[K] {
+	if k <= 0 {
+		return nil
+	}
+	var (
+		n          = max(k, x.Dense.EfSearch)
+		candidates = make(map[K]*HybridResult[K])
+		useDense   = len(dense) > 0 && alpha > 0
+		useSparse  = len(sparse.Indices) > 0 && alpha < 1
+		dots       map[K]float32
+	)
+	if useDense {
+		for _, r := range x.Dense.SearchWithOptions(dense, n, SearchOptions{}) {
+			candidates[r.Key] = &HybridResult[K]{Key: r.Key, DenseScore: r.Score}
+		}
+	}
+	if useSparse {
+		dots = x.sparseDots(sparse)
+		keys := make([]K, 0, len(dots))
+		for key := range dots {
+			keys = append(keys, key)
+		}
+		slices.SortFunc(keys, func(a, b K) int {
+			if c := cmp.Compare(dots[b], dots[a]); c != 0 {
+				return c
+			}
+			return cmp.Compare(a, b)
+		})
+		for _, key := range keys[:min(n, len(keys))] {
+			if _, ok := candidates[key]; ok {
+				continue
+			}
+			c := &HybridResult[K]{Key: key}
+			if useDense {
+				// Score the dense vector of nodes missed by the dense
+				// search.
+				if vec, ok := x.Dense.Lookup(key); ok {
+					c.DenseScore = ScoreFuncFor(x.Dense.Distance)(x.Dense.Distance(vec, dense))
+				}
+			}
+			candidates[key] = c
+		}
+		if len(keys) > 0 && dots[keys[0]] > 0 {
+			top := dots[keys[0]]
+			for key, c := range candidates {
+				c.SparseScore = max(0, dots[key]/top)
+			}
+		}
+	}
+
+	results := make([]HybridResult[K], 0, len(candidates))
+	for _, c := range candidates {
+		c.Score = alpha*c.DenseScore + (1-alpha)*c.SparseScore
+		results = append(results, *c)
+	}
+	slices.SortFunc(results, func(a, b HybridResult[K]) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return results[:min(k, len(results))]
+}
+
+// sparseDots returns the dot product of query with every node that shares
+// a dimension with it.
+func (x *HybridIndex[K]) sparseDots(query SparseVector) map[K]float32 {
+	dots := make(map[K]float32)
+	for i, idx := range query.Indices {
+		for key, value := range x.postings[idx] {
+			dots[key] += value * query.Values[i]
+		}
+	}
+	return dots
+}
@@ -0,0 +1,73 @@
+package hnsw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSparseVector_Dot(t *testing.T) {
+	a := SparseVector{Indices: []uint32{1, 5, 9}, Values: []float32{1, 2, 3}}
+	b := SparseVector{Indices: []uint32{9, 1}, Values: []float32{2, 4}}
+	require.Equal(t, float32(10), a.Dot(b))
+	require.Equal(t, float32(10), b.Dot(a))
+	require.Equal(t, float32(0), a.Dot(SparseVector{}))
+}
+
+func TestHybridIndex(t *testing.T) {
+	t.Parallel()
+
+	x := NewHybridIndex[string]()
+	x.Dense = newTestGraph[string]()
+	x.Dense.Distance = CosineDistance
+	sparse := func(idx ...uint32) SparseVector {
+		v := SparseVector{Indices: idx, Values: make([]float32, len(idx))}
+		for i := range v.Values {
+			v.Values[i] = 1
+		}
+		return v
+	}
+	x.Add(
+		// Close in meaning, but doesn't share terms.
+		HybridNode[string]{Key: "synonym", Dense: Vector{1, 0}, Sparse: sparse(7)},
+		// Shares the query's terms, but is far in meaning.
+		HybridNode[string]{Key: "keyword", Dense: Vector{-1, 0}, Sparse: sparse(1, 2)},
+		// Matches both a little.
+		HybridNode[string]{Key: "both", Dense: Vector{0.5, 0.5}, Sparse: sparse(1)},
+		// Has no dense vector.
+		HybridNode[string]{Key: "sparse-only", Sparse: sparse(2, 3)},
+	)
+	require.Equal(t, 4, x.Len())
+
+	keys := func(results []HybridResult[string]) []string {
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.Key
+		}
+		return out
+	}
+	var (
+		dense = Vector{1, 0}
+		query = sparse(1, 2)
+	)
+	require.Equal(t, []string{"synonym", "both", "keyword"}, keys(x.Search(dense, query, 3, 1)))
+	require.Equal(t, []string{"keyword", "both", "sparse-only"}, keys(x.Search(dense, query, 3, 0)))
+	results := x.Search(dense, query, 4, 0.5)
+	require.Equal(t, "both", results[0].Key)
+	require.InDelta(t, 0.5, results[0].SparseScore, 1e-6)
+	for _, r := range results {
+		require.InDelta(t, 0.5*r.DenseScore+0.5*r.SparseScore, r.Score, 1e-6)
+	}
+
+	// Replacing a node replaces both vectors.
+	x.Add(HybridNode[string]{Key: "keyword", Sparse: sparse(9)})
+	node, ok := x.Lookup("keyword")
+	require.True(t, ok)
+	require.Nil(t, node.Dense)
+	require.Equal(t, []string{"both", "sparse-only"}, keys(x.Search(nil, query, 3, 0)))
+
+	require.True(t, x.Delete("sparse-only"))
+	require.False(t, x.Delete("sparse-only"))
+	require.Equal(t, 3, x.Len())
+	require.Equal(t, []string{"both"}, keys(x.Search(nil, query, 3, 0)))
+}
@@ -0,0 +1,179 @@
+// Package ingest embeds texts in batches and inserts them into a
+// [vectorstore.Store], handling rate limits and transient embedding
+// failures along the way.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coder/hnsw/vectorstore"
+)
+
+// Embedder embeds a batch of texts. Any vectorstore.Embedder satisfies it.
+type Embedder interface {
+	EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Pipeline embeds documents and inserts them into a store.
+// The zero value of every field except Store is usable.
+type Pipeline struct {
+	// Store receives the embedded documents.
+	Store *vectorstore.Store
+
+	// Embedder is used to embed documents. If nil, Store.Embedder is used.
+	Embedder Embedder
+
+	// BatchSize is the maximum number of texts per embedding request.
+	// It defaults to 32.
+	BatchSize int
+
+	// Interval is the minimum time between the start of two embedding
+	// requests, which keeps the pipeline within provider rate limits.
+	// Zero means no limit.
+	Interval time.Duration
+
+	// MaxRetries is the number of times a failed embedding request is
+	// retried before Run gives up. Only errors reported by IsRetryable
+	// are retried.
+	MaxRetries int
+
+	// IsRetryable reports whether an embedding error is transient, e.g. a
+	// rate limit or a timeout, and the request worth retrying. If nil, no
+	// error is retried. Requests are never retried once the context of
+	// Run is done.
+	IsRetryable func(error) bool
+
+	// Backoff is the delay before the first retry. It doubles with each
+	// subsequent retry and defaults to 100ms.
+	Backoff time.Duration
+
+	limiter limiter
+}
+
+// embedder returns the Embedder to use, checking that the pipeline is
+// configured.
+func (p *Pipeline) embedder() (Embedder, error) {
+	if p.Store == nil {
+		return nil, errors.New("ingest: Store must be set")
+	}
+	if p.Embedder != nil {
+		return p.Embedder, nil
+	}
+	if p.Store.Embedder == nil {
+		return nil, errors.New("ingest: Embedder must be set")
+	}
+	return p.Store.Embedder, nil
+}
+
+func (p *Pipeline) batchSize() int {
+	if p.BatchSize <= 0 {
+		return 32
+	}
+	return p.BatchSize
+}
+
+// Run embeds and inserts the documents batch by batch, returning the IDs
+// of the inserted documents. On error, the IDs of the batches inserted
+// before the failure are returned along with it.
+func (p *Pipeline) Run(ctx context.Context, docs []vectorstore.Document) ([]string, error) {
+	embedder, err := p.embedder()
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := p.batchSize()
+	ids := make([]string, 0, len(docs))
+	for start := 0; start < len(docs); start += batchSize {
+		batch := docs[start:min(start+batchSize, len(docs))]
+
+		vecs, err := p.embed(ctx, embedder, texts(batch))
+		if err != nil {
+			return ids, fmt.Errorf("embed batch at %d: %w", start, err)
+		}
+
+		batchIDs, err := p.Store.AddEmbedded(batch, vecs)
+		if err != nil {
+			return ids, fmt.Errorf("insert batch at %d: %w", start, err)
+		}
+		ids = append(ids, batchIDs...)
+	}
+	return ids, nil
+}
+
+func texts(docs []vectorstore.Document) []string {
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.PageContent
+	}
+	return texts
+}
+
+// embed embeds texts, retrying failures. It is safe for concurrent use,
+// and spaces requests by Interval across all callers.
+func (p *Pipeline) embed(ctx context.Context, embedder Embedder, texts []string) ([][]float32, error) {
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := p.limiter.wait(ctx, p.Interval)
+		if err != nil {
+			return nil, err
+		}
+
+		vecs, err := embedder.EmbedDocuments(ctx, texts)
+		if err == nil {
+			return vecs, nil
+		}
+		if attempt >= p.MaxRetries || ctx.Err() != nil ||
+			p.IsRetryable == nil || !p.IsRetryable(err) {
+			return nil, err
+		}
+
+		err = sleep(ctx, backoff)
+		if err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// limiter spaces events at least an interval apart. It is safe for
+// concurrent use.
+type limiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait reserves the next free slot and waits for it, or until ctx is
+// done.
+func (l *limiter) wait(ctx context.Context, interval time.Duration) error {
+	l.mu.Lock()
+	at := time.Now()
+	if at.Before(l.next) {
+		at = l.next
+	}
+	l.next = at.Add(interval)
+	l.mu.Unlock()
+	return sleep(ctx, time.Until(at))
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
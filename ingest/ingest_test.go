@@ -0,0 +1,147 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/hnsw/vectorstore"
+	"github.com/stretchr/testify/require"
+)
+
+// errTransient is the error of the failing requests of flakyEmbedder.
+var errTransient = errors.New("transient")
+
+func isTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+// flakyEmbedder fails the first failures requests and records the size
+// of every batch it's given.
+type flakyEmbedder struct {
+	mu       sync.Mutex
+	failures int
+	batches  []int
+	calls    []time.Time
+}
+
+func (e *flakyEmbedder) EmbedDocuments(_ context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, time.Now())
+	if e.failures > 0 {
+		e.failures--
+		return nil, errTransient
+	}
+	e.batches = append(e.batches, len(texts))
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		vecs[i] = []float32{float32(len(text)), 1}
+	}
+	return vecs, nil
+}
+
+func (e *flakyEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vecs, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+func testDocs(n int) []vectorstore.Document {
+	docs := make([]vectorstore.Document, n)
+	for i := range docs {
+		docs[i] = vectorstore.Document{
+			PageContent: string(make([]byte, i+1)),
+			Metadata:    map[string]any{"i": i},
+		}
+	}
+	return docs
+}
+
+func TestPipeline_Run(t *testing.T) {
+	t.Parallel()
+
+	embedder := &flakyEmbedder{failures: 2}
+	p := &Pipeline{
+		Store:       vectorstore.New(embedder),
+		BatchSize:   4,
+		Interval:    time.Millisecond,
+		MaxRetries:  2,
+		IsRetryable: isTransient,
+		Backoff:     time.Millisecond,
+	}
+
+	start := time.Now()
+	ids, err := p.Run(context.Background(), testDocs(10))
+	require.NoError(t, err)
+	require.Len(t, ids, 10)
+	require.Equal(t, []int{4, 4, 2}, embedder.batches)
+	require.Equal(t, 10, p.Store.Len())
+
+	doc, ok := p.Store.Get(ids[7])
+	require.True(t, ok)
+	require.Equal(t, 7, doc.Metadata["i"])
+
+	// Calls are recorded once they start, which may be late, so only
+	// their slots are spaced by Interval.
+	for i, call := range embedder.calls {
+		require.GreaterOrEqual(t, call.Sub(start), time.Duration(i)*time.Millisecond)
+	}
+}
+
+func TestPipeline_RetriesExhausted(t *testing.T) {
+	t.Parallel()
+
+	embedder := &flakyEmbedder{}
+	p := &Pipeline{
+		Store:       vectorstore.New(embedder),
+		BatchSize:   2,
+		MaxRetries:  1,
+		IsRetryable: isTransient,
+		Backoff:     time.Millisecond,
+	}
+
+	ids, err := p.Run(context.Background(), testDocs(2))
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+
+	embedder.failures = 2
+	ids, err = p.Run(context.Background(), testDocs(4))
+	require.ErrorIs(t, err, errTransient)
+	require.Empty(t, ids)
+	require.Equal(t, 2, p.Store.Len())
+}
+
+func TestPipeline_NotRetryable(t *testing.T) {
+	t.Parallel()
+
+	// Errors are only retried if IsRetryable says so.
+	embedder := &flakyEmbedder{failures: 1}
+	p := &Pipeline{
+		Store:      vectorstore.New(embedder),
+		MaxRetries: 2,
+		Backoff:    time.Millisecond,
+	}
+	_, err := p.Run(context.Background(), testDocs(2))
+	require.ErrorIs(t, err, errTransient)
+	require.Len(t, embedder.calls, 1)
+
+	embedder.failures = 1
+	p.IsRetryable = func(error) bool { return false }
+	_, err = p.Run(context.Background(), testDocs(2))
+	require.ErrorIs(t, err, errTransient)
+	require.Len(t, embedder.calls, 2)
+
+	// Nor once the context is done.
+	embedder.failures = 1
+	p.IsRetryable = isTransient
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.Run(ctx, testDocs(2))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, embedder.calls, 2)
+}
@@ -0,0 +1,234 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coder/hnsw"
+	"github.com/coder/hnsw/vectorstore"
+)
+
+// ErrClosed is returned by Ingestor.Add after Close.
+var ErrClosed = errors.New("ingest: ingestor is closed")
+
+// IngestorOptions configures an Ingestor.
+type IngestorOptions struct {
+	// Workers is the number of batches embedded concurrently. The
+	// Embedder must be safe for concurrent use if it is greater than 1.
+	// Defaults to 1.
+	Workers int
+
+	// QueueSize is the number of documents that may wait to be embedded
+	// before Add blocks. Defaults to twice BatchSize per worker.
+	QueueSize int
+
+	// Linger is how long a worker waits for a batch to fill up before
+	// embedding a partial one. Zero means batches hold whatever is queued
+	// when a worker becomes free, so they only fill up under load.
+	Linger time.Duration
+
+	// Canary, if set, is observed after every batch inserted, e.g. an
+	// hnsw.RecallCanary of the store's graph, so that graph parameters
+	// that don't suit the data show up early. It is never observed
+	// concurrently with inserts or other observations.
+	Canary hnsw.Canary
+}
+
+// Ingestor feeds documents from streaming producers, e.g. message queue
+// consumers or crawlers, through a Pipeline. Add queues documents and
+// blocks while the queue is full, so that producers slow down to the pace
+// of embedding, and workers embed and insert them in batches of up to
+// BatchSize.
+//
+// Batches whose embedding fails, after any retries allowed by
+// MaxRetries and IsRetryable, are dropped, and their errors are returned
+// by the next Flush. It is safe for concurrent use, but the
+// Store must not be modified by others while it is running.
+type Ingestor struct {
+	pipeline  *Pipeline
+	embedder  Embedder
+	batchSize int
+	linger    time.Duration
+	canary    hnsw.Canary
+	ctx       context.Context
+
+	queue   chan vectorstore.Document
+	quit    chan struct{}
+	workers sync.WaitGroup
+
+	// storeMu serializes inserts into the store.
+	storeMu sync.Mutex
+
+	mu sync.Mutex
+	// idle is signaled when pending drops to 0.
+	idle *sync.Cond
+	// pending is the number of documents added but not yet inserted or
+	// dropped.
+	pending int
+	errs    []error
+	closed  bool
+}
+
+// NewIngestor starts an Ingestor that inserts documents with p. ctx
+// bounds the embedding requests of the workers. Close must be called to
+// stop them.
+func NewIngestor(ctx context.Context, p *Pipeline, opts IngestorOptions) (*Ingestor, error) {
+	embedder, err := p.embedder()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 2 * p.batchSize() * opts.Workers
+	}
+
+	in := &Ingestor{
+		pipeline:  p,
+		embedder:  embedder,
+		batchSize: p.batchSize(),
+		linger:    opts.Linger,
+		canary:    opts.Canary,
+		ctx:       ctx,
+		queue:     make(chan vectorstore.Document, opts.QueueSize),
+		quit:      make(chan struct{}),
+	}
+	in.idle = sync.NewCond(&in.mu)
+	for i := 0; i < opts.Workers; i++ {
+		in.workers.Add(1)
+		go in.work()
+	}
+	return in, nil
+}
+
+// Add queues documents for insertion, blocking while the queue is full.
+// If ctx is done first, it returns its error, and the documents before
+// the one that didn't fit are still inserted.
+func (in *Ingestor) Add(ctx context.Context, docs ...vectorstore.Document) error {
+	for _, doc := range docs {
+		in.mu.Lock()
+		if in.closed {
+			in.mu.Unlock()
+			return ErrClosed
+		}
+		in.pending++
+		in.mu.Unlock()
+
+		select {
+		case in.queue <- doc:
+		case <-ctx.Done():
+			in.done(1, nil)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Flush waits until all documents added so far are inserted or dropped,
+// and returns the errors of the batches dropped since the last Flush.
+func (in *Ingestor) Flush() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for in.pending > 0 {
+		in.idle.Wait()
+	}
+	err := errors.Join(in.errs...)
+	in.errs = nil
+	return err
+}
+
+// Close stops accepting documents, flushes the queue and stops the
+// workers. It returns the result of the final Flush.
+func (in *Ingestor) Close() error {
+	in.mu.Lock()
+	if in.closed {
+		in.mu.Unlock()
+		return nil
+	}
+	in.closed = true
+	in.mu.Unlock()
+
+	err := in.Flush()
+	close(in.quit)
+	in.workers.Wait()
+	return err
+}
+
+func (in *Ingestor) work() {
+	defer in.workers.Done()
+	for {
+		var batch []vectorstore.Document
+		select {
+		case doc := <-in.queue:
+			batch = append(batch, doc)
+		case <-in.quit:
+			return
+		}
+		batch = in.fill(batch)
+		in.done(len(batch), in.insert(batch))
+	}
+}
+
+// fill adds queued documents to batch until it is full, the queue is
+// empty, or Linger has passed.
+func (in *Ingestor) fill(batch []vectorstore.Document) []vectorstore.Document {
+	var linger <-chan time.Time
+	if in.linger > 0 {
+		t := time.NewTimer(in.linger)
+		defer t.Stop()
+		linger = t.C
+	}
+	for len(batch) < in.batchSize {
+		if linger == nil {
+			select {
+			case doc := <-in.queue:
+				batch = append(batch, doc)
+			default:
+				return batch
+			}
+			continue
+		}
+		select {
+		case doc := <-in.queue:
+			batch = append(batch, doc)
+		case <-linger:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (in *Ingestor) insert(batch []vectorstore.Document) error {
+	vecs, err := in.pipeline.embed(in.ctx, in.embedder, texts(batch))
+	if err != nil {
+		return fmt.Errorf("embed batch of %d: %w", len(batch), err)
+	}
+
+	in.storeMu.Lock()
+	defer in.storeMu.Unlock()
+	_, err = in.pipeline.Store.AddEmbedded(batch, vecs)
+	if err != nil {
+		return fmt.Errorf("insert batch of %d: %w", len(batch), err)
+	}
+	if in.canary != nil {
+		in.canary.Observe()
+	}
+	return nil
+}
+
+// done records that n documents were inserted, or dropped with err.
+func (in *Ingestor) done(n int, err error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.pending -= n
+	if err != nil {
+		in.errs = append(in.errs, err)
+	}
+	if in.pending == 0 {
+		in.idle.Broadcast()
+	}
+}
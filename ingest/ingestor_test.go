@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coder/hnsw"
+	"github.com/coder/hnsw/vectorstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestor(t *testing.T) {
+	t.Parallel()
+
+	embedder := &flakyEmbedder{failures: 1}
+	p := &Pipeline{
+		Store:       vectorstore.New(embedder),
+		BatchSize:   4,
+		MaxRetries:  2,
+		IsRetryable: isTransient,
+		Backoff:     time.Millisecond,
+	}
+	in, err := NewIngestor(context.Background(), p, IngestorOptions{
+		Workers: 3,
+		Linger:  time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	for _, doc := range testDocs(50) {
+		require.NoError(t, in.Add(context.Background(), doc))
+	}
+	require.NoError(t, in.Flush())
+	require.Equal(t, 50, p.Store.Len())
+	var total int
+	for _, n := range embedder.batches {
+		require.LessOrEqual(t, n, 4)
+		total += n
+	}
+	require.Equal(t, 50, total)
+
+	require.NoError(t, in.Close())
+	require.ErrorIs(t, in.Add(context.Background(), testDocs(1)...), ErrClosed)
+	require.NoError(t, in.Close())
+}
+
+func TestIngestor_Canary(t *testing.T) {
+	t.Parallel()
+
+	embedder := &flakyEmbedder{}
+	p := &Pipeline{Store: vectorstore.New(embedder), BatchSize: 4}
+	var reports []hnsw.CanaryReport
+	canary := &hnsw.RecallCanary[string]{
+		Graph:   p.Store.Graph,
+		Queries: []hnsw.Vector{{5, 1}},
+		Every:   1,
+		Report:  func(r hnsw.CanaryReport) { reports = append(reports, r) },
+	}
+	in, err := NewIngestor(context.Background(), p, IngestorOptions{
+		Workers: 3,
+		Canary:  canary,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, in.Add(context.Background(), testDocs(50)...))
+	require.NoError(t, in.Close())
+
+	// The canary checked after every batch.
+	require.Len(t, reports, len(embedder.batches))
+	require.Equal(t, 50, reports[len(reports)-1].Nodes)
+}
+
+func TestIngestor_DroppedBatches(t *testing.T) {
+	t.Parallel()
+
+	embedder := &flakyEmbedder{failures: 1}
+	p := &Pipeline{Store: vectorstore.New(embedder), BatchSize: 2}
+	in, err := NewIngestor(context.Background(), p, IngestorOptions{})
+	require.NoError(t, err)
+	defer in.Close()
+
+	require.NoError(t, in.Add(context.Background(), testDocs(1)...))
+	require.ErrorIs(t, in.Flush(), errTransient)
+	require.Zero(t, p.Store.Len())
+
+	// Errors are only returned once.
+	require.NoError(t, in.Add(context.Background(), testDocs(3)...))
+	require.NoError(t, in.Flush())
+	require.Equal(t, 3, p.Store.Len())
+}
+
+// gatedEmbedder blocks until gate is closed.
+type gatedEmbedder struct {
+	flakyEmbedder
+	gate chan struct{}
+}
+
+func (e *gatedEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	<-e.gate
+	return e.flakyEmbedder.EmbedDocuments(ctx, texts)
+}
+
+func TestIngestor_Backpressure(t *testing.T) {
+	t.Parallel()
+
+	embedder := &gatedEmbedder{gate: make(chan struct{})}
+	p := &Pipeline{Store: vectorstore.New(embedder), BatchSize: 1}
+	in, err := NewIngestor(context.Background(), p, IngestorOptions{QueueSize: 2})
+	require.NoError(t, err)
+
+	// The worker holds one document and the queue two more.
+	docs := testDocs(4)
+	require.NoError(t, in.Add(context.Background(), docs[:3]...))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, in.Add(ctx, docs[3]), context.DeadlineExceeded)
+
+	close(embedder.gate)
+	require.NoError(t, in.Close())
+	require.Equal(t, 3, p.Store.Len())
+}
@@ -0,0 +1,146 @@
+package hnsw
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Journal operations.
+const (
+	JournalAdd    = "add"
+	JournalDelete = "delete"
+	// JournalPurge entries record a Graph.PurgeKey, without the key.
+	JournalPurge = "purge"
+)
+
+// JournalEntry records a mutation of a graph.
+type JournalEntry[K cmp.Ordered] struct {
+	// Seq is the sequence number of the mutation, see Graph.Seq.
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor,omitempty"`
+	// Op is JournalAdd, JournalDelete or JournalPurge. Adds of existing
+	// keys replace their nodes.
+	Op string `json:"op"`
+	// Key is the zero value for JournalPurge entries, and left out of
+	// their JSON.
+	Key K `json:"key"`
+}
+
+// journalEntryJSON is the JSON encoding of a JournalEntry.
+type journalEntryJSON[K cmp.Ordered] struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor,omitempty"`
+	Op    string    `json:"op"`
+	Key   *K        `json:"key,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e JournalEntry[K]) MarshalJSON() ([]byte, error) {
+	v := journalEntryJSON[K]{Seq: e.Seq, Time: e.Time, Actor: e.Actor, Op: e.Op}
+	if e.Op != JournalPurge {
+		v.Key = &e.Key
+	}
+	return json.Marshal(v)
+}
+
+// Journal is an append-only record of who mutated a graph, when, and
+// how, for auditing deployments that store embeddings derived from user
+// data. Set it as Graph.Journal to record the nodes added and deleted by
+// Add, AddRef, Delete and the methods built on them, and by
+// ApplyTombstones. Import replaces the graph without being recorded.
+//
+// Like the graph, it must not be used concurrently with mutations.
+type Journal[K cmp.Ordered] struct {
+	// Clock returns the time of entries. Defaults to time.Now.
+	Clock func() time.Time
+
+	// Actor is recorded with each entry, e.g. the user or service on
+	// whose behalf the graph is mutated. Set it before each mutation.
+	Actor string
+
+	// Output, if set, receives each entry as a line of JSON when it is
+	// recorded, e.g. an append-only file, instead of keeping entries in
+	// memory. Errors writing to it are returned by Err.
+	Output io.Writer
+
+	entries []JournalEntry[K]
+	err     error
+}
+
+// record appends an entry for a mutation.
+func (j *Journal[K]) record(seq uint64, op string, key K) {
+	now := time.Now
+	if j.Clock != nil {
+		now = j.Clock
+	}
+	entry := JournalEntry[K]{Seq: seq, Time: now(), Actor: j.Actor, Op: op, Key: key}
+	if j.Output == nil {
+		j.entries = append(j.entries, entry)
+		return
+	}
+	if j.err == nil {
+		j.err = writeJournalEntry(j.Output, entry)
+	}
+}
+
+// Entries returns the entries kept in memory, oldest first.
+func (j *Journal[K]) Entries() []JournalEntry[K] {
+	return append([]JournalEntry[K](nil), j.entries...)
+}
+
+// ExportNDJSON writes the entries kept in memory to w, one JSON object
+// per line, oldest first.
+func (j *Journal[K]) ExportNDJSON(w io.Writer) error {
+	for _, entry := range j.entries {
+		err := writeJournalEntry(w, entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purge removes the entries of key kept in memory, and returns the number
+// removed.
+func (j *Journal[K]) purge(key K) int {
+	entries := j.entries[:0]
+	for _, entry := range j.entries {
+		if entry.Op == JournalPurge || entry.Key != key {
+			entries = append(entries, entry)
+		}
+	}
+	n := len(j.entries) - len(entries)
+	clear(j.entries[len(entries):])
+	j.entries = entries
+	return n
+}
+
+// Err returns the first error writing to Output. Entries after it are
+// lost.
+func (j *Journal[K]) Err() error {
+	return j.err
+}
+
+func writeJournalEntry[K cmp.Ordered](w io.Writer, entry JournalEntry[K]) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode journal entry %d: %w", entry.Seq, err)
+	}
+	_, err = w.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("write journal entry %d: %w", entry.Seq, err)
+	}
+	return nil
+}
+
+// journal records a mutation in the graph's Journal, if it has one.
+func (h *Graph[K]) journal(seq uint64, op string, key K) {
+	if h.Journal != nil {
+		h.Journal.record(seq, op, key)
+	}
+}
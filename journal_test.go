@@ -0,0 +1,64 @@
+package hnsw
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now     = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		journal = &Journal[int]{
+			Clock: func() time.Time {
+				now = now.Add(time.Second)
+				return now
+			},
+		}
+		g = newTestGraph[int]()
+	)
+	g.Journal = journal
+	journal.Actor = "alice"
+	g.Add(MakeNode(1, Vector{1}), MakeNode(2, Vector{2}))
+	journal.Actor = "bob"
+	g.Delete(1)
+	g.Delete(1)
+	g.ApplyTombstones(map[int]uint64{2: 10})
+
+	require.Equal(t, []JournalEntry[int]{
+		{Seq: 1, Time: now.Add(-3 * time.Second), Actor: "alice", Op: JournalAdd, Key: 1},
+		{Seq: 2, Time: now.Add(-2 * time.Second), Actor: "alice", Op: JournalAdd, Key: 2},
+		{Seq: 3, Time: now.Add(-1 * time.Second), Actor: "bob", Op: JournalDelete, Key: 1},
+		{Seq: 10, Time: now, Actor: "bob", Op: JournalDelete, Key: 2},
+	}, journal.Entries())
+
+	var buf bytes.Buffer
+	require.NoError(t, journal.ExportNDJSON(&buf))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, `{"seq":1,"time":"2024-01-02T03:04:06Z","actor":"alice","op":"add","key":1}`, lines[0])
+
+	// With Output set, entries are written rather than kept.
+	buf.Reset()
+	journal.Output = &buf
+	g.Add(MakeNode(3, Vector{3}))
+	require.Len(t, journal.Entries(), 4)
+	require.Equal(t, `{"seq":11,"time":"2024-01-02T03:04:10Z","actor":"bob","op":"add","key":3}`+"\n", buf.String())
+	require.NoError(t, journal.Err())
+
+	journal.Output = failingWriter{}
+	g.Delete(3)
+	require.Error(t, journal.Err())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
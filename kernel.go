@@ -0,0 +1,155 @@
+package hnsw
+
+import "math"
+
+// kernel is an implementation of the inner loops of the distance
+// functions and vector arithmetic for a class of CPUs.
+type kernel struct {
+	name             string
+	cosineSimilarity func(a, b []float32) float32
+	euclidean        func(a, b []float32) float32
+	dot              func(a, b []float32) float32
+
+	// add and sub add b to and subtract b from a in place, and scale
+	// multiplies a by s in place.
+	add   func(a, b []float32)
+	sub   func(a, b []float32)
+	scale func(a []float32, s float32)
+}
+
+// genericKernel is the portable pure-Go kernel. Its loops are unrolled
+// with independent accumulators, which lets superscalar CPUs overlap the
+// floating point operations. It is used on CPUs without SIMD support in
+// vek, including ARM64, for which there are no NEON or SVE kernels.
+var genericKernel = kernel{
+	name:             "generic",
+	cosineSimilarity: cosineSimilarityGeneric,
+	euclidean:        euclideanGeneric,
+	dot:              dotGeneric,
+	add:              addGeneric,
+	sub:              subGeneric,
+	scale:            scaleGeneric,
+}
+
+// activeKernel is the kernel used by the distance functions, chosen
+// once at startup.
+var activeKernel = selectKernel()
+
+// selectKernel returns the first kernel supported by the CPU, preferring
+// platform-specific kernels over the generic one.
+func selectKernel() kernel {
+	if ks := platformKernels(); len(ks) > 0 {
+		return ks[0]
+	}
+	return genericKernel
+}
+
+// DistanceKernel returns the name of the implementation used by
+// CosineDistance and EuclideanDistance, chosen at startup for the CPU:
+// "vek" for the SIMD cosine kernel of github.com/viterin/vek, which is
+// used on amd64 CPUs with AVX2 and FMA, or "generic" for the portable
+// pure-Go kernel used everywhere else, e.g. on ARM64. Building with the purego
+// tag, or for wasm or TinyGo, always selects the generic kernel and drops
+// the dependency on vek.
+func DistanceKernel() string {
+	return activeKernel.name
+}
+
+func cosineSimilarityGeneric(a, b []float32) float32 {
+	var (
+		dot0, dot1, dot2, dot3         float32
+		normA0, normA1, normA2, normA3 float32
+		normB0, normB1, normB2, normB3 float32
+		i                              int
+	)
+	b = b[:len(a)]
+	for ; i+4 <= len(a); i += 4 {
+		a0, a1, a2, a3 := a[i], a[i+1], a[i+2], a[i+3]
+		b0, b1, b2, b3 := b[i], b[i+1], b[i+2], b[i+3]
+		dot0 += a0 * b0
+		dot1 += a1 * b1
+		dot2 += a2 * b2
+		dot3 += a3 * b3
+		normA0 += a0 * a0
+		normA1 += a1 * a1
+		normA2 += a2 * a2
+		normA3 += a3 * a3
+		normB0 += b0 * b0
+		normB1 += b1 * b1
+		normB2 += b2 * b2
+		normB3 += b3 * b3
+	}
+	for ; i < len(a); i++ {
+		dot0 += a[i] * b[i]
+		normA0 += a[i] * a[i]
+		normB0 += b[i] * b[i]
+	}
+	var (
+		dot   = (dot0 + dot1) + (dot2 + dot3)
+		normA = (normA0 + normA1) + (normA2 + normA3)
+		normB = (normB0 + normB1) + (normB2 + normB3)
+	)
+	return dot / float32(math.Sqrt(float64(normA))*math.Sqrt(float64(normB)))
+}
+
+func euclideanGeneric(a, b []float32) float32 {
+	var (
+		sum0, sum1, sum2, sum3 float32
+		i                      int
+	)
+	b = b[:len(a)]
+	for ; i+4 <= len(a); i += 4 {
+		d0 := a[i] - b[i]
+		d1 := a[i+1] - b[i+1]
+		d2 := a[i+2] - b[i+2]
+		d3 := a[i+3] - b[i+3]
+		sum0 += d0 * d0
+		sum1 += d1 * d1
+		sum2 += d2 * d2
+		sum3 += d3 * d3
+	}
+	for ; i < len(a); i++ {
+		d := a[i] - b[i]
+		sum0 += d * d
+	}
+	sum := (sum0 + sum1) + (sum2 + sum3)
+	return float32(math.Sqrt(float64(sum)))
+}
+
+func dotGeneric(a, b []float32) float32 {
+	var (
+		dot0, dot1, dot2, dot3 float32
+		i                      int
+	)
+	b = b[:len(a)]
+	for ; i+4 <= len(a); i += 4 {
+		dot0 += a[i] * b[i]
+		dot1 += a[i+1] * b[i+1]
+		dot2 += a[i+2] * b[i+2]
+		dot3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		dot0 += a[i] * b[i]
+	}
+	return (dot0 + dot1) + (dot2 + dot3)
+}
+
+func addGeneric(a, b []float32) {
+	b = b[:len(a)]
+	for i := range a {
+		a[i] += b[i]
+	}
+}
+
+func subGeneric(a, b []float32) {
+	b = b[:len(a)]
+	for i := range a {
+		a[i] -= b[i]
+	}
+}
+
+func scaleGeneric(a []float32, s float32) {
+	for i := range a {
+		a[i] *= s
+	}
+}
@@ -0,0 +1,69 @@
+package hnsw
+
+import (
+	"slices"
+)
+
+// Integer is the constraint of keys that NextKey can allocate.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// NextKey allocates a key for a node of g, for applications without
+// natural keys. Keys count up from 1, skipping keys in the graph and
+// deleted keys with tombstones, so that a key is never reused by NextKey.
+//
+// The last key allocated is exported with the graph, so a graph restored
+// with Import or LoadSavedGraph keeps allocating new keys. Keys allocated
+// but not added, or added since the snapshot of a SavedGraph and then
+// lost, may be allocated again.
+//
+// It panics if the keys of K are exhausted.
+func NextKey[K Integer](g *Graph[K]) K {
+	for {
+		g.lastKey++
+		key := K(g.lastKey)
+		if key <= 0 || uint64(key) != g.lastKey {
+			panic("hnsw: NextKey exhausted the keys")
+		}
+		if _, ok := g.ids[key]; ok {
+			continue
+		}
+		if _, ok := g.tombstones[key]; ok {
+			continue
+		}
+		return key
+	}
+}
+
+// KeysInRange returns the keys of the graph in [lo, hi), in ascending
+// order, e.g. those of a tenant with keys prefixed by its name, or those
+// in a period with keys prefixed by a timestamp.
+//
+// The sorted keys are cached until a key is deleted or a key is added
+// that isn't greater than all others, so scans of a graph that is
+// appended to in key order are O(log n) plus the size of the range. As
+// it updates the cache, it must not be called concurrently with other
+// methods, even those that only read the graph.
+func (h *Graph[K]) KeysInRange(lo, hi K) []K {
+	if h.sortedKeys == nil && len(h.ids) > 0 {
+		h.sortedKeys = make([]K, 0, len(h.ids))
+		for key := range h.ids {
+			h.sortedKeys = append(h.sortedKeys, key)
+		}
+		slices.Sort(h.sortedKeys)
+	}
+	start, _ := slices.BinarySearch(h.sortedKeys, lo)
+	end, _ := slices.BinarySearch(h.sortedKeys, hi)
+	if end <= start {
+		return nil
+	}
+	return slices.Clone(h.sortedKeys[start:end])
+}
+
+// DeleteRange removes the nodes with keys in [lo, hi), as with
+// BatchDelete, and returns the number of nodes deleted.
+func (h *Graph[K]) DeleteRange(lo, hi K) int {
+	return h.BatchDelete(h.KeysInRange(lo, hi)...)
+}
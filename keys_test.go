@@ -0,0 +1,78 @@
+package hnsw
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextKey(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	g.Add(MakeNode(2, Vector{2}))
+	require.Equal(t, 1, NextKey(g))
+	// Keys in the graph are skipped.
+	require.Equal(t, 3, NextKey(g))
+	g.Add(MakeNode(3, Vector{3}), MakeNode(4, Vector{4}))
+	require.True(t, g.Delete(4))
+	// So are deleted keys.
+	require.Equal(t, 5, NextKey(g))
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Export(&buf))
+	imported := newTestGraph[int]()
+	require.NoError(t, imported.Import(&buf))
+	require.Equal(t, 6, NextKey(imported))
+
+	small := newTestGraph[int8]()
+	small.lastKey = 126
+	require.Equal(t, int8(127), NextKey(small))
+	require.Panics(t, func() { NextKey(small) })
+}
+
+func TestNextKey_SavedGraph(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "graph")
+	g, err := LoadSavedGraph[uint64](path)
+	require.NoError(t, err)
+	g.Add(MakeNode(NextKey(g.Graph), Vector{1}))
+	require.NoError(t, g.Save())
+
+	// Keys saved incrementally aren't allocated again.
+	key := NextKey(g.Graph)
+	g.Add(MakeNode(key, Vector{2}))
+	require.NoError(t, g.SaveIncremental())
+
+	g, err = LoadSavedGraph[uint64](path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), NextKey(g.Graph))
+}
+
+func TestGraph_KeysInRange(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[string]()
+	require.Nil(t, g.KeysInRange("a", "z"))
+	for _, key := range []string{"b/2", "a/1", "a/3", "b/1", "a/2"} {
+		g.Add(MakeNode(key, Vector{float32(len(g.ids))}))
+	}
+	require.Equal(t, []string{"a/1", "a/2", "a/3"}, g.KeysInRange("a/", "a0"))
+	require.Equal(t, []string{"a/2", "a/3", "b/1"}, g.KeysInRange("a/2", "b/2"))
+	require.Nil(t, g.KeysInRange("b/2", "b/1"))
+	require.Nil(t, g.KeysInRange("c", "d"))
+
+	// Appending in key order keeps the cache, others invalidate it.
+	g.Add(MakeNode("c/1", Vector{5}))
+	require.Len(t, g.sortedKeys, 6)
+	g.Add(MakeNode("a/0", Vector{6}))
+	require.Nil(t, g.sortedKeys)
+	require.Equal(t, []string{"a/0", "a/1", "a/2", "a/3"}, g.KeysInRange("a/", "a0"))
+
+	require.Equal(t, 2, g.DeleteRange("b/", "b0"))
+	require.Equal(t, []string{"a/0", "a/1", "a/2", "a/3", "c/1"}, g.KeysInRange("", "z"))
+	require.Equal(t, 5, g.Len())
+}
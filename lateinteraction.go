@@ -0,0 +1,155 @@
+package hnsw
+
+import (
+	"cmp"
+	"slices"
+)
+
+// LateInteractionResult is a document found by LateInteractionIndex.Search.
+type LateInteractionResult[K cmp.Ordered] struct {
+	Key K
+
+	// Score is the MaxSim score of the document: the sum, over the query's
+	// tokens, of the highest similarity between the token and any of the
+	// document's tokens. The similarity is 1 minus the distance, which is
+	// the cosine similarity with CosineDistance.
+	Score float32
+}
+
+// LateInteractionIndex stores an embedding per token of each document,
+// and ranks documents by late interaction, as in ColBERT: every query
+// token is matched with its most similar document token.
+//
+// Scoring every document is too slow for large collections, so the
+// candidates are the documents owning the nearest tokens to each query
+// token, found in Tokens, and only they are scored exactly.
+type LateInteractionIndex[K cmp.Ordered] struct {
+	// Tokens holds the token embeddings, keyed by internal token IDs. Its
+	// parameters configure the search for candidates. It must not be
+	// modified directly.
+	Tokens *Graph[uint64]
+
+	// Candidates is the number of nearest tokens retrieved per query
+	// token. Defaults to Tokens.EfSearch.
+	Candidates int
+
+	docs   map[K][]uint64
+	owners map[uint64]K
+	nextID uint64
+}
+
+// NewLateInteractionIndex returns a new LateInteractionIndex with the
+// defaults of NewGraph.
+func NewLateInteractionIndex[K cmp.Ordered]() *LateInteractionIndex[K] {
+	return &LateInteractionIndex[K]{Tokens: NewGraph[uint64]()}
+}
+
+// Add inserts a document with the embeddings of its tokens, replacing the
+// document with the same key.
+func (x *LateInteractionIndex[K]) Add(key K, tokens ...Vector) {
+	if len(tokens) == 0 {
+		panic("hnsw: LateInteractionIndex documents need tokens")
+	}
+	if x.docs == nil {
+		x.docs = make(map[K][]uint64)
+		x.owners = make(map[uint64]K)
+	}
+	x.Delete(key)
+	var (
+		ids   = make([]uint64, len(tokens))
+		nodes = make([]Node[uint64], len(tokens))
+	)
+	for i, token := range tokens {
+		ids[i] = x.nextID
+		x.owners[x.nextID] = key
+		nodes[i] = MakeNode(x.nextID, token)
+		x.nextID++
+	}
+	x.Tokens.Add(nodes...)
+	x.docs[key] = ids
+}
+
+// Delete removes the document with the given key, and reports whether it
+// existed.
+func (x *LateInteractionIndex[K]) Delete(key K) bool {
+	ids, ok := x.docs[key]
+	if !ok {
+		return false
+	}
+	for _, id := range ids {
+		x.Tokens.Delete(id)
+		delete(x.owners, id)
+	}
+	delete(x.docs, key)
+	return true
+}
+
+// Lookup returns the token embeddings of the document with the given key.
+func (x *LateInteractionIndex[K]) Lookup(key K) ([]Vector, bool) {
+	ids, ok := x.docs[key]
+	if !ok {
+		return nil, false
+	}
+	tokens := make([]Vector, len(ids))
+	for i, id := range ids {
+		tokens[i], _ = x.Tokens.Lookup(id)
+	}
+	return tokens, true
+}
+
+// Len returns the number of documents in the index.
+func (x *LateInteractionIndex[K]) Len() int {
+	return len(x.docs)
+}
+
+// Search returns the k documents with the highest MaxSim score for the
+// embeddings of the query's tokens, highest first.
+func (x *LateInteractionIndex[K]) Search(query []Vector, k int) []LateInteractionResult[K] {
+	if k <= 0 || len(query) == 0 {
+		return nil
+	}
+	n := x.Candidates
+	if n <= 0 {
+		n = x.Tokens.EfSearch
+	}
+	candidates := make(map[K]struct{})
+	for _, token := range query {
+		for _, node := range x.Tokens.Search(token, max(k, n)) {
+			candidates[x.owners[node.Key]] = struct{}{}
+		}
+	}
+
+	results := make([]LateInteractionResult[K], 0, len(candidates))
+	for key := range candidates {
+		results = append(results, LateInteractionResult[K]{
+			Key:   key,
+			Score: x.maxSim(query, x.docs[key]),
+		})
+	}
+	slices.SortFunc(results, func(a, b LateInteractionResult[K]) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return results[:min(k, len(results))]
+}
+
+// maxSim returns the MaxSim score of the document with the given tokens.
+func (x *LateInteractionIndex[K]) maxSim(query []Vector, ids []uint64) float32 {
+	tokens := make([]Vector, 0, len(ids))
+	for _, id := range ids {
+		if vec, ok := x.Tokens.Lookup(id); ok {
+			tokens = append(tokens, vec)
+		}
+	}
+	var score float32
+	for _, q := range query {
+		best := float32(-1 << 30)
+		for _, t := range tokens {
+			best = max(best, 1-x.Tokens.Distance(q, t))
+		}
+		score += best
+	}
+	return score
+}
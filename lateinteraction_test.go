@@ -0,0 +1,47 @@
+package hnsw
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLateInteractionIndex(t *testing.T) {
+	t.Parallel()
+
+	x := NewLateInteractionIndex[string]()
+	x.Tokens.Rng = rand.New(rand.NewSource(0))
+	x.Add("cats", Vector{1, 0, 0}, Vector{0.9, 0.1, 0})
+	// Matches one query token exactly, but not the other.
+	x.Add("cats and dogs", Vector{1, 0, 0}, Vector{0, 1, 0})
+	x.Add("fish", Vector{0, 0, 1})
+	require.Equal(t, 3, x.Len())
+
+	keys := func(results []LateInteractionResult[string]) []string {
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.Key
+		}
+		return out
+	}
+	query := []Vector{{1, 0, 0}, {0, 1, 0}}
+	results := x.Search(query, 3)
+	require.Equal(t, []string{"cats and dogs", "cats", "fish"}, keys(results))
+	require.InDelta(t, 2, results[0].Score, 1e-6)
+	require.InDelta(t, 0, results[2].Score, 1e-6)
+	require.Equal(t, []string{"cats and dogs"}, keys(x.Search(query, 1)))
+
+	// Replacing a document replaces all its tokens.
+	x.Add("cats and dogs", Vector{0, 0, 1})
+	tokens, ok := x.Lookup("cats and dogs")
+	require.True(t, ok)
+	require.Equal(t, []Vector{{0, 0, 1}}, tokens)
+	require.Equal(t, 4, x.Tokens.Len())
+	require.Equal(t, "cats", x.Search(query, 1)[0].Key)
+
+	require.True(t, x.Delete("cats"))
+	require.False(t, x.Delete("cats"))
+	require.Equal(t, 2, x.Tokens.Len())
+	require.Equal(t, 2, x.Len())
+}
@@ -0,0 +1,127 @@
+package hnsw
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// LiveGraph serves searches from a graph that can be replaced without
+// downtime, e.g. by a new index version loaded in the background. Searches
+// always run against a complete graph, either the old or the new one.
+//
+// The graph must not be modified while it is served, except through
+// external synchronization as for Graph.Search.
+type LiveGraph[K cmp.Ordered] struct {
+	current atomic.Pointer[liveVersion[K]]
+}
+
+// liveVersion is a graph served by LiveGraph, with the number of
+// operations using it.
+type liveVersion[K cmp.Ordered] struct {
+	graph   *Graph[K]
+	refs    atomic.Int64
+	retired atomic.Bool
+	once    sync.Once
+	// swapped is closed once the version is retired, and done once it
+	// is also unused.
+	swapped chan struct{}
+	done    chan struct{}
+}
+
+func newLiveVersion[K cmp.Ordered](g *Graph[K]) *liveVersion[K] {
+	return &liveVersion[K]{
+		graph:   g,
+		swapped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// release drops a reference to the version.
+func (v *liveVersion[K]) release() {
+	if v.refs.Add(-1) == 0 && v.retired.Load() {
+		v.once.Do(func() { close(v.done) })
+	}
+}
+
+// NewLiveGraph returns a LiveGraph serving g.
+func NewLiveGraph[K cmp.Ordered](g *Graph[K]) *LiveGraph[K] {
+	l := &LiveGraph[K]{}
+	l.current.Store(newLiveVersion(g))
+	return l
+}
+
+// acquire returns the current version, referenced until released.
+func (l *LiveGraph[K]) acquire() *liveVersion[K] {
+	for {
+		v := l.current.Load()
+		v.refs.Add(1)
+		// The version may have been swapped out before the reference
+		// was taken, in which case SwapFrom may not wait for it.
+		if l.current.Load() == v {
+			return v
+		}
+		v.release()
+	}
+}
+
+// Acquire returns the graph currently served, and a function that must be
+// called once the caller is done with it. Until then, SwapFrom waits
+// before returning the graph.
+func (l *LiveGraph[K]) Acquire() (*Graph[K], func()) {
+	v := l.acquire()
+	return v.graph, v.release
+}
+
+// Search is like Graph.Search on the graph currently served.
+func (l *LiveGraph[K]) Search(near Vector, k int) []Node[K] {
+	v := l.acquire()
+	defer v.release()
+	return v.graph.Search(near, k)
+}
+
+// SearchWithOptions is like Graph.SearchWithOptions on the graph
+// currently served.
+func (l *LiveGraph[K]) SearchWithOptions(near Vector, k int, opts SearchOptions) []SearchResult[K] {
+	v := l.acquire()
+	defer v.release()
+	return v.graph.SearchWithOptions(near, k, opts)
+}
+
+// SearchAfter is like Graph.SearchAfter, but waits for a graph that has
+// applied the mutation with sequence number seq to be swapped in, rather
+// than failing right away. If ctx is done first, it returns an error
+// matching both ErrBehind and the context's error.
+func (l *LiveGraph[K]) SearchAfter(ctx context.Context, seq uint64, near Vector, k int, opts SearchOptions) ([]SearchResult[K], error) {
+	for {
+		v := l.acquire()
+		if v.graph.Seq() >= seq {
+			defer v.release()
+			return v.graph.SearchWithOptions(near, k, opts), nil
+		}
+		v.release()
+
+		select {
+		case <-v.swapped:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: at %d, not %d: %w", ErrBehind, v.graph.Seq(), seq, ctx.Err())
+		}
+	}
+}
+
+// SwapFrom atomically replaces the graph served with other. Searches
+// started afterwards use other, while SwapFrom waits for searches on the
+// old graph to complete. It then returns the old graph, which is no
+// longer referenced and may be discarded or modified.
+func (l *LiveGraph[K]) SwapFrom(other *Graph[K]) *Graph[K] {
+	old := l.current.Swap(newLiveVersion(other))
+	old.retired.Store(true)
+	close(old.swapped)
+	if old.refs.Load() == 0 {
+		old.once.Do(func() { close(old.done) })
+	}
+	<-old.done
+	return old.graph
+}
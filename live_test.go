@@ -0,0 +1,102 @@
+package hnsw
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveGraph_SwapFrom(t *testing.T) {
+	t.Parallel()
+
+	newGraph := func(offset int) *Graph[int] {
+		g := newTestGraph[int]()
+		for i := 0; i < 64; i++ {
+			g.Add(MakeNode(i+offset, Vector{float32(i)}))
+		}
+		return g
+	}
+	g1, g2 := newGraph(0), newGraph(1000)
+	l := NewLiveGraph(g1)
+	require.Equal(t, 10, l.Search(Vector{10}, 1)[0].Key)
+
+	// Searches keep running against a complete graph while swapping.
+	var (
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := l.SearchWithOptions(Vector{10}, 1, SearchOptions{})[0].Key
+				if key != 10 && key != 1010 {
+					t.Errorf("unexpected key %d", key)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		require.Same(t, g1, l.SwapFrom(g2))
+		require.Same(t, g2, l.SwapFrom(g1))
+	}
+	close(stop)
+	wg.Wait()
+
+	// SwapFrom waits for graphs in use.
+	g, release := l.Acquire()
+	require.Same(t, g1, g)
+	swapped := make(chan *Graph[int])
+	go func() { swapped <- l.SwapFrom(g2) }()
+	select {
+	case <-swapped:
+		t.Fatal("SwapFrom returned while the graph is in use")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	require.Same(t, g1, <-swapped)
+	require.Equal(t, 1010, l.Search(Vector{10}, 1)[0].Key)
+}
+
+func TestLiveGraph_SearchAfter(t *testing.T) {
+	t.Parallel()
+
+	g1 := newTestGraph[int]()
+	g1.Add(MakeNode(1, Vector{1}))
+	g2 := newTestGraph[int]()
+	g2.Add(MakeNode(1, Vector{1}), MakeNode(2, Vector{2}))
+	seq := g2.Seq()
+	l := NewLiveGraph(g1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := l.SearchAfter(ctx, seq, Vector{2}, 1, SearchOptions{})
+	require.ErrorIs(t, err, ErrBehind)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The search waits for a graph that caught up.
+	done := make(chan []SearchResult[int])
+	go func() {
+		results, err := l.SearchAfter(context.Background(), seq, Vector{2}, 1, SearchOptions{})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- results
+	}()
+	select {
+	case <-done:
+		t.Fatal("SearchAfter returned before the graph caught up")
+	case <-time.After(10 * time.Millisecond):
+	}
+	l.SwapFrom(g2)
+	require.Equal(t, 2, (<-done)[0].Key)
+}
@@ -0,0 +1,39 @@
+package hnsw
+
+import "log/slog"
+
+// warn logs a sign of degradation of the graph, if it has a Logger.
+func (h *Graph[K]) warn(msg string, args ...any) {
+	if h.Logger != nil {
+		h.Logger.Warn(msg, args...)
+	}
+}
+
+// warnIsolated warns about nodes of a layer that were left without
+// neighbors by a delete, which makes them unreachable by searches.
+func (h *Graph[K]) warnIsolated(level int, nodes []*layerNode) {
+	if h.Logger == nil || h.layers[level].size() < 2 {
+		return
+	}
+	for _, node := range nodes {
+		if len(node.neighbors) == 0 {
+			key, _ := h.Key(node.id)
+			h.warn("hnsw: node has no neighbors after repair",
+				slog.Any("key", key),
+				slog.Int("level", level),
+			)
+		}
+	}
+}
+
+// warnNaN warns about NaN distances encountered by an operation, e.g.
+// from zero vectors with CosineDistance. NaN distances compare as
+// neither closer nor farther, so they silently degrade the graph.
+func (h *Graph[K]) warnNaN(op string, stats *searchStats) {
+	if stats != nil && stats.nans > 0 {
+		h.warn("hnsw: NaN distances",
+			slog.String("op", op),
+			slog.Int("count", stats.nans),
+		)
+	}
+}
@@ -0,0 +1,50 @@
+package hnsw
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_Logger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	g := newTestGraph[int]()
+	g.Distance = CosineDistance
+	g.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	g.Add(MakeNode(1, Vector{1, 0}), MakeNode(2, Vector{0, 1}))
+	require.Empty(t, buf.String())
+
+	// Zero vectors have no direction.
+	g.Add(MakeNode(3, Vector{0, 0}))
+	require.Contains(t, buf.String(), "hnsw: NaN distances")
+	require.Contains(t, buf.String(), "op=Add")
+
+	buf.Reset()
+	g.Search(Vector{0, 0}, 1)
+	require.Contains(t, buf.String(), "op=Search")
+}
+
+func TestGraph_LoggerIsolated(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	g := newTestGraph[int]()
+	g.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	// A star whose center is the only connection between the others.
+	g.Add(MakeNode(0, Vector{0, 0}))
+	for i := 1; i <= 2; i++ {
+		g.Add(MakeNode(i, Vector{float32(i), 0}))
+	}
+	g.layers[0].nodes[g.ids[1]].unlink(g.ids[2])
+	g.layers[0].nodes[g.ids[2]].unlink(g.ids[1])
+	g.M = 0
+
+	g.Delete(0)
+	require.Contains(t, buf.String(), "hnsw: node has no neighbors after repair")
+}
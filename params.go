@@ -0,0 +1,330 @@
+package hnsw
+
+import (
+	"cmp"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// ParamsOptions describes the workload that RecommendParams tunes
+// the graph parameters for.
+type ParamsOptions struct {
+	// Size is the expected number of nodes in the graph.
+	Size int
+
+	// Latency is the target latency of a single search. It requires a
+	// Sample to time searches on, and is ignored without one. If zero,
+	// EfSearch is derived from M and K alone.
+	Latency time.Duration
+
+	// K is the expected number of results per search. Defaults to 10.
+	K int
+
+	// Sample is a set of vectors representative of the data set. If set,
+	// EfSearch is calibrated by building a graph from the sample and
+	// timing searches on it. A few hundred to a few thousand vectors give
+	// stable results.
+	Sample []Vector
+
+	// Distance is the distance function of the graph. Defaults to
+	// CosineDistance.
+	Distance DistanceFunc
+}
+
+// Params are graph parameters recommended by RecommendParams.
+type Params struct {
+	M        int
+	Ml       float64
+	EfSearch int
+
+	// Latency and Recall are the search latency, extrapolated to the
+	// expected size, and the recall of the k nearest neighbors measured
+	// on the sample. They are zero without a sample.
+	Latency time.Duration
+	Recall  float64
+}
+
+const (
+	minParamsM        = 8
+	maxParamsM        = 48
+	maxParamsEfSearch = 512
+)
+
+// RecommendParams recommends M, Ml and EfSearch for a graph.
+//
+// M grows with the logarithm of the expected size, within the range of
+// 8 to 48 suggested by the HNSW paper, and Ml is set to 1/M, the paper's
+// optimal level generation factor. Without a sample or a target latency,
+// EfSearch is 2*M, or K if that is larger; a target latency alone is
+// ignored, as there is nothing to time. With a sample and a target
+// latency, it is the largest power of two, at most 512, whose search
+// latency on the sample, extrapolated to the expected size, meets the
+// target.
+//
+// The recommendation is a starting point, the recall of a data set
+// should still be verified with representative queries.
+func RecommendParams(opts ParamsOptions) Params {
+	if opts.K <= 0 {
+		opts.K = 10
+	}
+	if opts.Distance == nil {
+		opts.Distance = CosineDistance
+	}
+
+	m := minParamsM
+	if opts.Size > 1 {
+		m = int(math.Ceil(math.Log2(float64(opts.Size))))
+	}
+	m = min(max(m, minParamsM), maxParamsM)
+
+	p := Params{
+		M:        m,
+		Ml:       1 / float64(m),
+		EfSearch: max(2*m, opts.K),
+	}
+	if len(opts.Sample) > 0 {
+		p.calibrate(opts)
+	}
+	return p
+}
+
+// calibrate picks EfSearch by measuring searches on a graph built from
+// the sample.
+func (p *Params) calibrate(opts ParamsOptions) {
+	g := &Graph[int]{
+		Distance: opts.Distance,
+		Rng:      rand.New(rand.NewSource(1)),
+		M:        p.M,
+		Ml:       p.Ml,
+	}
+	for i, vec := range opts.Sample {
+		g.Add(MakeNode(i, vec))
+	}
+
+	// Use a subset of the sample as queries, and compare against exact
+	// results to measure recall.
+	queries := opts.Sample
+	if len(queries) > 100 {
+		queries = queries[:100]
+	}
+	exact := make([][]int, len(queries))
+	for i, q := range queries {
+		exact[i] = exactNeighbors(opts.Sample, q, opts.K, opts.Distance)
+	}
+
+	// Search cost grows with the number of layers to descend, which is
+	// logarithmic in the size of the graph.
+	scale := 1.0
+	if opts.Size > len(opts.Sample) && len(opts.Sample) > 1 {
+		scale = math.Log(float64(opts.Size)) / math.Log(float64(len(opts.Sample)))
+	}
+
+	measure := func(ef int) (time.Duration, float64) {
+		g.EfSearch = ef
+		var (
+			found int
+			start = time.Now()
+		)
+		for i, q := range queries {
+			for _, result := range g.Search(q, opts.K) {
+				if slices.Contains(exact[i], result.Key) {
+					found++
+				}
+			}
+		}
+		latency := time.Duration(float64(time.Since(start)) / float64(len(queries)) * scale)
+		return latency, float64(found) / float64(len(queries)*min(opts.K, len(opts.Sample)))
+	}
+
+	if opts.Latency == 0 {
+		p.Latency, p.Recall = measure(p.EfSearch)
+		return
+	}
+	for ef := min(opts.K, maxParamsEfSearch); ; ef = min(2*ef, maxParamsEfSearch) {
+		latency, recall := measure(ef)
+		if latency > opts.Latency && ef > opts.K {
+			// Keep the last EfSearch that met the target.
+			break
+		}
+		p.EfSearch, p.Latency, p.Recall = ef, latency, recall
+		if latency > opts.Latency || ef == maxParamsEfSearch {
+			break
+		}
+	}
+}
+
+// exactNeighbors returns the indices of the k vectors closest to q.
+func exactNeighbors(vecs []Vector, q Vector, k int, dist DistanceFunc) []int {
+	idx := make([]int, len(vecs))
+	for i := range idx {
+		idx[i] = i
+	}
+	dists := make([]float32, len(vecs))
+	for i, vec := range vecs {
+		dists[i] = dist(q, vec)
+	}
+	slices.SortStableFunc(idx, func(a, b int) int {
+		return cmp.Compare(dists[a], dists[b])
+	})
+	return idx[:min(k, len(idx))]
+}
+
+// SetParams sets the parameters of the graph. Like all parameters, they
+// must be set before adding nodes to the graph.
+func (g *Graph[K]) SetParams(p Params) {
+	g.M = p.M
+	g.Ml = p.Ml
+	g.EfSearch = p.EfSearch
+}
+
+// TuneOptions describes the data set and the targets that TuneParams
+// searches graph parameters for.
+type TuneOptions struct {
+	// Sample is a set of vectors representative of the data set. It is
+	// required, and a few thousand vectors give stable results.
+	Sample []Vector
+
+	// Queries are the vectors searched for. Defaults to up to 100
+	// vectors of the sample.
+	Queries []Vector
+
+	// K is the expected number of results per search. Defaults to 10.
+	K int
+
+	// Distance is the distance function of the graph. Defaults to
+	// CosineDistance.
+	Distance DistanceFunc
+
+	// Recall is the target recall of the K nearest neighbors. Defaults to
+	// 0.95.
+	Recall float64
+
+	// Latency, if not zero, is the target latency of a single search on
+	// the sample.
+	Latency time.Duration
+}
+
+// tuneM and tuneEfSearch are the values of M and EfSearch that TuneParams
+// tries. Each M is tried with Ml of 1/M and 1/ln(M).
+var (
+	tuneM        = []int{8, 12, 16, 24, 32, 48}
+	tuneEfSearch = []int{16, 32, 64, 128, 256}
+)
+
+// tuneMinSample is the number of sample vectors TuneParams starts with.
+const tuneMinSample = 128
+
+// TuneParams searches for the M, Ml and EfSearch that best meet the
+// targets of opts on the sample, by successive halving: every candidate
+// configuration is measured on a graph built from a small part of the
+// sample, the better half is kept, and the survivors are measured again
+// on twice as much of the sample, until one remains. Configurations
+// meeting the targets beat those that don't, and among them the fastest
+// wins. Otherwise, the one with the best recall wins.
+//
+// Unlike RecommendParams, it builds many graphs, so it takes a while on
+// large samples. The Latency and Recall of the result are measured on
+// the whole sample.
+func TuneParams(opts TuneOptions) Params {
+	if opts.K <= 0 {
+		opts.K = 10
+	}
+	if opts.Distance == nil {
+		opts.Distance = CosineDistance
+	}
+	if opts.Recall <= 0 {
+		opts.Recall = 0.95
+	}
+	if len(opts.Sample) == 0 {
+		return RecommendParams(ParamsOptions{K: opts.K})
+	}
+	if len(opts.Queries) == 0 {
+		opts.Queries = opts.Sample[:min(len(opts.Sample), 100)]
+	}
+
+	var candidates []Params
+	for _, m := range tuneM {
+		for _, ml := range []float64{1 / float64(m), 1 / math.Log(float64(m))} {
+			for _, ef := range tuneEfSearch {
+				candidates = append(candidates, Params{M: m, Ml: ml, EfSearch: max(ef, opts.K)})
+			}
+		}
+	}
+
+	size := min(tuneMinSample, len(opts.Sample))
+	for len(candidates) > 1 {
+		sample := opts.Sample[:size]
+		exact := tuneExact(sample, opts)
+		for i := range candidates {
+			candidates[i].measure(sample, opts.Queries, exact, opts)
+		}
+		slices.SortStableFunc(candidates, func(a, b Params) int {
+			return a.compareTuned(b, opts)
+		})
+		candidates = candidates[:(len(candidates)+1)/2]
+		size = min(2*size, len(opts.Sample))
+	}
+	best := candidates[0]
+	best.measure(opts.Sample, opts.Queries, tuneExact(opts.Sample, opts), opts)
+	return best
+}
+
+// tuneExact returns the exact neighbors of the queries of opts in sample.
+func tuneExact(sample []Vector, opts TuneOptions) [][]int {
+	exact := make([][]int, len(opts.Queries))
+	for i, q := range opts.Queries {
+		exact[i] = exactNeighbors(sample, q, opts.K, opts.Distance)
+	}
+	return exact
+}
+
+// measure builds a graph with the parameters from sample, and sets the
+// average latency and recall of searching it for queries, whose exact
+// neighbors in sample are given.
+func (p *Params) measure(sample, queries []Vector, exact [][]int, opts TuneOptions) {
+	g := &Graph[int]{
+		Distance: opts.Distance,
+		Rng:      rand.New(rand.NewSource(1)),
+	}
+	g.SetParams(*p)
+	for i, vec := range sample {
+		g.Add(MakeNode(i, vec))
+	}
+
+	var (
+		found, total int
+		start        = time.Now()
+	)
+	for i, q := range queries {
+		for _, result := range g.Search(q, opts.K) {
+			if slices.Contains(exact[i], result.Key) {
+				found++
+			}
+		}
+		total += len(exact[i])
+	}
+	p.Latency = time.Since(start) / time.Duration(len(queries))
+	p.Recall = float64(found) / float64(total)
+}
+
+// compareTuned orders tuned parameters from the best to the worst for the
+// targets of opts.
+func (p Params) compareTuned(o Params, opts TuneOptions) int {
+	meets := func(p Params) bool {
+		return p.Recall >= opts.Recall && (opts.Latency == 0 || p.Latency <= opts.Latency)
+	}
+	switch a, b := meets(p), meets(o); {
+	case a && !b:
+		return -1
+	case !a && b:
+		return 1
+	case a && b:
+		return cmp.Compare(p.Latency, o.Latency)
+	}
+	if c := cmp.Compare(o.Recall, p.Recall); c != 0 {
+		return c
+	}
+	return cmp.Compare(p.Latency, o.Latency)
+}
@@ -0,0 +1,92 @@
+package hnsw
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecommendParams(t *testing.T) {
+	t.Parallel()
+
+	p := RecommendParams(ParamsOptions{Size: 1_000_000})
+	require.Equal(t, 20, p.M)
+	require.Equal(t, 1/20.0, p.Ml)
+	require.Equal(t, 40, p.EfSearch)
+	require.Zero(t, p.Recall)
+	// Without a sample, a target latency can't be met.
+	require.Equal(t, p, RecommendParams(ParamsOptions{Size: 1_000_000, Latency: time.Nanosecond}))
+	require.Equal(t, 100, RecommendParams(ParamsOptions{Size: 1_000_000, K: 100}).EfSearch)
+
+	require.Equal(t, minParamsM, RecommendParams(ParamsOptions{}).M)
+	require.Equal(t, maxParamsM, RecommendParams(ParamsOptions{Size: 1 << 60}).M)
+
+	rng := rand.New(rand.NewSource(0))
+	sample := make([]Vector, 200)
+	for i := range sample {
+		sample[i] = Vector{rng.Float32(), rng.Float32(), rng.Float32()}
+	}
+	opts := ParamsOptions{
+		Size:     100_000,
+		K:        5,
+		Sample:   sample,
+		Distance: EuclideanDistance,
+	}
+
+	p = RecommendParams(opts)
+	require.Equal(t, 34, p.EfSearch)
+	require.Positive(t, p.Recall)
+	require.Positive(t, p.Latency)
+
+	// Searches can't meet the target, so the minimum is recommended.
+	opts.Latency = time.Nanosecond
+	require.Equal(t, opts.K, RecommendParams(opts).EfSearch)
+
+	opts.Latency = time.Hour
+	p = RecommendParams(opts)
+	require.Equal(t, maxParamsEfSearch, p.EfSearch)
+
+	g := &Graph[int]{}
+	g.SetParams(p)
+	require.Equal(t, p.M, g.M)
+	require.Equal(t, p.Ml, g.Ml)
+	require.Equal(t, p.EfSearch, g.EfSearch)
+}
+
+func TestTuneParams(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(0))
+	sample := make([]Vector, 300)
+	for i := range sample {
+		sample[i] = Vector{rng.Float32(), rng.Float32(), rng.Float32(), rng.Float32()}
+	}
+	opts := TuneOptions{
+		Sample:   sample,
+		K:        5,
+		Distance: EuclideanDistance,
+		Recall:   0.9,
+	}
+
+	p := TuneParams(opts)
+	require.Contains(t, tuneM, p.M)
+	require.GreaterOrEqual(t, p.Recall, 0.9)
+	require.Positive(t, p.Latency)
+
+	// Meeting the targets beats recall, which beats latency otherwise.
+	var (
+		fast    = Params{Recall: 0.9, Latency: time.Microsecond}
+		slow    = Params{Recall: 0.95, Latency: time.Millisecond}
+		precise = Params{Recall: 0.99, Latency: time.Second}
+	)
+	opts.Latency = time.Millisecond
+	require.Equal(t, -1, fast.compareTuned(slow, opts))
+	require.Equal(t, -1, slow.compareTuned(precise, opts))
+	opts.Latency = time.Nanosecond
+	require.Equal(t, -1, precise.compareTuned(slow, opts))
+	require.Equal(t, -1, slow.compareTuned(fast, opts))
+
+	require.Equal(t, RecommendParams(ParamsOptions{K: 5}), TuneParams(TuneOptions{K: 5}))
+}
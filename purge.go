@@ -0,0 +1,151 @@
+package hnsw
+
+import "cmp"
+
+// PurgeReport describes the removal of a key by PurgeKey.
+type PurgeReport[K cmp.Ordered] struct {
+	Key K
+
+	// Deleted reports whether the key had a node in the graph, and
+	// Tombstone whether it had a tombstone.
+	Deleted, Tombstone bool
+
+	// JournalEntries is the number of entries of the key removed from the
+	// Journal kept in memory.
+	JournalEntries int
+
+	// PendingRepairs is the number of references to deleted nodes
+	// removed from the repairs queued by DeferRepair.
+	PendingRepairs int
+
+	// Remaining lists where the key may still appear after the purge, as
+	// reported by VerifyAbsent. The purge is complete if it is empty.
+	Remaining []string
+}
+
+// PurgeKey removes every trace of a key from the graph, e.g. to honor a
+// request to erase the data of a user: its node, vector and edges, its
+// timestamp, boost and fields, its tombstone, and its entries in the
+// Journal kept in memory. The purge is recorded in the Journal as a
+// JournalPurge entry without the key.
+//
+// Unlike after Delete, the key isn't remembered as deleted, so replicas
+// or older snapshots still holding it may bring it back. Copies of the
+// graph are not purged: FrozenGraphs, caches, exports and
+// the files of a SavedGraph, until SavedGraph.Save rewrites them.
+func (h *Graph[K]) PurgeKey(key K) PurgeReport[K] {
+	report := PurgeReport[K]{Key: key}
+	if h.delete(key, nil) {
+		report.Deleted = true
+		h.seq++
+		h.markDirty(key)
+		var zero K
+		h.journal(h.seq, JournalPurge, zero)
+	}
+	report.PendingRepairs = h.prunePending()
+	if _, ok := h.tombstones[key]; ok {
+		delete(h.tombstones, key)
+		report.Tombstone = true
+	}
+	if h.Journal != nil {
+		report.JournalEntries = h.Journal.purge(key)
+	}
+	report.Remaining = h.VerifyAbsent(key)
+	return report
+}
+
+// prunePending removes references to deleted nodes from the queued
+// repairs, which Repair skips anyway, and returns the number removed.
+func (h *Graph[K]) prunePending() int {
+	var pruned int
+	pending := h.pending[:0]
+	for _, p := range h.pending {
+		if !h.live(p) {
+			pruned++
+			continue
+		}
+		live := h.liveNodes(p.level, p.deleted)
+		pruned += len(p.deleted) - len(live)
+		p.deleted = live
+		pending = append(pending, p)
+	}
+	clear(h.pending[len(pending):])
+	h.pending = pending
+	if len(h.pending) == 0 {
+		h.pending = nil
+	}
+	return pruned
+}
+
+// VerifyAbsent checks that a key appears nowhere in the graph, e.g. after
+// PurgeKey, and returns where it still does, or nil if it is absent:
+//
+//   - "node" if the key has a node.
+//   - "key table" if an internal ID still maps to the key.
+//   - "tombstone" if the key has a tombstone.
+//   - "adjacency" or "pending repairs" if edges or queued repairs still
+//     reference deleted nodes, which may hold the key's vector.
+//   - "unsaved changes" if the key changed since a SavedGraph last
+//     saved, so that its files may still hold it.
+//   - "journal" if the Journal kept in memory has entries for the key,
+//     and "journal output" if the Journal writes to an Output, which
+//     can't be checked.
+func (h *Graph[K]) VerifyAbsent(key K) []string {
+	var found []string
+	if _, ok := h.ids[key]; ok {
+		found = append(found, "node")
+	} else {
+		var free bitset
+		for _, id := range h.free {
+			free.set(id)
+		}
+		for id, k := range h.keys {
+			if k == key && !free.has(uint32(id)) {
+				found = append(found, "key table")
+				break
+			}
+		}
+	}
+	if _, ok := h.tombstones[key]; ok {
+		found = append(found, "tombstone")
+	}
+	if h.danglingEdges() {
+		found = append(found, "adjacency")
+	}
+	for _, p := range h.pending {
+		if !h.live(p) || len(h.liveNodes(p.level, p.deleted)) < len(p.deleted) {
+			found = append(found, "pending repairs")
+			break
+		}
+	}
+	if _, ok := h.dirty[key]; ok {
+		found = append(found, "unsaved changes")
+	}
+	if h.Journal != nil {
+		for _, entry := range h.Journal.entries {
+			if entry.Op != JournalPurge && entry.Key == key {
+				found = append(found, "journal")
+				break
+			}
+		}
+		if h.Journal.Output != nil {
+			found = append(found, "journal output")
+		}
+	}
+	return found
+}
+
+// danglingEdges reports whether any edge points to a node that is no
+// longer in its layer.
+func (h *Graph[K]) danglingEdges() bool {
+	for _, layer := range h.layers {
+		for _, node := range layer.nodes {
+			for _, neighbor := range node.neighbors {
+				if layer.nodes[neighbor.id] != neighbor {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
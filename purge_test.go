@@ -0,0 +1,78 @@
+package hnsw
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_PurgeKey(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	g.DebugChecks = true
+	g.Journal = &Journal[int]{}
+	for i := 0; i < 64; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	g.SetTimestamp(7, time.Unix(1, 0))
+	g.SetBoost(7, 2)
+	g.SetField(7, "price", 3)
+	g.Delete(7)
+	g.Add(MakeNode(7, Vector{7}))
+	require.Equal(t, []string{"node", "journal"}, g.VerifyAbsent(7))
+
+	report := g.PurgeKey(7)
+	require.Equal(t, PurgeReport[int]{Key: 7, Deleted: true, JournalEntries: 3}, report)
+	require.Nil(t, g.VerifyAbsent(7))
+	_, ok := g.Timestamp(7)
+	require.False(t, ok)
+	require.Equal(t, JournalPurge, g.Journal.Entries()[len(g.Journal.Entries())-1].Op)
+	require.Equal(t, 63, g.Len())
+
+	// Tombstones are purged too.
+	g.Delete(8)
+	require.Equal(t, []string{"tombstone", "journal"}, g.VerifyAbsent(8))
+	report = g.PurgeKey(8)
+	require.False(t, report.Deleted)
+	require.True(t, report.Tombstone)
+	require.Empty(t, report.Remaining)
+
+	// Repairs queued by DeferRepair don't hold on to purged nodes.
+	g.DeferRepair = true
+	g.Delete(10)
+	var output bytes.Buffer
+	g.Journal.Output = &output
+	report = g.PurgeKey(9)
+	require.True(t, report.Deleted)
+	require.Positive(t, report.PendingRepairs)
+	require.Equal(t, []string{"journal output"}, report.Remaining)
+	// Purge entries have no key, rather than the zero key.
+	require.NotContains(t, output.String(), `"key"`)
+	require.Contains(t, output.String(), `"op":"purge"`)
+	require.Positive(t, g.PendingRepairs())
+	g.Repair(0)
+	require.Equal(t, 11, g.Search(Vector{9.6}, 1)[0].Key)
+}
+
+func TestGraph_PurgeKey_SavedGraph(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "graph")
+	g, err := LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	g.Add(MakeNode(1, Vector{1}), MakeNode(2, Vector{2}))
+	require.NoError(t, g.Save())
+
+	require.Equal(t, []string{"unsaved changes"}, g.PurgeKey(1).Remaining)
+	require.NoError(t, g.Save())
+	require.Nil(t, g.VerifyAbsent(1))
+
+	g, err = LoadSavedGraph[int](path)
+	require.NoError(t, err)
+	require.Nil(t, g.VerifyAbsent(1))
+	require.Equal(t, 1, g.Len())
+}
@@ -0,0 +1,181 @@
+package hnsw
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// SetTimestamp sets the timestamp of a node, e.g. its creation time, for
+// ranking by recency with SearchOptions.HalfLife. It reports whether the
+// key is in the graph. Replacing or deleting the node clears its
+// timestamp. Timestamps are not persisted by Export.
+func (g *Graph[K]) SetTimestamp(key K, t time.Time) bool {
+	id, ok := g.ids[key]
+	if !ok {
+		return false
+	}
+	if int(id) >= len(g.timestamps) {
+		g.timestamps = append(g.timestamps, make([]int64, len(g.keys)-len(g.timestamps))...)
+	}
+	g.timestamps[id] = t.UnixNano()
+	return true
+}
+
+// Timestamp returns the timestamp set by SetTimestamp.
+func (g *Graph[K]) Timestamp(key K) (time.Time, bool) {
+	id, ok := g.ids[key]
+	if !ok || int(id) >= len(g.timestamps) || g.timestamps[id] == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, g.timestamps[id]), true
+}
+
+// SetBoost sets the static boost of a node in [0, 1], e.g. its
+// popularity, for ranking with SearchOptions.BoostWeight. Boosts outside
+// of [0, 1] are clamped. It reports whether the key is in the graph.
+// Replacing or deleting the node clears its boost. Boosts are not
+// persisted by Export.
+func (g *Graph[K]) SetBoost(key K, boost float32) bool {
+	id, ok := g.ids[key]
+	if !ok {
+		return false
+	}
+	if int(id) >= len(g.boosts) {
+		g.boosts = append(g.boosts, make([]float32, len(g.keys)-len(g.boosts))...)
+	}
+	g.boosts[id] = clamp01(boost)
+	return true
+}
+
+// Boost returns the boost set by SetBoost, or 0.
+func (g *Graph[K]) Boost(key K) float32 {
+	id, ok := g.ids[key]
+	if !ok || int(id) >= len(g.boosts) {
+		return 0
+	}
+	return g.boosts[id]
+}
+
+// SetField sets a numeric field of a node, e.g. its popularity or price,
+// for ranking with a ScoreExpr. It reports whether the key is in the
+// graph. Replacing or deleting the node clears its fields. Fields are not
+// persisted by Export.
+func (g *Graph[K]) SetField(key K, name string, value float32) bool {
+	id, ok := g.ids[key]
+	if !ok {
+		return false
+	}
+	if g.fields == nil {
+		g.fields = make(map[string][]float32)
+	}
+	values := g.fields[name]
+	for int(id) >= len(values) {
+		values = append(values, float32(math.NaN()))
+	}
+	values[id] = value
+	g.fields[name] = values
+	return true
+}
+
+// Field returns the field set by SetField.
+func (g *Graph[K]) Field(key K, name string) (float32, bool) {
+	id, ok := g.ids[key]
+	if !ok {
+		return 0, false
+	}
+	return g.field(id, name)
+}
+
+func (g *Graph[K]) field(id uint32, name string) (float32, bool) {
+	values := g.fields[name]
+	if int(id) >= len(values) || math.IsNaN(float64(values[id])) {
+		return 0, false
+	}
+	return values[id], true
+}
+
+// ScoreExpr ranks search results by a weighted sum of signals, e.g.
+//
+//	&ScoreExpr{Semantic: 0.7, Recency: 0.2, Fields: map[string]float32{"popularity": 0.1}}
+//
+// for 0.7*semantic + 0.2*recency + 0.1*popularity. The sum becomes the
+// Score of the results. Like the other ranking options, it is evaluated
+// for the EfSearch nearest nodes.
+type ScoreExpr struct {
+	// Semantic weighs the similarity of the node to the query, the
+	// Score of a search without ranking.
+	Semantic float32
+
+	// Recency weighs the freshness of the node in [0, 1], which is 1 for
+	// a node timestamped at SearchOptions.Now and halves every
+	// SearchOptions.HalfLife. It is 0 for nodes without a timestamp, see
+	// Graph.SetTimestamp, and if HalfLife is not set.
+	Recency float32
+
+	// Boost weighs the boost of the node, see Graph.SetBoost.
+	Boost float32
+
+	// Fields weighs numeric fields of the node by name, see
+	// Graph.SetField. Fields are not normalized, so weights should
+	// account for their range. Nodes without a field count it as 0.
+	Fields map[string]float32
+}
+
+// reranks reports whether opts change the ranking of the nearest nodes.
+func (opts SearchOptions) reranks() bool {
+	return opts.HalfLife > 0 || opts.BoostWeight > 0 || opts.Expr != nil
+}
+
+// rank adjusts the scores of results by the recency decay and boosts
+// requested by opts, or evaluates opts.Expr, and returns the k best by
+// the adjusted score.
+func (h *Graph[K]) rank(results []SearchResult[K], k int, opts SearchOptions) []SearchResult[K] {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	// recency returns the recency decay of id, and false if it has no
+	// timestamp.
+	recency := func(id uint32) (float32, bool) {
+		if opts.HalfLife <= 0 || int(id) >= len(h.timestamps) || h.timestamps[id] == 0 {
+			return 0, false
+		}
+		// Nodes from the future are as fresh as possible.
+		age := max(now.Sub(time.Unix(0, h.timestamps[id])), 0)
+		return float32(math.Exp2(-float64(age) / float64(opts.HalfLife))), true
+	}
+	boost := func(id uint32) float32 {
+		if int(id) < len(h.boosts) {
+			return h.boosts[id]
+		}
+		return 0
+	}
+	for i, r := range results {
+		id := h.ids[r.Key]
+		if e := opts.Expr; e != nil {
+			decay, _ := recency(id)
+			score := e.Semantic*r.Score + e.Recency*decay + e.Boost*boost(id)
+			for name, w := range e.Fields {
+				v, _ := h.field(id, name)
+				score += w * v
+			}
+			results[i].Score = score
+			continue
+		}
+		if decay, ok := recency(id); ok {
+			results[i].Score *= decay
+		}
+		if opts.BoostWeight > 0 {
+			w := min(opts.BoostWeight, 1)
+			results[i].Score = (1-w)*results[i].Score + w*boost(id)
+		}
+	}
+	// Results are ordered by distance and key, so that the stable sort
+	// breaks ties in score by them.
+	slices.SortStableFunc(results, func(a, b SearchResult[K]) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return results[:min(k, len(results))]
+}
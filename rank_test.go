@@ -0,0 +1,109 @@
+package hnsw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_SearchHalfLife(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	require.True(t, g.SetTimestamp(10, now.Add(-time.Hour)))
+	require.True(t, g.SetTimestamp(12, now))
+	require.False(t, g.SetTimestamp(1000, now))
+	ts, ok := g.Timestamp(12)
+	require.True(t, ok)
+	require.True(t, now.Equal(ts))
+
+	// The stale exact match is outranked by a fresh node nearby, which
+	// isn't decayed, like nodes without a timestamp. Ties are ordered by
+	// key.
+	results := g.SearchWithOptions(Vector{10}, 4, SearchOptions{
+		HalfLife: time.Minute,
+		Now:      now,
+	})
+	require.Equal(t, []int{9, 11, 8, 12}, keys(results))
+	require.InDelta(t, EuclideanScore(1)(2), results[3].Score, 1e-6)
+
+	// Replacing a node clears its timestamp.
+	g.Add(MakeNode(12, Vector{12}))
+	_, ok = g.Timestamp(12)
+	require.False(t, ok)
+}
+
+func TestGraph_SearchBoost(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	require.True(t, g.SetBoost(14, 2))
+	require.Equal(t, float32(1), g.Boost(14))
+	require.False(t, g.SetBoost(1000, 1))
+
+	results := g.SearchWithOptions(Vector{10}, 2, SearchOptions{})
+	require.Equal(t, 10, results[0].Key)
+
+	// A strongly boosted node 4 away outranks the exact match.
+	results = g.SearchWithOptions(Vector{10}, 2, SearchOptions{BoostWeight: 0.5})
+	require.Equal(t, []int{14, 10}, []int{results[0].Key, results[1].Key})
+	require.InDelta(t, 0.5*EuclideanScore(1)(4)+0.5, results[0].Score, 1e-6)
+	require.InDelta(t, 0.5, results[1].Score, 1e-6)
+
+	g.Delete(14)
+	g.Add(MakeNode(14, Vector{14}))
+	require.Zero(t, g.Boost(14))
+}
+
+func TestGraph_SearchExpr(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	now := time.Unix(1_700_000_000, 0)
+	require.True(t, g.SetTimestamp(11, now))
+	require.True(t, g.SetBoost(12, 1))
+	require.True(t, g.SetField(13, "popularity", 10))
+	require.False(t, g.SetField(1000, "popularity", 1))
+	v, ok := g.Field(13, "popularity")
+	require.True(t, ok)
+	require.Equal(t, float32(10), v)
+	_, ok = g.Field(12, "popularity")
+	require.False(t, ok)
+
+	semantic := EuclideanScore(1)
+	results := g.SearchWithOptions(Vector{10}, 4, SearchOptions{
+		HalfLife: time.Hour,
+		Now:      now,
+		Expr: &ScoreExpr{
+			Semantic: 0.5,
+			Recency:  0.4,
+			Boost:    0.35,
+			Fields:   map[string]float32{"popularity": 0.04},
+		},
+	})
+	require.Len(t, results, 4)
+	require.Equal(t, []int{11, 13, 12, 10}, []int{
+		results[0].Key, results[1].Key, results[2].Key, results[3].Key,
+	})
+	require.InDelta(t, 0.5*semantic(1)+0.4, results[0].Score, 1e-6)
+	require.InDelta(t, 0.5*semantic(3)+0.4, results[1].Score, 1e-6)
+	require.InDelta(t, 0.5*semantic(2)+0.35, results[2].Score, 1e-6)
+	require.InDelta(t, 0.5*semantic(0), results[3].Score, 1e-6)
+
+	// Replacing a node clears its fields.
+	g.Add(MakeNode(13, Vector{13}))
+	_, ok = g.Field(13, "popularity")
+	require.False(t, ok)
+}
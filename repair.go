@@ -0,0 +1,111 @@
+package hnsw
+
+import (
+	"cmp"
+	"context"
+	"sync"
+	"time"
+)
+
+// pendingRepair is a node that lost neighbors to a delete while repairs
+// were deferred.
+type pendingRepair struct {
+	level int
+	node  *layerNode
+	// deleted is the neighbor list of the deleted node.
+	deleted []*layerNode
+}
+
+// Repair replenishes the neighborhoods of up to n nodes queued by deletes
+// with DeferRepair set, oldest first, and returns the number of nodes
+// repaired. If n <= 0, the whole queue is worked off.
+//
+// Nodes deleted since they were queued are skipped.
+func (h *Graph[K]) Repair(n int) int {
+	var repaired int
+	for len(h.pending) > 0 && (n <= 0 || repaired < n) {
+		p := h.pending[0]
+		h.pending = h.pending[1:]
+		if !h.live(p) {
+			continue
+		}
+		p.node.repair(h.M, h.Distance, h.liveNodes(p.level, p.deleted))
+		h.warnIsolated(p.level, []*layerNode{p.node})
+		repaired++
+	}
+	if len(h.pending) == 0 {
+		// Release the backing array.
+		h.pending = nil
+	}
+	return repaired
+}
+
+// live reports whether a queued node is still in the graph.
+func (h *Graph[K]) live(p pendingRepair) bool {
+	return p.level < len(h.layers) && h.layers[p.level].nodes[p.node.id] == p.node
+}
+
+// liveNodes returns the nodes that are still in the layer at level.
+func (h *Graph[K]) liveNodes(level int, nodes []*layerNode) []*layerNode {
+	var live []*layerNode
+	for _, node := range nodes {
+		if h.live(pendingRepair{level: level, node: node}) {
+			live = append(live, node)
+		}
+	}
+	return live
+}
+
+// repairOnce repairs each live node in batch once, considering the
+// neighbors of all of its deleted neighbors.
+func (h *Graph[K]) repairOnce(batch []pendingRepair) {
+	var (
+		order   []pendingRepair
+		deleted = make(map[*layerNode][]*layerNode, len(batch))
+	)
+	for _, p := range batch {
+		if _, ok := deleted[p.node]; !ok {
+			order = append(order, p)
+		}
+		deleted[p.node] = append(deleted[p.node], p.deleted...)
+	}
+	for _, p := range order {
+		if !h.live(p) {
+			continue
+		}
+		p.node.repair(h.M, h.Distance, h.liveNodes(p.level, deleted[p.node]))
+		h.warnIsolated(p.level, []*layerNode{p.node})
+	}
+}
+
+// PendingRepairs returns the number of nodes queued for Repair.
+func (h *Graph[K]) PendingRepairs() int {
+	return len(h.pending)
+}
+
+// RepairInBackground calls g.Repair(batch) every interval until ctx is
+// done, working off the repairs deferred by Graph.DeferRepair at a bounded
+// rate.
+//
+// Graph is not safe for concurrent use, so each batch holds mu, which
+// every other user of the graph must hold as well.
+func RepairInBackground[K cmp.Ordered](
+	ctx context.Context,
+	g *Graph[K],
+	mu sync.Locker,
+	interval time.Duration,
+	batch int,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mu.Lock()
+			g.Repair(batch)
+			mu.Unlock()
+		}
+	}
+}
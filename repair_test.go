@@ -0,0 +1,84 @@
+package hnsw
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_DeferRepair(t *testing.T) {
+	t.Parallel()
+
+	build := func() *Graph[int] {
+		g := newTestGraph[int]()
+		g.DebugChecks = true
+		for i := 0; i < 256; i++ {
+			g.Add(MakeNode(i, Vector{float32(i)}))
+		}
+		return g
+	}
+
+	immediate, deferred := build(), build()
+	deferred.DeferRepair = true
+	for i := 0; i < 256; i += 2 {
+		require.True(t, immediate.Delete(i))
+		require.True(t, deferred.Delete(i))
+	}
+
+	// Deletes only removed edges.
+	pending := deferred.PendingRepairs()
+	require.Positive(t, pending)
+	immediateConn := (&Analyzer[int]{Graph: immediate}).Connectivity()[0]
+	require.Less(t, (&Analyzer[int]{Graph: deferred}).Connectivity()[0], immediateConn)
+
+	require.Equal(t, 1, deferred.Repair(1))
+	require.Less(t, deferred.PendingRepairs(), pending)
+
+	deferred.Repair(0)
+	require.Zero(t, deferred.PendingRepairs())
+	require.NoError(t, deferred.checkInvariants())
+	require.InDelta(t, immediateConn, (&Analyzer[int]{Graph: deferred}).Connectivity()[0], 0.5)
+
+	for i := 1; i < 256; i += 32 {
+		results := deferred.Search(Vector{float32(i)}, 1)
+		require.Equal(t, i, results[0].Key)
+	}
+}
+
+func TestRepairInBackground(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	g.DeferRepair = true
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+
+	var mu sync.Mutex
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		RepairInBackground(ctx, g, &mu, time.Millisecond, 4)
+		close(done)
+	}()
+
+	mu.Lock()
+	for i := 0; i < 128; i += 2 {
+		g.Delete(i)
+	}
+	mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return g.PendingRepairs() == 0
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	require.NoError(t, g.checkInvariants())
+}
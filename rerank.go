@@ -0,0 +1,265 @@
+package hnsw
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// BatchDistancer computes the distances between a query and many vectors
+// at once. It is the extension point for offloading re-ranking to an
+// accelerator, e.g. a GPU through cgo or a remote service.
+type BatchDistancer interface {
+	// Distances stores the distance between query and vecs[i] in
+	// out[i]. len(out) == len(vecs).
+	Distances(ctx context.Context, query Vector, vecs []Vector, out []float32) error
+}
+
+// CPUDistancer is the BatchDistancer that computes distances with a
+// DistanceFunc on the CPU.
+type CPUDistancer struct {
+	Distance DistanceFunc
+}
+
+func (d CPUDistancer) Distances(ctx context.Context, query Vector, vecs []Vector, out []float32) error {
+	for i, vec := range vecs {
+		// Check for cancellation now and then, batches may be large.
+		if i%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		out[i] = d.Distance(query, vec)
+	}
+	return nil
+}
+
+// RerankOptions configures Graph.SearchRerank.
+type RerankOptions[K cmp.Ordered] struct {
+	// Candidates is the number of nodes retrieved from the graph to be
+	// re-ranked. Defaults to 10 times k.
+	Candidates int
+
+	// Query is the query vector the candidates are re-ranked against,
+	// e.g. a full-precision embedding when the graph stores reduced
+	// ones. Defaults to the query of the search.
+	Query Vector
+
+	// Vectors returns the vector of a candidate to re-rank against. If
+	// nil, the candidate's vector in the graph is used. Candidates for
+	// which it returns false are dropped.
+	Vectors func(key K) (Vector, bool)
+
+	// Distancer computes the distances of the candidates. Defaults to a
+	// CPUDistancer with the graph's distance function.
+	Distancer BatchDistancer
+}
+
+// SearchRerank finds the opts.Candidates nearest neighbors of near in the
+// graph, re-ranks them by their distance to opts.Query computed in a
+// single batch by opts.Distancer, and returns the k best. The Distance and
+// Score of the results are those of the re-ranking, and results at equal
+// distance are ordered by key.
+//
+// It returns ErrInvalidK if k is not positive, and ErrGraphEmpty if the
+// graph has no nodes.
+func (h *Graph[K]) SearchRerank(ctx context.Context, near Vector, k int, opts RerankOptions[K]) ([]SearchResult[K], error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("rerank: %w", ErrInvalidK)
+	}
+	if h.Len() == 0 {
+		return nil, fmt.Errorf("rerank: %w", ErrGraphEmpty)
+	}
+	if opts.Candidates <= 0 {
+		opts.Candidates = 10 * k
+	}
+	if opts.Query == nil {
+		opts.Query = near
+	}
+	if opts.Distancer == nil {
+		opts.Distancer = CPUDistancer{Distance: h.Distance}
+	}
+
+	candidates := h.SearchWithOptions(near, max(k, opts.Candidates), SearchOptions{})
+	vecs := make([]Vector, 0, len(candidates))
+	kept := candidates[:0]
+	for _, c := range candidates {
+		vec := c.Value
+		if opts.Vectors != nil {
+			var ok bool
+			vec, ok = opts.Vectors(c.Key)
+			if !ok {
+				continue
+			}
+		}
+		kept = append(kept, c)
+		vecs = append(vecs, vec)
+	}
+	candidates = kept
+
+	dists := make([]float32, len(vecs))
+	err := opts.Distancer.Distances(ctx, opts.Query, vecs, dists)
+	if err != nil {
+		return nil, fmt.Errorf("rerank: %w", err)
+	}
+
+	score := h.Score
+	if score == nil {
+		score = ScoreFuncFor(h.Distance)
+	}
+	for i := range candidates {
+		candidates[i].Distance = dists[i]
+		candidates[i].Score = score(dists[i])
+	}
+	slices.SortFunc(candidates, func(a, b SearchResult[K]) int {
+		if c := cmp.Compare(a.Distance, b.Distance); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return candidates[:min(k, len(candidates))], nil
+}
+
+// Judgment is the decision of a JudgeFunc on a candidate.
+type Judgment struct {
+	// Keep reports whether the candidate is returned.
+	Keep bool
+
+	// Score replaces the Score of a kept candidate, which are ranked by
+	// it, highest first.
+	Score float32
+}
+
+// JudgeFunc decides on a batch of candidates, e.g. by scoring them with a
+// cross-encoder or an LLM against the text of the query, and returns a
+// Judgment for each of them, in order.
+type JudgeFunc[K cmp.Ordered] func(ctx context.Context, batch []SearchResult[K]) ([]Judgment, error)
+
+// JudgeOptions configures Graph.SearchJudged.
+type JudgeOptions[K cmp.Ordered] struct {
+	// Judge decides on the candidates.
+	Judge JudgeFunc[K]
+
+	// Candidates is the number of nodes retrieved from the graph to be
+	// judged. Defaults to 2 times k, as judges are expensive.
+	Candidates int
+
+	// BatchSize is the maximum number of candidates passed to Judge at
+	// once. Defaults to 16.
+	BatchSize int
+
+	// Concurrency is the maximum number of batches judged at once. Judge
+	// must be safe for concurrent use if it is greater than 1. Defaults
+	// to 1.
+	Concurrency int
+}
+
+// SearchJudged finds the opts.Candidates nearest neighbors of near in the
+// graph, passes them to opts.Judge in batches, and returns the k best of
+// those it keeps, by their judged Score. The graph is only searched
+// before judging, so the judge may take its time without holding up
+// writers of the graph synchronized with the caller.
+//
+// If a batch fails, the other batches are canceled through their
+// context, and the error is returned. It returns ErrInvalidK if k is not
+// positive, and ErrGraphEmpty if the graph has no nodes.
+func (h *Graph[K]) SearchJudged(ctx context.Context, near Vector, k int, opts JudgeOptions[K]) ([]SearchResult[K], error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("judge: %w", ErrInvalidK)
+	}
+	if h.Len() == 0 {
+		return nil, fmt.Errorf("judge: %w", ErrGraphEmpty)
+	}
+	if opts.Judge == nil {
+		panic("hnsw: JudgeOptions.Judge must be set")
+	}
+	if opts.Candidates <= 0 {
+		opts.Candidates = 2 * k
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 16
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	candidates := h.SearchWithOptions(near, max(k, opts.Candidates), SearchOptions{})
+	judgments, err := judge(ctx, candidates, opts)
+	if err != nil {
+		return nil, fmt.Errorf("judge: %w", err)
+	}
+
+	kept := candidates[:0]
+	for i, c := range candidates {
+		if judgments[i].Keep {
+			c.Score = judgments[i].Score
+			kept = append(kept, c)
+		}
+	}
+	// Ties keep the order of distance.
+	slices.SortStableFunc(kept, func(a, b SearchResult[K]) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return kept[:min(k, len(kept))], nil
+}
+
+// judge returns the judgments of candidates, judged in batches.
+func judge[K cmp.Ordered](ctx context.Context, candidates []SearchResult[K], opts JudgeOptions[K]) ([]Judgment, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		judgments = make([]Judgment, len(candidates))
+		sem       = make(chan struct{}, opts.Concurrency)
+		wg        sync.WaitGroup
+
+		mu       sync.Mutex
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	for start := 0; start < len(candidates); start += opts.BatchSize {
+		end := min(start+opts.BatchSize, len(candidates))
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// The judge gets a copy, so that it can't reorder the
+			// candidates.
+			batch := slices.Clone(candidates[start:end])
+			out, err := opts.Judge(ctx, batch)
+			if err == nil && len(out) != len(batch) {
+				err = fmt.Errorf("%d judgments for %d candidates", len(out), len(batch))
+			}
+			if err != nil {
+				fail(fmt.Errorf("batch at %d: %w", start, err))
+				return
+			}
+			copy(judgments[start:end], out)
+		}(start, end)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	// The caller's context may have been canceled before any batch ran.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return judgments, nil
+}
@@ -0,0 +1,136 @@
+package hnsw
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingDistancer struct{}
+
+func (failingDistancer) Distances(context.Context, Vector, []Vector, []float32) error {
+	return errors.New("device lost")
+}
+
+func TestGraph_SearchRerank(t *testing.T) {
+	t.Parallel()
+
+	// The graph holds the first dimension of the full vectors only.
+	g := newTestGraph[int]()
+	full := make(map[int]Vector)
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+		full[i] = Vector{float32(i), float32(i % 2 * 10)}
+	}
+
+	ctx := context.Background()
+	results, err := g.SearchRerank(ctx, Vector{64}, 2, RerankOptions[int]{})
+	require.NoError(t, err)
+	require.Equal(t, 64, results[0].Key)
+
+	// Re-ranking against the full vectors prefers even keys.
+	results, err = g.SearchRerank(ctx, Vector{64.4}, 3, RerankOptions[int]{
+		Candidates: 8,
+		Query:      Vector{64, 0},
+		Vectors: func(key int) (Vector, bool) {
+			vec, ok := full[key]
+			return vec, ok && key != 62
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{64, 66, 68}, []int{results[0].Key, results[1].Key, results[2].Key})
+	require.Equal(t, float32(2), results[1].Distance)
+
+	_, err = g.SearchRerank(ctx, Vector{64}, 2, RerankOptions[int]{Distancer: failingDistancer{}})
+	require.ErrorContains(t, err, "device lost")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = g.SearchRerank(canceled, Vector{64}, 2, RerankOptions[int]{})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGraph_SearchJudged(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 128; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	ctx := context.Background()
+
+	var (
+		mu      sync.Mutex
+		batches []int
+		active  int
+		peak    int
+	)
+	// Keeps odd keys, preferring larger ones.
+	judge := func(ctx context.Context, batch []SearchResult[int]) ([]Judgment, error) {
+		mu.Lock()
+		batches = append(batches, len(batch))
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		out := make([]Judgment, len(batch))
+		for i, c := range batch {
+			out[i] = Judgment{Keep: c.Key%2 == 1, Score: float32(c.Key)}
+		}
+		return out, nil
+	}
+	results, err := g.SearchJudged(ctx, Vector{64.4}, 3, JudgeOptions[int]{
+		Judge:       judge,
+		Candidates:  10,
+		BatchSize:   4,
+		Concurrency: 2,
+	})
+	require.NoError(t, err)
+	keys := make([]int, len(results))
+	for i, r := range results {
+		keys[i] = r.Key
+	}
+	require.Equal(t, []int{69, 67, 65}, keys)
+	require.Equal(t, float32(69), results[0].Score)
+	require.InDelta(t, 4.6, results[0].Distance, 1e-4)
+	require.ElementsMatch(t, []int{4, 4, 2}, batches)
+	require.LessOrEqual(t, peak, 2)
+
+	// A failing batch fails the search.
+	_, err = g.SearchJudged(ctx, Vector{64}, 3, JudgeOptions[int]{
+		Judge: func(ctx context.Context, batch []SearchResult[int]) ([]Judgment, error) {
+			if batch[0].Key != 64 {
+				return nil, errors.New("rate limited")
+			}
+			return make([]Judgment, len(batch)), nil
+		},
+		BatchSize:   1,
+		Concurrency: 3,
+	})
+	require.ErrorContains(t, err, "rate limited")
+
+	_, err = g.SearchJudged(ctx, Vector{64}, 3, JudgeOptions[int]{
+		Judge: func(context.Context, []SearchResult[int]) ([]Judgment, error) {
+			return nil, nil
+		},
+	})
+	require.ErrorContains(t, err, "0 judgments for 6 candidates")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = g.SearchJudged(canceled, Vector{64}, 3, JudgeOptions[int]{Judge: judge})
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = g.SearchJudged(ctx, Vector{64}, 0, JudgeOptions[int]{Judge: judge})
+	require.ErrorIs(t, err, ErrInvalidK)
+}
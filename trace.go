@@ -0,0 +1,112 @@
+package hnsw
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Tracer receives a span for each Add, Search, Import and Export on a
+// graph, e.g. to forward them to OpenTelemetry so that traces show the
+// time spent in the index separately from embedding queries.
+type Tracer interface {
+	// Start is called when op begins. The returned function is called
+	// when it ends, with its error, if any, and attributes describing
+	// it, such as the number of nodes visited by a search.
+	Start(ctx context.Context, op string) (end func(err error, attrs ...slog.Attr))
+}
+
+// startSpan starts a span if the graph has a Tracer. The returned function
+// must be called when op ends.
+func (h *Graph[K]) startSpan(ctx context.Context, op string) func(err error, attrs ...slog.Attr) {
+	if h.Tracer == nil {
+		return func(error, ...slog.Attr) {}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return h.Tracer.Start(ctx, op)
+}
+
+// SearchStats reports the work done by a search, see SearchOptions.Stats.
+type SearchStats struct {
+	// Visited is the number of nodes whose distance to the query was
+	// computed, the main cost of a search. Each node is counted once,
+	// except with Graph.LowMemorySearch, which may revisit nodes.
+	Visited int
+
+	// Layers is the work done in each layer, from the top layer down.
+	Layers []LayerStats
+}
+
+// LayerStats is the work done by a search in a layer.
+type LayerStats struct {
+	Level int
+
+	// Visited is the number of nodes whose distance to the query was
+	// computed, and Expanded the number of those whose neighbors were
+	// followed.
+	Visited, Expanded int
+
+	// Frontier is the largest number of candidates queued for expansion
+	// at once.
+	Frontier int
+}
+
+// searchStats counts the work done by layerNode.search.
+type searchStats struct {
+	// visited is the number of nodes whose distance was computed, and
+	// nans the number of those distances that were NaN.
+	visited int
+	nans    int
+
+	// expanded is the number of candidates expanded, and frontier the
+	// largest number of candidates queued, in the current layer.
+	expanded int
+	frontier int
+	// layers holds the work done in previous layers, and layerVisited
+	// the value of visited when the current layer began.
+	layers       []LayerStats
+	layerVisited int
+}
+
+// add records a computed distance.
+func (s *searchStats) add(dist float32) {
+	if s == nil {
+		return
+	}
+	s.visited++
+	if dist != dist {
+		s.nans++
+	}
+}
+
+// expand records the expansion of a candidate, with queued candidates
+// left afterwards.
+func (s *searchStats) expand(queued int) {
+	if s == nil {
+		return
+	}
+	s.expanded++
+	s.frontier = max(s.frontier, queued)
+}
+
+// endLayer records the work done in the layer at level since the last
+// call.
+func (s *searchStats) endLayer(level int) {
+	if s == nil {
+		return
+	}
+	s.layers = append(s.layers, LayerStats{
+		Level:    level,
+		Visited:  s.visited - s.layerVisited,
+		Expanded: s.expanded,
+		Frontier: s.frontier,
+	})
+	s.layerVisited = s.visited
+	s.expanded, s.frontier = 0, 0
+}
+
+// public returns the stats reported by SearchOptions.Stats.
+func (s *searchStats) public() SearchStats {
+	return SearchStats{Visited: s.visited, Layers: s.layers}
+}
@@ -0,0 +1,110 @@
+package hnsw
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type span struct {
+	ctx   context.Context
+	op    string
+	err   error
+	attrs map[string]any
+}
+
+type recordingTracer struct {
+	spans []*span
+}
+
+func (t *recordingTracer) Start(ctx context.Context, op string) func(error, ...slog.Attr) {
+	s := &span{ctx: ctx, op: op, attrs: make(map[string]any)}
+	t.spans = append(t.spans, s)
+	return func(err error, attrs ...slog.Attr) {
+		s.err = err
+		for _, attr := range attrs {
+			s.attrs[attr.Key] = attr.Value.Any()
+		}
+	}
+}
+
+func TestGraph_Tracer(t *testing.T) {
+	t.Parallel()
+
+	tracer := &recordingTracer{}
+	g := newTestGraph[int]()
+	g.Tracer = tracer
+
+	for i := 0; i < 64; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+	require.Len(t, tracer.spans, 64)
+	require.Equal(t, "Add", tracer.spans[63].op)
+	require.Equal(t, int64(64), tracer.spans[63].attrs["len"])
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "trace")
+	g.SearchWithOptions(Vector{10}, 3, SearchOptions{Context: ctx})
+	s := tracer.spans[64]
+	require.Equal(t, "Search", s.op)
+	require.Equal(t, "trace", s.ctx.Value(ctxKey{}))
+	require.Equal(t, int64(3), s.attrs["k"])
+	require.Equal(t, int64(3), s.attrs["results"])
+	require.Greater(t, s.attrs["visited"], int64(3))
+	require.Equal(t, false, s.attrs["truncated"])
+	require.Equal(t, int64(g.EfSearch), s.attrs["ef"])
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Export(&buf))
+	require.Equal(t, "Export", tracer.spans[65].op)
+
+	g2 := &Graph[int]{Tracer: tracer}
+	require.NoError(t, g2.Import(&buf))
+	require.Equal(t, "Import", tracer.spans[66].op)
+	require.Equal(t, int64(64), tracer.spans[66].attrs["nodes"])
+
+	require.Error(t, g2.Import(&buf))
+	require.Error(t, tracer.spans[67].err)
+
+	// Spans record the ef the base layer was searched with.
+	g.SearchWithOptions(Vector{10}, 3, SearchOptions{Strict: true})
+	require.Equal(t, int64(strictEfFactor*g.EfSearch), tracer.spans[68].attrs["ef"])
+}
+
+func TestGraph_SearchStats(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGraph[int]()
+	for i := 0; i < 256; i++ {
+		g.Add(MakeNode(i, Vector{float32(i)}))
+	}
+
+	var stats SearchStats
+	g.SearchWithOptions(Vector{10}, 3, SearchOptions{Stats: &stats})
+	require.Len(t, stats.Layers, len(g.layers))
+	var visited int
+	for i, layer := range stats.Layers {
+		require.Equal(t, len(g.layers)-1-i, layer.Level)
+		require.LessOrEqual(t, layer.Visited, g.layers[layer.Level].size())
+		visited += layer.Visited
+	}
+	require.Equal(t, visited, stats.Visited)
+	base := stats.Layers[len(stats.Layers)-1]
+	require.Greater(t, base.Visited, g.EfSearch)
+	require.Positive(t, base.Expanded)
+	require.Positive(t, base.Frontier)
+
+	// Scans report the nodes compared.
+	g.SearchFiltered(Vector{10}, 3, Filter[int]{Keys: []int{1, 2, 3, 4}}, SearchOptions{Stats: &stats})
+	require.Equal(t, SearchStats{Visited: 4, Layers: []LayerStats{{Visited: 4}}}, stats)
+
+	// Cache hits don't search the graph.
+	cache := &QueryCache[int]{Graph: g}
+	cache.SearchWithOptions(Vector{10}, 3, SearchOptions{Stats: &stats})
+	require.Positive(t, stats.Visited)
+	cache.SearchWithOptions(Vector{10}, 3, SearchOptions{Stats: &stats})
+	require.Zero(t, stats.Visited)
+}
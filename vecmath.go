@@ -0,0 +1,86 @@
+package hnsw
+
+import "math"
+
+// Vector arithmetic for composing queries, e.g. moving a query away from
+// negative examples, and computing centroids. The functions don't modify
+// their arguments, use the SIMD kernels reported by DistanceKernel where
+// available, and panic with a *DimensionError if the vectors have
+// different dimensions.
+
+// Mean returns the element-wise mean of vecs, or nil if there are none.
+func Mean(vecs ...Vector) Vector {
+	if len(vecs) == 0 {
+		return nil
+	}
+	mean := make(Vector, len(vecs[0]))
+	for _, v := range vecs {
+		assertSameDims(mean, v)
+		activeKernel.add(mean, v)
+	}
+	activeKernel.scale(mean, 1/float32(len(vecs)))
+	return mean
+}
+
+// WeightedSum returns the sum of vecs[i] multiplied by weights[i], e.g.
+// a Rocchio query with positive weights for relevant examples and
+// negative ones for irrelevant examples. It returns nil if there are no
+// vectors, and panics if there isn't a weight for each vector.
+func WeightedSum(vecs []Vector, weights []float32) Vector {
+	if len(vecs) != len(weights) {
+		panic("hnsw: WeightedSum needs a weight for each vector")
+	}
+	if len(vecs) == 0 {
+		return nil
+	}
+	var (
+		sum     = make(Vector, len(vecs[0]))
+		scratch Vector
+	)
+	for i, v := range vecs {
+		assertSameDims(sum, v)
+		switch w := weights[i]; w {
+		case 0:
+			// Contributes nothing.
+		case 1:
+			activeKernel.add(sum, v)
+		case -1:
+			activeKernel.sub(sum, v)
+		default:
+			if scratch == nil {
+				scratch = make(Vector, len(sum))
+			}
+			copy(scratch, v)
+			activeKernel.scale(scratch, w)
+			activeKernel.add(sum, scratch)
+		}
+	}
+	return sum
+}
+
+// Normalize returns v scaled to unit length, or a copy of v if its length
+// is 0.
+func Normalize(v Vector) Vector {
+	out := make(Vector, len(v))
+	copy(out, v)
+	norm := math.Sqrt(float64(activeKernel.dot(v, v)))
+	if norm > 0 {
+		activeKernel.scale(out, float32(1/norm))
+	}
+	return out
+}
+
+// Subtract returns a - b.
+func Subtract(a, b Vector) Vector {
+	assertSameDims(a, b)
+	out := make(Vector, len(a))
+	copy(out, a)
+	activeKernel.sub(out, b)
+	return out
+}
+
+func assertSameDims(a, b Vector) {
+	if len(a) != len(b) {
+		panic(&DimensionError{Want: len(a), Got: len(b)})
+	}
+}
@@ -0,0 +1,40 @@
+package hnsw
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVecmath(t *testing.T) {
+	t.Parallel()
+
+	a, b, c := Vector{1, 2, 3}, Vector{3, 2, 1}, Vector{2, 2, 8}
+
+	require.Nil(t, Mean())
+	require.Equal(t, Vector{2, 2, 4}, Mean(a, b, c))
+	require.Equal(t, Vector{1, 2, 3}, a, "arguments are not modified")
+
+	require.Nil(t, WeightedSum(nil, nil))
+	require.InDeltaSlice(t, Vector{1.2, 2.2, 3.8}, WeightedSum(
+		[]Vector{a, b, c},
+		[]float32{1, 0, 0.1},
+	), 1e-6)
+	require.Equal(t, Vector{-2, 0, 2}, WeightedSum([]Vector{a, b}, []float32{1, -1}))
+	require.Panics(t, func() { WeightedSum([]Vector{a}, nil) })
+
+	require.Equal(t, Vector{-2, 0, 2}, Subtract(a, b))
+
+	n := Normalize(Vector{3, 0, 4})
+	require.InDeltaSlice(t, Vector{0.6, 0, 0.8}, n, 1e-6)
+	require.Equal(t, Vector{0, 0}, Normalize(Vector{0, 0}))
+	require.InDelta(t, 1, math.Sqrt(float64(activeKernel.dot(n, n))), 1e-6)
+
+	defer func() {
+		err, _ := recover().(error)
+		require.ErrorIs(t, err, ErrDimensionMismatch)
+	}()
+	Mean(a, Vector{1, 2})
+	t.Fatal("Mean didn't panic")
+}
@@ -0,0 +1,253 @@
+// Package vectorstore adapts a [hnsw.Graph] to the vector store shape used by
+// RAG frameworks such as langchaingo.
+//
+// The package does not import langchaingo. Instead, Embedder has the same
+// method set as langchaingo's embeddings.Embedder, so OpenAI, Ollama, and
+// other embedders built for it work as-is, and Store mirrors the
+// AddDocuments/SimilaritySearch methods of its vectorstores.VectorStore so a
+// thin wrapper converting Document to schema.Document is all that's needed.
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/coder/hnsw"
+)
+
+// Embedder turns text into embeddings.
+type Embedder interface {
+	// EmbedDocuments returns one embedding per text.
+	EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error)
+	// EmbedQuery returns the embedding of a search query.
+	EmbedQuery(ctx context.Context, text string) ([]float32, error)
+}
+
+// Document is a piece of text stored alongside its embedding.
+type Document struct {
+	PageContent string
+	Metadata    map[string]any
+
+	// Score is the similarity of the document to the query in [0, 1],
+	// set on search results. Higher is better. See hnsw.Graph.Score.
+	Score float32
+}
+
+// Option configures a single call to SimilaritySearch.
+type Option func(*options)
+
+type options struct {
+	scoreThreshold float32
+	filter         func(Document) bool
+}
+
+// WithScoreThreshold drops results with a Score below threshold. The
+// search only considers documents scoring at least threshold, so it still
+// returns up to numDocuments results if there are enough of them.
+func WithScoreThreshold(threshold float32) Option {
+	return func(o *options) {
+		o.scoreThreshold = threshold
+	}
+}
+
+// WithFilter restricts results to the documents for which keep returns
+// true, see hnsw.Graph.SearchFiltered. keep is called with the stored
+// document, whose Score is not set yet.
+func WithFilter(keep func(Document) bool) Option {
+	return func(o *options) {
+		o.filter = keep
+	}
+}
+
+// Store is a vector store backed by a graph.
+// It is not safe for concurrent use.
+type Store struct {
+	// Graph holds one node per document, keyed by the ID returned from
+	// AddDocuments.
+	Graph *hnsw.Graph[string]
+
+	// Embedder is used to embed documents and queries.
+	Embedder Embedder
+
+	docs   map[string]Document
+	nextID uint64
+}
+
+// New returns an empty store using the given embedder and a graph with
+// default parameters.
+func New(embedder Embedder) *Store {
+	return &Store{
+		Graph:    hnsw.NewGraph[string](),
+		Embedder: embedder,
+		docs:     make(map[string]Document),
+	}
+}
+
+// AddDocuments embeds and stores the documents, returning their IDs.
+func (s *Store) AddDocuments(ctx context.Context, docs []Document) ([]string, error) {
+	if s.Embedder == nil {
+		return nil, errors.New("vectorstore: Embedder must be set")
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.PageContent
+	}
+	vecs, err := s.Embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("embed documents: %w", err)
+	}
+
+	return s.AddEmbedded(docs, vecs)
+}
+
+// AddEmbedded stores documents whose embeddings were computed elsewhere,
+// returning their IDs. If an embedding doesn't have the dimensions of the
+// graph, or of the first embedding for an empty graph, it returns an
+// error wrapping a *hnsw.DimensionError and stores none of the documents.
+func (s *Store) AddEmbedded(docs []Document, vecs [][]float32) ([]string, error) {
+	if len(vecs) != len(docs) {
+		return nil, fmt.Errorf("got %d embeddings for %d documents", len(vecs), len(docs))
+	}
+	dims := s.Graph.Dims()
+	for i, vec := range vecs {
+		if dims == 0 {
+			dims = len(vec)
+		}
+		if len(vec) != dims {
+			return nil, fmt.Errorf("document %d: embedding has %w", i, &hnsw.DimensionError{Want: dims, Got: len(vec)})
+		}
+	}
+
+	ids := make([]string, len(docs))
+	nodes := make([]hnsw.Node[string], len(docs))
+	for i, doc := range docs {
+		ids[i] = strconv.FormatUint(s.nextID, 10)
+		s.nextID++
+
+		doc.Score = 0
+		s.docs[ids[i]] = doc
+		nodes[i] = hnsw.MakeNode(ids[i], vecs[i])
+	}
+	s.Graph.Add(nodes...)
+	return ids, nil
+}
+
+// SimilaritySearch returns up to numDocuments documents most similar
+// to the query, best first.
+func (s *Store) SimilaritySearch(ctx context.Context, query string, numDocuments int, opts ...Option) ([]Document, error) {
+	if s.Embedder == nil {
+		return nil, errors.New("vectorstore: Embedder must be set")
+	}
+
+	vec, err := s.Embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	return s.SimilaritySearchVector(vec, numDocuments, opts...), nil
+}
+
+// SimilaritySearchVector is like SimilaritySearch, but with an already
+// embedded query.
+func (s *Store) SimilaritySearchVector(query []float32, numDocuments int, opts ...Option) []Document {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if numDocuments <= 0 || s.Graph.Len() == 0 {
+		return nil
+	}
+
+	var searchOpts hnsw.SearchOptions
+	if o.scoreThreshold > 0 {
+		maxDist, ok := s.maxDistance(o.scoreThreshold)
+		if !ok {
+			return nil
+		}
+		searchOpts.MaxDistance = maxDist
+	}
+
+	var results []hnsw.SearchResult[string]
+	if o.filter != nil {
+		filter := hnsw.Filter[string]{
+			Allow: func(id string) bool {
+				return o.filter(s.docs[id])
+			},
+		}
+		results = s.Graph.SearchFiltered(query, numDocuments, filter, searchOpts)
+	} else {
+		results = s.Graph.SearchWithOptions(query, numDocuments, searchOpts)
+	}
+
+	out := make([]Document, 0, len(results))
+	for _, result := range results {
+		doc := s.docs[result.Key]
+		doc.Score = result.Score
+		if doc.Score < o.scoreThreshold {
+			// Only possible if the score function isn't monotonic.
+			continue
+		}
+		out = append(out, doc)
+	}
+	return out
+}
+
+// maxDistance returns the largest distance that scores at least
+// threshold, for excluding lower scores during the search with
+// SearchOptions.MaxDistance, where 0 means no limit. It assumes that
+// scores don't increase with the distance, and reports false if not
+// even a distance of 0 scores threshold.
+func (s *Store) maxDistance(threshold float32) (float32, bool) {
+	score := s.Graph.Score
+	if score == nil {
+		score = hnsw.ScoreFuncFor(s.Graph.Distance)
+	}
+	if score(0) < threshold {
+		return 0, false
+	}
+
+	// Find a distance that scores below threshold, then bisect.
+	lo, hi := float32(0), float32(1)
+	for score(hi) >= threshold {
+		lo, hi = hi, 2*hi
+		if math.IsInf(float64(hi), 1) {
+			return 0, true
+		}
+	}
+	for i := 0; i < 64 && lo < hi; i++ {
+		mid := lo + (hi-lo)/2
+		if mid == lo || mid == hi {
+			break
+		}
+		if score(mid) >= threshold {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	// 0 disables MaxDistance, so let exact matches through instead.
+	return max(lo, math.SmallestNonzeroFloat32), true
+}
+
+// Get returns the document with the given ID.
+func (s *Store) Get(id string) (Document, bool) {
+	doc, ok := s.docs[id]
+	return doc, ok
+}
+
+// Delete removes documents by ID.
+func (s *Store) Delete(ids ...string) {
+	for _, id := range ids {
+		s.Graph.Delete(id)
+		delete(s.docs, id)
+	}
+}
+
+// Len returns the number of documents in the store.
+func (s *Store) Len() int {
+	return len(s.docs)
+}
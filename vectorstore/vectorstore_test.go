@@ -0,0 +1,142 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/coder/hnsw"
+	"github.com/stretchr/testify/require"
+)
+
+// letterEmbedder embeds text as the counts of the letters a, b and c.
+type letterEmbedder struct{}
+
+func (letterEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		vecs[i], _ = letterEmbedder{}.EmbedQuery(ctx, text)
+	}
+	return vecs, nil
+}
+
+func (letterEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	return []float32{
+		float32(strings.Count(text, "a")),
+		float32(strings.Count(text, "b")),
+		float32(strings.Count(text, "c")),
+	}, nil
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New(letterEmbedder{})
+
+	ids, err := s.AddDocuments(ctx, []Document{
+		{PageContent: "aaa", Metadata: map[string]any{"n": 1}},
+		{PageContent: "bbb", Metadata: map[string]any{"n": 2}},
+		{PageContent: "ccc", Metadata: map[string]any{"n": 3}},
+		{PageContent: "aab", Metadata: map[string]any{"n": 4}},
+	})
+	require.NoError(t, err)
+	require.Len(t, ids, 4)
+	require.Equal(t, 4, s.Len())
+
+	docs, err := s.SimilaritySearch(ctx, "a", 2)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "aaa", docs[0].PageContent)
+	require.Equal(t, 1, docs[0].Metadata["n"])
+	require.InDelta(t, 1, docs[0].Score, 1e-6)
+	require.Equal(t, "aab", docs[1].PageContent)
+
+	docs, err = s.SimilaritySearch(ctx, "a", 4, WithScoreThreshold(0.75))
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+
+	docs, err = s.SimilaritySearch(ctx, "a", 4, WithFilter(func(d Document) bool {
+		return d.Metadata["n"] != 1
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "aab", docs[0].PageContent)
+
+	s.Delete(ids[0])
+	_, ok := s.Get(ids[0])
+	require.False(t, ok)
+	docs, err = s.SimilaritySearch(ctx, "a", 1)
+	require.NoError(t, err)
+	require.Equal(t, "aab", docs[0].PageContent)
+}
+
+type failingEmbedder struct{ letterEmbedder }
+
+func (failingEmbedder) EmbedDocuments(context.Context, []string) ([][]float32, error) {
+	return nil, errors.New("boom")
+}
+
+func TestStore_EmbedError(t *testing.T) {
+	t.Parallel()
+
+	s := New(failingEmbedder{})
+	_, err := s.AddDocuments(context.Background(), []Document{{PageContent: "a"}})
+	require.ErrorContains(t, err, "boom")
+	require.Equal(t, 0, s.Len())
+}
+
+func TestStore_DimensionError(t *testing.T) {
+	t.Parallel()
+
+	s := New(letterEmbedder{})
+	_, err := s.AddEmbedded([]Document{{PageContent: "a"}}, [][]float32{{1, 0, 0}})
+	require.NoError(t, err)
+
+	_, err = s.AddEmbedded(
+		[]Document{{PageContent: "b"}, {PageContent: "c"}},
+		[][]float32{{0, 1, 0}, {0, 0}},
+	)
+	var dimErr *hnsw.DimensionError
+	require.ErrorAs(t, err, &dimErr)
+	require.Equal(t, hnsw.DimensionError{Want: 3, Got: 2}, *dimErr)
+	require.ErrorIs(t, err, hnsw.ErrDimensionMismatch)
+
+	// Neither document was stored.
+	require.Equal(t, 1, s.Len())
+	require.Equal(t, 1, s.Graph.Len())
+}
+
+func TestStore_SearchRestricted(t *testing.T) {
+	t.Parallel()
+
+	s := New(letterEmbedder{})
+	s.Graph.Distance = hnsw.EuclideanDistance
+	var docs []Document
+	for i := 0; i < 64; i++ {
+		docs = append(docs, Document{
+			PageContent: strings.Repeat("a", i),
+			Metadata:    map[string]any{"n": i},
+		})
+	}
+	_, err := s.AddDocuments(context.Background(), docs)
+	require.NoError(t, err)
+
+	// The nearest documents are filtered out, but the search still
+	// returns as many as requested.
+	got := s.SimilaritySearchVector([]float32{0, 0, 0}, 3, WithFilter(func(d Document) bool {
+		return d.Metadata["n"].(int) >= 10
+	}))
+	require.Len(t, got, 3)
+	for i, doc := range got {
+		require.Equal(t, 10+i, doc.Metadata["n"])
+	}
+
+	// EuclideanScore(1) scores distances up to 1 at least 0.5.
+	got = s.SimilaritySearchVector([]float32{20, 0, 0}, 5, WithScoreThreshold(0.5))
+	require.Len(t, got, 3)
+	for _, doc := range got {
+		require.GreaterOrEqual(t, doc.Score, float32(0.5))
+	}
+	require.Empty(t, s.SimilaritySearchVector([]float32{20, 0, 0}, 5, WithScoreThreshold(1.5)))
+}